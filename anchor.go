@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+
+	"github.com/russross/blackfriday"
+)
+
+// HTMLHeadingAnchors is an HTML bit of our own, beyond blackfriday's, which
+// turns on AnchorRenderer. RenderMarkdown clears it before blackfriday sees it.
+const HTMLHeadingAnchors = 1 << 30
+
+// AnchorRenderer is a blackfriday Renderer which appends a permalink to every
+// heading with an id: an <a> of class -anchor.class, linking to the heading,
+// with -anchor.symbol as its text.
+type AnchorRenderer struct {
+	blackfriday.Renderer
+}
+
+func (r AnchorRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	start := out.Len()
+	r.Renderer.Header(out, text, level, id)
+	if id == "" {
+		return
+	}
+
+	closing := []byte(fmt.Sprintf("</h%d>", level))
+	i := bytes.LastIndex(out.Bytes()[start:], closing)
+	if i < 0 {
+		return
+	}
+	tail := append([]byte{}, out.Bytes()[start+i:]...)
+	out.Truncate(start + i)
+	fmt.Fprintf(out, ` <a class="%s" href="#%s">%s</a>`, html.EscapeString(*anchorClass), html.EscapeString(id), html.EscapeString(*anchorSymbol))
+	out.Write(tail)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHeadingAnchors(t *testing.T) {
+	input := []byte("## Some *heading*\n\ntext\n")
+	for _, c := range []struct {
+		metadata map[string]interface{}
+		symbol   string
+		class    string
+		expected string
+	}{
+		{
+			map[string]interface{}{}, "#", "heading-anchor",
+			`<h2 id="some-heading">Some <em>heading</em> <a class="heading-anchor" href="#some-heading">#</a></h2>` + "\n\n<p>text</p>\n",
+		},
+		{
+			map[string]interface{}{}, "¶", "permalink",
+			`<h2 id="some-heading">Some <em>heading</em> <a class="permalink" href="#some-heading">¶</a></h2>` + "\n\n<p>text</p>\n",
+		},
+		{
+			map[string]interface{}{"anchors": false}, "#", "heading-anchor",
+			`<h2 id="some-heading">Some <em>heading</em></h2>` + "\n\n<p>text</p>\n",
+		},
+		{
+			map[string]interface{}{}, "", "heading-anchor",
+			`<h2 id="some-heading">Some <em>heading</em></h2>` + "\n\n<p>text</p>\n",
+		},
+		{
+			map[string]interface{}{"autoheaderids": false}, "#", "heading-anchor",
+			"<h2>Some <em>heading</em></h2>\n\n<p>text</p>\n",
+		},
+	} {
+		func() {
+			defer func(symbol, class string) { *anchorSymbol, *anchorClass = symbol, class }(*anchorSymbol, *anchorClass)
+			*anchorSymbol, *anchorClass = c.symbol, c.class
+
+			htmlBits, extensionBits := MarkdownBits(c.metadata)
+			if got := string(RenderMarkdown(input, htmlBits, extensionBits)); c.expected != got {
+				t.Errorf("%v %q %q: expected %q, got %q", c.metadata, c.symbol, c.class, c.expected, got)
+			}
+		}()
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	runtimedebug "runtime/debug"
+	"strings"
+	"time"
+)
+
+// BuildKey is the key of the root metadata the BuildMetadata is under.
+const BuildKey = "build"
+
+// Version is the version of grender, set when it's released with
+// -ldflags "-X main.Version=...".
+var Version = ""
+
+// CommitEnv are the environment variables, set by CI and hosting services,
+// that may name the commit being built. The first one set wins.
+var CommitEnv = []string{"GRENDER_COMMIT", "GITHUB_SHA", "CI_COMMIT_SHA", "COMMIT_REF", "VERCEL_GIT_COMMIT_SHA"}
+
+// BuildMetadata returns the build's "time", the grender "version", and the
+// "commit" of the source directory, from the CommitEnv or git, or "" if
+// neither knows it.
+func BuildMetadata() map[string]interface{} {
+	return map[string]interface{}{
+		"time":    time.Now(),
+		"version": BuildVersion(),
+		"commit":  BuildCommit(),
+	}
+}
+
+// BuildVersion returns the Version, or the module version grender was built
+// from, or "devel".
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := runtimedebug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+// BuildCommit returns the hash of the commit being built. It's best-effort:
+// outside a git repository, or without git, it's "".
+func BuildCommit() string {
+	for _, name := range CommitEnv {
+		if commit := strings.TrimSpace(os.Getenv(name)); commit != "" {
+			return commit
+		}
+	}
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = *sourceDir
+	buf, err := cmd.Output()
+	if err != nil {
+		Debugf("build commit: git: %s", err)
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
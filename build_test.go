@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildMetadata(t *testing.T) {
+	files := map[string]string{
+		"index.html": "{{ .build.version }} {{ .build.commit }} {{ .build.time.Year }}",
+	}
+	withSite(t, files, func() {
+		defer os.Setenv("GRENDER_COMMIT", os.Getenv("GRENDER_COMMIT"))
+		os.Setenv("GRENDER_COMMIT", "abc123")
+
+		s, _, err := Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, _, err := RenderFile(s, filepath.Join(*sourceDir, "index.html"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "devel abc123 "+time.Now().Format("2006"), string(buf); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestBuildCommit(t *testing.T) {
+	for _, name := range CommitEnv {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	withSite(t, map[string]string{"index.html": "index"}, func() {
+		if commit := BuildCommit(); commit != "" {
+			t.Errorf("outside a repository: expected no commit, got %q", commit)
+		}
+
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("no git")
+		}
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"add", "."},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "test"},
+		} {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = *sourceDir
+			if buf, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %s: %s", args, err, buf)
+			}
+		}
+		if commit := BuildCommit(); len(commit) != 40 {
+			t.Errorf("expected a commit hash, got %q", commit)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	bundleMtx sync.Mutex
+	bundles   = map[string][]string{} // target file: source files, since the build began
+)
+
+// Bundle concatenates the CSS or JS files into one asset named name, writes
+// it to the target directory, minified with -minify and fingerprinted with
+// -fingerprint, and returns its URL. Names are relative to the directory of
+// the page at path, or to the source directory with a leading slash. A file
+// named more than once is only included the first time. Every page that
+// names the bundle must name the same files; it's only written once.
+func Bundle(path, name string, files []string, deps *Dependencies) (string, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if !FingerprintTypes[ext] {
+		return "", fmt.Errorf("bundle %s: only CSS and JS files can be bundled", name)
+	}
+	source := SourceFileFor(path, name)
+	if _, err := os.Stat(source); err == nil {
+		return "", fmt.Errorf("bundle %s: a source file has that name", name)
+	}
+	separator := "\n"
+	if ext == ".js" {
+		separator = ";\n" // in case a file doesn't end its last statement
+	}
+
+	sources, included := []string{}, map[string]bool{}
+	buf := bytes.Buffer{}
+	for _, file := range files {
+		filename := SourceFileFor(path, file)
+		if included[filename] {
+			continue
+		}
+		included[filename] = true
+		if strings.ToLower(filepath.Ext(filename)) != ext {
+			return "", fmt.Errorf("bundle %s: %s isn't a %s file", name, file, ext)
+		}
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", fmt.Errorf("bundle %s: %s", name, err)
+		}
+		deps.Read(filename)
+		sources = append(sources, filename)
+		buf.Write(contents)
+		buf.WriteString(separator)
+	}
+
+	dst := TargetFileFor(source, filepath.Ext(source))
+	contents := Minify(dst, buf.Bytes())
+	if *fingerprint {
+		dst = FingerprintFile(dst, contents)
+	}
+
+	bundleMtx.Lock()
+	defer bundleMtx.Unlock()
+	if previous, ok := bundles[dst]; !ok {
+		Write(dst, contents)
+		bundles[dst] = sources
+		Debugf("bundle %s written (%d file(s))", dst, len(sources))
+	} else if strings.Join(previous, "\n") != strings.Join(sources, "\n") {
+		return "", fmt.Errorf("bundle %s: another page bundles different files into it", name)
+	}
+	deps.Wrote(dst)
+	return URLFor(dst), nil
+}
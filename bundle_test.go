@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	files := map[string]string{
+		"css/reset.css":  "* { margin: 0 }",
+		"css/layout.css": "body { color: red }",
+		"js/a.js":        "var a = 1",
+		"index.html":     `{{ bundle "/css/site.css" "/css/reset.css" "css/layout.css" "/css/reset.css" }} {{ bundle "js/all.js" "js/a.js" }}`,
+		"blog/post.html": `{{ bundle "/css/site.css" "../css/reset.css" "../css/layout.css" }}`,
+		"bad.html":       `{{ bundle "/css/site.css" "/css/layout.css" }}`,
+	}
+	withSite(t, files, func() {
+		defer func() { bundles = map[string][]string{} }()
+		s := gather(t)
+		for _, name := range []string{"index.html", "blog/post.html"} {
+			if _, errs := Transform(s, []string{filepath.Join(*sourceDir, name)}, 1, NewDependencyGraph()); len(errs) > 0 {
+				t.Fatal(errs[0])
+			}
+		}
+		for name, expected := range map[string]string{
+			"index.html":     "/css/site.css /js/all.js",
+			"blog/post.html": "/css/site.css",
+			"css/site.css":   "* { margin: 0 }\nbody { color: red }\n",
+			"js/all.js":      "var a = 1;\n",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+
+		_, errs := Transform(s, []string{filepath.Join(*sourceDir, "bad.html")}, 1, NewDependencyGraph())
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "different files") {
+			t.Errorf("expected an error for different files, got %v", errs)
+		}
+		for _, args := range [][]string{
+			{"css/reset.css"},                  // a source file
+			{"all.txt", "css/reset.css"},       // not CSS or JS
+			{"mixed.css", "js/a.js"},           // not CSS
+			{"missing.css", "css/nothing.css"}, // no such file
+		} {
+			if _, err := Bundle(filepath.Join(*sourceDir, "index.html"), args[0], args[1:], nil); err == nil {
+				t.Errorf("%v: expected an error", args)
+			}
+		}
+	})
+}
+
+func TestBundleFingerprint(t *testing.T) {
+	files := map[string]string{
+		"a.css": "a { color: red }",
+		"b.css": "b { color: blue }",
+	}
+	withSite(t, files, func() {
+		defer func(f bool) { *fingerprint = f }(*fingerprint)
+		*fingerprint = true
+		defer func() { bundles = map[string][]string{} }()
+
+		url, err := Bundle(filepath.Join(*sourceDir, "index.html"), "all.css", []string{"a.css", "b.css"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents := files["a.css"] + "\n" + files["b.css"] + "\n"
+		if expected := "/" + FingerprintFile("all.css", []byte(contents)); url != expected {
+			t.Errorf("expected %s, got %s", expected, url)
+		}
+		if got := string(Read(filepath.Join(*targetDir, filepath.FromSlash(url)))); got != contents {
+			t.Errorf("expected %q, got %q", contents, got)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"html/template"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// TemplateCache holds parsed templates, keyed by the file they came from and
+// their input, so that templates used by many pages are only read and parsed
+// once. A file is parsed again whenever its modification time changes. It's
+// safe for concurrent use: templates are parsed outside the lock, once per key.
+type TemplateCache struct {
+	mtx sync.Mutex
+	m   map[templateKey]*templateEntry
+}
+
+// templateKey identifies a template: some templates are only a part of their
+// file, e.g. the content after the front matter, so the key holds a hash of
+// the input, unless it's the whole file.
+type templateKey struct {
+	filename string
+	name     string
+	whole    bool
+	sum      [sha256.Size]byte // of the input, unless whole
+}
+
+// templateEntry is a template which is parsed once, by the first Lookup.
+type templateEntry struct {
+	once    sync.Once
+	modTime time.Time
+	cached  *CachedTemplate
+	err     error
+}
+
+var (
+	Templates = NewTemplateCache()
+)
+
+func NewTemplateCache() *TemplateCache {
+	return &TemplateCache{
+		m: map[templateKey]*templateEntry{},
+	}
+}
+
+// Lookup returns the template named name, parsed from input, or from the
+// contents of filename if input is nil.
+func (c *TemplateCache) Lookup(filename, name string, input []byte) (*CachedTemplate, error) {
+	info, err := os.Stat(filename)
+	if err != nil && input == nil {
+		return nil, err
+	} else if err != nil {
+		return parseTemplate(filename, name, input) // nothing to key it by
+	}
+
+	key := templateKey{filename: filename, name: name, whole: input == nil}
+	if !key.whole {
+		key.sum = sha256.Sum256(input)
+	}
+	c.mtx.Lock()
+	e, ok := c.m[key]
+	if !ok || !e.modTime.Equal(info.ModTime()) {
+		e = &templateEntry{modTime: info.ModTime()}
+		c.m[key] = e
+	}
+	c.mtx.Unlock()
+
+	e.once.Do(func() {
+		if key.whole {
+			input = Read(filename)
+		}
+		e.cached, e.err = parseTemplate(filename, name, input)
+	})
+	return e.cached, e.err
+}
+
+// ContentCache holds the rendered content of Markdown pages, with the files
+// read to render it, so that Transform renders a page's content only once, for
+// both its summary and the page. The content of a listing isn't reused, as the
+// other pages' summaries may go into it. It's safe for concurrent use.
+type ContentCache struct {
+	mtx sync.Mutex
+	m   map[string]*contentEntry // source file: rendered content
+}
+
+// contentEntry is the content of a page, which is rendered once, by the first
+// Render.
+type contentEntry struct {
+	once    sync.Once
+	content template.HTML
+	sources []string
+	err     error
+	listing bool
+}
+
+// Contents is the ContentCache of the running Transform, if any.
+var Contents *ContentCache
+
+func NewContentCache() *ContentCache {
+	return &ContentCache{
+		m: map[string]*contentEntry{},
+	}
+}
+
+// Render returns the content of the Markdown source file at path, rendered by
+// RenderContent the first time, unless it's a listing, and records the files
+// read to render it in deps. A nil ContentCache renders the content every time.
+func (c *ContentCache) Render(path string, metadata map[string]interface{}, deps *Dependencies) (template.HTML, error) {
+	if c == nil {
+		return RenderContent(path, metadata, deps)
+	}
+	c.mtx.Lock()
+	e, ok := c.m[path]
+	if !ok {
+		e = &contentEntry{}
+		c.m[path] = e
+	}
+	c.mtx.Unlock()
+
+	rendered := false
+	e.once.Do(func() {
+		d := &Dependencies{}
+		e.content, e.err = RenderContent(path, metadata, d)
+		e.sources, e.listing, rendered = d.Sources, IsListing(d), true
+	})
+	if e.listing && !rendered {
+		return RenderContent(path, metadata, deps)
+	}
+	for _, source := range e.sources {
+		deps.Read(source)
+	}
+	return e.content, e.err
+}
+
+// CachedTemplate is a parsed template. Templates are parsed with the
+// functions of TemplateFuncs, which are rebound to the metadata of every
+// use.
+type CachedTemplate struct {
+	listing  bool               // refers to one of the ListingKeys
+	tmpl     *template.Template // never executed; cloned for every use
+	executed sync.Pool          // clones which have been executed, and so escaped
+}
+
+func parseTemplate(filename, name string, input []byte) (*CachedTemplate, error) {
+	tmpl, err := template.New(name).Funcs(TemplateFuncs(filename, nil, nil)).Parse(string(input))
+	if err != nil {
+		return nil, err
+	}
+	Debugf("%s parsed", filename)
+	keys := map[string]bool{}
+	for _, key := range ListingKeys() {
+		keys[key] = true
+	}
+	listing := false
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && listsPages(t.Tree.Root, keys) {
+			listing = true
+		}
+	}
+	return &CachedTemplate{listing: listing, tmpl: tmpl}, nil
+}
+
+// Clone returns a copy of the template, for composing with other templates.
+func (t *CachedTemplate) Clone() (*template.Template, error) {
+	return t.tmpl.Clone()
+}
+
+// Execute executes the template against data, with the passed functions and
+// the MissingKeyOption. Copies of the template are reused, so that it's only
+// escaped once.
+func (t *CachedTemplate) Execute(w io.Writer, funcs template.FuncMap, data interface{}) error {
+	tmpl, ok := t.executed.Get().(*template.Template)
+	if !ok {
+		var err error
+		if tmpl, err = t.tmpl.Clone(); err != nil {
+			return err
+		}
+	}
+	if err := tmpl.Funcs(funcs).Option(MissingKeyOption()).Execute(w, data); err != nil {
+		return err
+	}
+	t.executed.Put(tmpl)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func BenchmarkRenderTemplate(b *testing.B) {
+	files := map[string]string{
+		"_partials/nav.html": strings.Repeat(`<a href="{{ .url }}">{{ if .title }}{{ .title }}{{ else }}untitled{{ end }}</a>`, 50),
+		"page.html":          strings.Repeat(`{{ partial "nav" }}<p>{{ .title }}</p>`, 10),
+	}
+	withSite(b, files, func() {
+		path := filepath.Join(*sourceDir, "page.html")
+		metadata := map[string]interface{}{"title": "Page", "url": "/page.html"}
+		for _, cached := range []bool{false, true} {
+			name := "uncached"
+			if cached {
+				name = "cached"
+			}
+			b.Run(name, func(b *testing.B) {
+				defer func(c *TemplateCache) { Templates = c }(Templates)
+				Templates = NewTemplateCache()
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if !cached {
+						Templates = NewTemplateCache()
+					}
+					if _, err := RenderTemplate(path, nil, metadata, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestTemplateCache(t *testing.T) {
+	withSite(t, map[string]string{"a.html": `{{ .x }}`}, func() {
+		c := NewTemplateCache()
+		path := filepath.Join(*sourceDir, "a.html")
+		for _, input := range []string{"", "y{{ .x }}", "", "", "y{{ .x }}"} {
+			expected, buf := "{{.x}}", []byte(nil)
+			if input != "" {
+				expected, buf = "y{{.x}}", []byte(input)
+			}
+			cached, err := c.Lookup(path, "a.html", buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cached.tmpl.Tree.Root.String(); expected != got {
+				t.Errorf("input %q: expected %q, got %q", input, expected, got)
+			}
+		}
+	})
+}
+
+func TestTemplateCacheInputs(t *testing.T) {
+	withSite(t, map[string]string{"a.html": `{{ .x }}`}, func() {
+		c := NewTemplateCache()
+		path := filepath.Join(*sourceDir, "a.html")
+		inputs := [][]byte{nil, []byte("y{{ .x }}"), []byte("z{{ .x }}")}
+		first := map[int]*CachedTemplate{}
+		var wg sync.WaitGroup
+		var mtx sync.Mutex
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				cached, err := c.Lookup(path, "a.html", inputs[i%len(inputs)])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mtx.Lock()
+				defer mtx.Unlock()
+				if other, ok := first[i%len(inputs)]; ok && other != cached {
+					t.Errorf("input %d: parsed more than once", i%len(inputs))
+				}
+				first[i%len(inputs)] = cached
+			}(i)
+		}
+		wg.Wait()
+		if len(c.m) != len(inputs) {
+			t.Errorf("expected %d cached templates, got %d", len(inputs), len(c.m))
+		}
+	})
+}
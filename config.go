@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// ConfigFile is the default -config file, read from the working directory if
+// it exists.
+const ConfigFile = "grender.json"
+
+// LoadConfig sets the flags in fs from the JSON object in filename, whose keys
+// are flag names, and whose values are strings, numbers or booleans. Flags set
+// on the commandline override the file. It's not an error for the file not to
+// exist, unless required.
+func LoadConfig(fs *flag.FlagSet, filename string, required bool) error {
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) && !required {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	config := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber() // keep integers as they're written
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := []string{}
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown flag '%s'", filename, name)
+		}
+		if set[name] {
+			Debugf("%s: %s set on the commandline", filename, name)
+			continue
+		}
+		switch value := config[name].(type) {
+		case string, json.Number, bool:
+			if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("%s: %s: %s", filename, name, err)
+			}
+		default:
+			return fmt.Errorf("%s: %s: bad type %T", filename, name, value)
+		}
+	}
+	return nil
+}
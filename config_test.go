@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "grender-test-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	newFlagSet := func() (*flag.FlagSet, *string, *string, *bool, *int) {
+		fs := flag.NewFlagSet("grender", flag.ContinueOnError)
+		return fs, fs.String("source", "src", ""), fs.String("permalink", "", ""), fs.Bool("drafts", false, ""), fs.Int("jobs", 1, "")
+	}
+
+	filename := filepath.Join(root, ConfigFile)
+	Write(filename, []byte(`{"source":"site","permalink":"/:slug/","drafts":true,"jobs":8}`))
+	fs, source, permalink, drafts, jobs := newFlagSet()
+	if err := fs.Parse([]string{"-source", "elsewhere"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(fs, filename, true); err != nil {
+		t.Fatal(err)
+	}
+	if *source != "elsewhere" {
+		t.Errorf("source: expected the commandline to win, got '%s'", *source)
+	}
+	if *permalink != "/:slug/" || !*drafts || *jobs != 8 {
+		t.Errorf("expected values from the file, got '%s' %v %d", *permalink, *drafts, *jobs)
+	}
+
+	fs, _, _, _, _ = newFlagSet()
+	if err := LoadConfig(fs, filepath.Join(root, "missing.json"), false); err != nil {
+		t.Errorf("missing optional file: %s", err)
+	}
+	if err := LoadConfig(fs, filepath.Join(root, "missing.json"), true); err == nil {
+		t.Errorf("missing required file: expected error")
+	}
+	for _, buf := range []string{`{"nonexistent":1}`, `{"jobs":"many"}`, `{"source":["a"]}`, `{`} {
+		Write(filename, []byte(buf))
+		fs, _, _, _, _ = newFlagSet()
+		if err := LoadConfig(fs, filename, true); err == nil {
+			t.Errorf("%s: expected error", buf)
+		}
+	}
+}
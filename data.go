@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DataKey is the key of the root metadata the data files are under.
+const DataKey = "data"
+
+// dataFiles are the files LoadData last loaded, which every page depends on.
+var dataFiles []string
+
+// DataDir returns the absolute path of the data directory, or "" with -data
+// empty. Its files are never transformed themselves.
+func DataDir() string {
+	if *dataDir == "" {
+		return ""
+	}
+	return filepath.Join(*sourceDir, *dataDir)
+}
+
+// LoadData parses every JSON, YAML and TOML file in dir into one nested map:
+// each file's contents under its name without the extension, within a map for
+// every directory it's in. _data/nav/menu.yaml is {{ .data.nav.menu }}. A
+// missing directory is no data. It also returns the files it parsed.
+func LoadData(dir string) (map[string]interface{}, []string, error) {
+	data, files := map[string]interface{}{}, []string{}
+	if _, err := os.Stat(dir); dir == "" || os.IsNotExist(err) {
+		return data, files, nil
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil // descend
+		}
+
+		var value interface{}
+		buf := Read(path)
+		switch ext := strings.ToLower(filepath.Ext(path)); ext {
+		case ".json":
+			err = UnmarshalJSON(buf, &value)
+		case ".yaml", ".yml":
+			if err = yaml.Unmarshal(buf, &value); err == nil {
+				value = stringKeys(value)
+			}
+		case ".toml":
+			value, err = ParseTOML(buf)
+		default:
+			Debugf("%s: not a data file; skipping", path)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if value, err = interpolate(value); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		m := data
+		elements := strings.Split(filepath.ToSlash(Relative(dir, path)), "/")
+		for _, element := range elements[:len(elements)-1] {
+			sub, ok := m[element].(map[string]interface{})
+			if !ok {
+				if _, exists := m[element]; exists {
+					return fmt.Errorf("%s: %s is also a data file", path, element)
+				}
+				sub = map[string]interface{}{}
+				m[element] = sub
+			}
+			m = sub
+		}
+		name := strings.TrimSuffix(elements[len(elements)-1], filepath.Ext(path))
+		if _, exists := m[name]; exists {
+			return fmt.Errorf("%s: more than one data file or directory named %s", path, name)
+		}
+		m[name] = value
+		files = append(files, path)
+		Debugf("%s loaded into %s", path, DataKey)
+		return nil
+	})
+	return data, files, err
+}
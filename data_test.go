@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadData(t *testing.T) {
+	files := map[string]string{
+		"_data/menu.yaml":      "- name: Home\n  url: /\n- name: About\n  url: /about.html\n",
+		"_data/site.json":      `{"owner":"${GRENDER_TEST_OWNER}"}`,
+		"_data/nav/links.toml": "[github]\nurl = \"https://github.com\"\n",
+		"_data/README.txt":     "not data",
+		"_data/.hidden.json":   `{"broken":`,
+		"_data/page.json":      `{"ignored":"for the stack"}`,
+		"index.html":           `{{ range .data.menu }}{{ .name }}={{ .url }} {{ end }}{{ .data.site.owner }} {{ .data.nav.links.github.url }}`,
+	}
+	os.Setenv("GRENDER_TEST_OWNER", "Ann")
+	defer os.Unsetenv("GRENDER_TEST_OWNER")
+	defer func() { dataFiles = nil }()
+	withSite(t, files, func() {
+		s, paths, err := Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(*targetDir, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "Home=/ About=/about.html Ann https://github.com", string(buf); expected != got {
+			t.Errorf("expected '%s', got '%s'", expected, got)
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "_data")); err == nil {
+			t.Errorf("expected the data directory not to be copied")
+		}
+		if got := fmt.Sprint(MetadataFiles(filepath.Join(*sourceDir, "index.html"))); got != fmt.Sprint([]string{
+			filepath.Join(DataDir(), "menu.yaml"),
+			filepath.Join(DataDir(), "nav", "links.toml"),
+			filepath.Join(DataDir(), "page.json"),
+			filepath.Join(DataDir(), "site.json"),
+		}) {
+			t.Errorf("expected the data files among the metadata files, got %s", got)
+		}
+
+		Write(filepath.Join(DataDir(), "nav.json"), []byte(`{}`))
+		if _, _, err := LoadData(DataDir()); err == nil {
+			t.Errorf("expected an error for nav.json and nav/")
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLEmoji is an HTML bit of our own, like HTMLHeadingAnchors, which turns
+// on EmojifyHTML.
+const HTMLEmoji = 1 << 29
+
+var (
+	emojiRegexp = regexp.MustCompile(`:([a-z0-9_+\-]+):`)
+
+	// Emoji maps the :name: of an emoji to the emoji itself. The names are
+	// the common GitHub and Slack ones.
+	Emoji = map[string]string{
+		"+1":                   "👍",
+		"-1":                   "👎",
+		"100":                  "💯",
+		"angry":                "😠",
+		"apple":                "🍎",
+		"arrow_down":           "⬇️",
+		"arrow_left":           "⬅️",
+		"arrow_right":          "➡️",
+		"arrow_up":             "⬆️",
+		"beer":                 "🍺",
+		"bell":                 "🔔",
+		"blush":                "😊",
+		"book":                 "📖",
+		"books":                "📚",
+		"boom":                 "💥",
+		"broken_heart":         "💔",
+		"bug":                  "🐛",
+		"bulb":                 "💡",
+		"cake":                 "🍰",
+		"calendar":             "📆",
+		"camera":               "📷",
+		"cat":                  "🐱",
+		"champagne":            "🍾",
+		"clap":                 "👏",
+		"cloud":                "☁️",
+		"coffee":               "☕",
+		"computer":             "💻",
+		"confused":             "😕",
+		"construction":         "🚧",
+		"cool":                 "🆒",
+		"cry":                  "😢",
+		"dog":                  "🐶",
+		"email":                "📧",
+		"exclamation":          "❗",
+		"eyes":                 "👀",
+		"fire":                 "🔥",
+		"flushed":              "😳",
+		"gear":                 "⚙️",
+		"ghost":                "👻",
+		"gift":                 "🎁",
+		"globe_with_meridians": "🌐",
+		"grin":                 "😁",
+		"grinning":             "😀",
+		"heart":                "❤️",
+		"heart_eyes":           "😍",
+		"heavy_check_mark":     "✔️",
+		"hourglass":            "⌛",
+		"house":                "🏠",
+		"hugs":                 "🤗",
+		"information_source":   "ℹ️",
+		"joy":                  "😂",
+		"key":                  "🔑",
+		"kiss":                 "💋",
+		"laughing":             "😆",
+		"link":                 "🔗",
+		"lock":                 "🔒",
+		"mag":                  "🔍",
+		"memo":                 "📝",
+		"moon":                 "🌙",
+		"muscle":               "💪",
+		"neutral_face":         "😐",
+		"no_entry":             "⛔",
+		"ok":                   "🆗",
+		"ok_hand":              "👌",
+		"package":              "📦",
+		"pencil":               "📝",
+		"point_down":           "👇",
+		"point_left":           "👈",
+		"point_right":          "👉",
+		"point_up":             "☝️",
+		"pray":                 "🙏",
+		"question":             "❓",
+		"rainbow":              "🌈",
+		"raised_hands":         "🙌",
+		"rocket":               "🚀",
+		"rofl":                 "🤣",
+		"rotating_light":       "🚨",
+		"scream":               "😱",
+		"see_no_evil":          "🙈",
+		"shrug":                "🤷",
+		"skull":                "💀",
+		"sleeping":             "😴",
+		"smile":                "😄",
+		"smiley":               "😃",
+		"smirk":                "😏",
+		"snowflake":            "❄️",
+		"sob":                  "😭",
+		"sparkles":             "✨",
+		"star":                 "⭐",
+		"stuck_out_tongue":     "😛",
+		"sunglasses":           "😎",
+		"sunny":                "☀️",
+		"sweat_smile":          "😅",
+		"tada":                 "🎉",
+		"thinking":             "🤔",
+		"thumbsdown":           "👎",
+		"thumbsup":             "👍",
+		"trophy":               "🏆",
+		"umbrella":             "☔",
+		"unamused":             "😒",
+		"warning":              "⚠️",
+		"wave":                 "👋",
+		"white_check_mark":     "✅",
+		"wink":                 "😉",
+		"worried":              "😟",
+		"wrench":               "🔧",
+		"x":                    "❌",
+		"zap":                  "⚡",
+		"zzz":                  "💤",
+	}
+)
+
+// EmojifyHTML replaces every :name: in the Emoji table with its emoji, in the
+// text of rendered HTML. Tags and their attributes, and code, pre, script and
+// style elements are left alone, as are names that aren't in the table.
+func EmojifyHTML(input []byte) []byte {
+	output := bytes.Buffer{}
+	z := html.NewTokenizer(bytes.NewReader(input))
+	verbatim := 0 // depth of code and pre elements
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return output.Bytes()
+		case html.TextToken:
+			if verbatim > 0 {
+				output.Write(z.Raw())
+				continue
+			}
+			output.Write(emojiRegexp.ReplaceAllFunc(z.Raw(), func(match []byte) []byte {
+				if emoji, ok := Emoji[string(match[1:len(match)-1])]; ok {
+					return []byte(emoji)
+				}
+				return match
+			}))
+		case html.StartTagToken:
+			raw := append([]byte{}, z.Raw()...)
+			if name, _ := z.TagName(); isVerbatim(atom.Lookup(name)) {
+				verbatim++
+			}
+			output.Write(raw)
+		case html.EndTagToken:
+			raw := append([]byte{}, z.Raw()...)
+			if name, _ := z.TagName(); isVerbatim(atom.Lookup(name)) && verbatim > 0 {
+				verbatim--
+			}
+			output.Write(raw)
+		default:
+			output.Write(z.Raw())
+		}
+	}
+}
+
+func isVerbatim(a atom.Atom) bool {
+	return a == atom.Code || a == atom.Pre || a == atom.Script || a == atom.Style
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEmojifyHTML(t *testing.T) {
+	for input, expected := range map[string]string{
+		"<p>done :tada: :+1:</p>":                          "<p>done 🎉 👍</p>",
+		"<p>:nope: and 10:30:45 stay</p>":                  "<p>:nope: and 10:30:45 stay</p>",
+		`<p><a href="http://a.com/:tada:/">:tada:</a></p>`: `<p><a href="http://a.com/:tada:/">🎉</a></p>`,
+		"<p><code>:tada:</code> :fire:</p>":                "<p><code>:tada:</code> 🔥</p>",
+		"<pre><code>:tada:\n</code></pre>\n<p>:x:</p>":     "<pre><code>:tada:\n</code></pre>\n<p>❌</p>",
+		"<p>a &amp; :wave:<br/></p>":                       "<p>a &amp; 👋<br/></p>",
+	} {
+		if got := string(EmojifyHTML([]byte(input))); expected != got {
+			t.Errorf("%q: expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+func TestEmojiOption(t *testing.T) {
+	input := []byte("Shipped :rocket: see http://example.com:8080/ and `:rocket:`\n")
+	htmlBits, extensionBits := MarkdownBits(map[string]interface{}{})
+	if expected, got := "<p>Shipped :rocket: see <a href=\"http://example.com:8080/\">http://example.com:8080/</a> and <code>:rocket:</code></p>\n", string(RenderMarkdown(input, htmlBits, extensionBits)); expected != got {
+		t.Errorf("off by default: expected %q, got %q", expected, got)
+	}
+
+	htmlBits, extensionBits = MarkdownBits(map[string]interface{}{"emoji": true})
+	if expected, got := "<p>Shipped 🚀 see <a href=\"http://example.com:8080/\">http://example.com:8080/</a> and <code>:rocket:</code></p>\n", string(RenderMarkdown(input, htmlBits, extensionBits)); expected != got {
+		t.Errorf("with emoji: expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var (
+	envRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// Interpolate replaces every ${VAR} in the string values of the passed
+// metadata, at any depth, with the value of that environment variable. With
+// -env.strict, an unset variable is an error; otherwise it expands to "".
+func Interpolate(metadata map[string]interface{}) (map[string]interface{}, error) {
+	v, err := interpolate(metadata)
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+func interpolate(i interface{}) (interface{}, error) {
+	switch v := i.(type) {
+	case string:
+		var err error
+		s := envRegexp.ReplaceAllStringFunc(v, func(match string) string {
+			name := envRegexp.FindStringSubmatch(match)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok && *envStrict && err == nil {
+				err = fmt.Errorf("environment variable %s not set", name)
+			}
+			return value
+		})
+		return s, err
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, v0 := range v {
+			v1, err := interpolate(v0)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v1
+		}
+		return m, nil
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for j, v0 := range v {
+			v1, err := interpolate(v0)
+			if err != nil {
+				return nil, err
+			}
+			a[j] = v1
+		}
+		return a, nil
+	}
+	return i, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("GRENDER_TEST_COMMIT", "abc123")
+	os.Unsetenv("GRENDER_TEST_UNSET")
+	defer os.Unsetenv("GRENDER_TEST_COMMIT")
+
+	metadata := map[string]interface{}{
+		"commit": "${GRENDER_TEST_COMMIT}",
+		"api":    map[string]interface{}{"base": "https://${GRENDER_TEST_COMMIT}.example.com/", "n": 1.0},
+		"list":   []interface{}{"a", "${GRENDER_TEST_COMMIT}"},
+		"unset":  "x${GRENDER_TEST_UNSET}y",
+		"plain":  "$HOME and {braces}",
+	}
+	m, err := Interpolate(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"api":{"base":"https://abc123.example.com/","n":1},"commit":"abc123","list":["a","abc123"],"plain":"$HOME and {braces}","unset":"xy"}`
+	if expected != string(got) {
+		t.Errorf("expected '%s', got '%s'", expected, string(got))
+	}
+	if metadata["commit"] != "${GRENDER_TEST_COMMIT}" {
+		t.Errorf("input modified")
+	}
+
+	defer func(s bool) { *envStrict = s }(*envStrict)
+	*envStrict = true
+	if _, err := Interpolate(metadata); err == nil {
+		t.Errorf("-env.strict: expected error for unset variable")
+	}
+}
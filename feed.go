@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pages maps the source path of every page rendered by Transform to the final
+// metadata it was rendered with, including its content.
+type Pages map[string]map[string]interface{}
+
+// FeedConfig is read from the "feed" key of the site-level metadata, i.e. the
+// .json files at the root of the source directory.
+type FeedConfig struct {
+	Title       string
+	Description string
+	Link        string // site URL, prefixed to page URLs
+	Limit       int    // maximum number of items; 0 means all of them
+	Dir         string // where the feed is written, in the target directory
+}
+
+// NewFeedConfig returns the FeedConfig found in the Stack.
+func NewFeedConfig(s StackReader) FeedConfig {
+	m, _ := s.Get(*sourceDir)["feed"].(map[string]interface{})
+	cfg := FeedConfig{}
+	cfg.Title, _ = m["title"].(string)
+	cfg.Description, _ = m["description"].(string)
+	cfg.Link, _ = m["link"].(string)
+	cfg.Link = strings.TrimRight(cfg.Link, "/")
+	cfg.Dir = *targetDir
+	if limit, ok := m["limit"].(float64); ok {
+		cfg.Limit = int(limit)
+	}
+	return cfg
+}
+
+// URL returns the absolute URL of the page at u. With a -baseurl path, u
+// already starts with it, so it's joined with the scheme and host of the Link
+// only; otherwise, with the whole Link.
+func (cfg FeedConfig) URL(u string) string {
+	if link, err := url.Parse(cfg.Link); err == nil && link.Host != "" && BasePath() != "" {
+		return link.Scheme + "://" + link.Host + u
+	}
+	return cfg.Link + u
+}
+
+// FeedItem is a page with a date, as it appears in a feed.
+type FeedItem struct {
+	Title   string
+	URL     string
+	Date    time.Time
+	Content string // rendered HTML
+	Summary string // "summary" metadata, if any
+	Lang    string // "lang" metadata, on multilingual sites
+}
+
+// Description returns the summary of the item, if it has one, and its
+// content otherwise.
+func (fi FeedItem) Description() string {
+	if fi.Summary != "" {
+		return fi.Summary
+	}
+	return fi.Content
+}
+
+// FeedItems returns a FeedItem for every page whose metadata has a parseable
+// "date", newest first. Content is taken from the pages rendered by
+// Transform; pages it skipped (in incremental mode) have theirs rendered
+// afresh.
+func FeedItems(s StackReader, paths []string, pages Pages) ([]FeedItem, error) {
+	items := []FeedItem{}
+	for _, path := range paths {
+		ext := PageExt(path)
+		if ext != ".html" && ext != ".md" {
+			continue
+		}
+		metadata, ok := pages[path]
+		if !ok {
+			metadata = s.Get(path)
+		}
+		if Unpublished(metadata) {
+			continue
+		}
+		date, ok := ParseDate(metadata["date"])
+		if !ok {
+			continue
+		}
+
+		item := FeedItem{Date: date}
+		item.Title, _ = metadata["title"].(string)
+		item.URL, _ = metadata["url"].(string)
+		item.Summary = stringValue(metadata["summary"])
+		item.Lang = stringValue(metadata["lang"])
+		if content, ok := metadata["content"]; ok {
+			item.Content = stringValue(content)
+		} else if ext == ".md" {
+			content, err := RenderContent(path, metadata, nil)
+			if err != nil {
+				return []FeedItem{}, err
+			}
+			item.Content = string(content)
+		}
+		items = append(items, item)
+	}
+
+	sort.Sort(feedItems(items))
+	return items, nil
+}
+
+// feedItems sorts newest first, breaking ties by URL.
+type feedItems []FeedItem
+
+func (a feedItems) Len() int      { return len(a) }
+func (a feedItems) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a feedItems) Less(i, j int) bool {
+	if !a[i].Date.Equal(a[j].Date) {
+		return a[i].Date.After(a[j].Date)
+	}
+	return a[i].URL < a[j].URL
+}
+
+// WriteFeeds writes the site's feed in every format listed by -feed.format to
+// the target directory, if there are any pages with dates. A multilingual site
+// gets a feed for every language, in the language's directory.
+func WriteFeeds(s StackReader, paths []string, pages Pages) error {
+	items, err := FeedItems(s, paths, pages)
+	if err != nil {
+		return err
+	}
+	if len(Languages()) <= 0 {
+		return writeFeeds(NewFeedConfig(s), items)
+	}
+	for _, lang := range Languages() {
+		cfg := NewFeedConfig(s)
+		cfg.Dir = LanguagePath(*targetDir, lang)
+		langItems := []FeedItem{}
+		for _, item := range items {
+			if item.Lang == lang {
+				langItems = append(langItems, item)
+			}
+		}
+		if err := writeFeeds(cfg, langItems); err != nil {
+			return fmt.Errorf("%s: %s", lang, err)
+		}
+	}
+	return nil
+}
+
+func writeFeeds(cfg FeedConfig, items []FeedItem) error {
+	if len(items) <= 0 {
+		Debugf("no dated pages; no feed")
+		return nil
+	}
+	if cfg.Limit > 0 && len(items) > cfg.Limit {
+		items = items[:cfg.Limit]
+	}
+
+	for _, format := range strings.Split(*feedFormat, ",") {
+		var render func(FeedConfig, []FeedItem) ([]byte, error)
+		var filename string
+		switch format = strings.TrimSpace(format); format {
+		case "":
+			continue
+		case "rss":
+			render, filename = RSS, "rss.xml"
+		case "atom":
+			render, filename = Atom, "atom.xml"
+		case "jsonfeed":
+			render, filename = JSONFeed, JSONFeedFile
+		default:
+			return fmt.Errorf("unknown feed format '%s'", format)
+		}
+
+		buf, err := render(cfg, items)
+		if err != nil {
+			return fmt.Errorf("%s: %s", format, err)
+		}
+		dst := filepath.Join(cfg.Dir, filename)
+		Write(dst, buf)
+		Debugf("%s written (%d item(s))", dst, len(items))
+	}
+	return nil
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+}
+
+// RSS renders the items as an RSS 2.0 feed.
+func RSS(cfg FeedConfig, items []FeedItem) ([]byte, error) {
+	channel := rssChannel{
+		Title:       cfg.Title,
+		Link:        cfg.Link + "/",
+		Description: cfg.Description,
+	}
+	for _, item := range items {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        cfg.URL(item.URL),
+			Description: item.Description(),
+			PubDate:     item.Date.Format(time.RFC1123Z),
+			GUID:        cfg.URL(item.URL),
+		})
+	}
+
+	buf, err := xml.MarshalIndent(rss{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		return []byte{}, err
+	}
+	return append([]byte(xml.Header), append(buf, '\n')...), nil
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Summary string      `xml:"summary,omitempty"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Atom renders the items as an Atom 1.0 feed. Entry IDs are derived from the
+// page URLs, so they're stable across builds.
+func Atom(cfg FeedConfig, items []FeedItem) ([]byte, error) {
+	feed := atomFeed{
+		Title: cfg.Title,
+		ID:    cfg.Link + "/",
+		Link:  atomLink{Href: cfg.Link + "/"},
+	}
+	if len(items) > 0 {
+		feed.Updated = items[0].Date.Format(time.RFC3339) // newest first
+	}
+	for _, item := range items {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   item.Title,
+			ID:      cfg.URL(item.URL),
+			Link:    atomLink{Href: cfg.URL(item.URL)},
+			Updated: item.Date.Format(time.RFC3339),
+			Summary: item.Summary,
+			Content: atomContent{Type: "html", Body: item.Content},
+		})
+	}
+
+	buf, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return []byte{}, err
+	}
+	return append([]byte(xml.Header), append(buf, '\n')...), nil
+}
+
+// JSONFeedFile is the file JSONFeed is written to.
+const JSONFeedFile = "feed.json"
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Title         string `json:"title,omitempty"`
+	ContentHTML   string `json:"content_html"`
+	Summary       string `json:"summary,omitempty"`
+	DatePublished string `json:"date_published"`
+}
+
+// JSONFeed renders the items as a JSON Feed 1.1 (https://jsonfeed.org). Like
+// in Atom, item IDs are the page URLs.
+func JSONFeed(cfg FeedConfig, items []FeedItem) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       cfg.Title,
+		Description: cfg.Description,
+		Items:       []jsonFeedItem{},
+	}
+	if cfg.Link != "" {
+		dir := cfg.Dir
+		if dir == "" {
+			dir = *targetDir
+		}
+		feed.HomePageURL = cfg.Link + "/"
+		feed.FeedURL = cfg.URL(URLFor(filepath.Join(dir, JSONFeedFile)))
+	}
+	for _, item := range items {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            cfg.URL(item.URL),
+			URL:           cfg.URL(item.URL),
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			Summary:       item.Summary,
+			DatePublished: item.Date.Format(time.RFC3339),
+		})
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // content_html is HTML
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return []byte{}, err
+	}
+	return buf.Bytes(), nil
+}
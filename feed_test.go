@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFeeds(t *testing.T) {
+	files := map[string]string{
+		"_.json":                    `{"feed":{"title":"T","description":"D","link":"http://example.com/","limit":2}}`,
+		"blog/_.json":               `{"template":"entry.template"}`,
+		"blog/entry.template":       `{{ .content }}`,
+		"blog/2013-01-01-first.md":  "first",
+		"blog/2013-02-01-second.md": "{\"summary\":\"the second\"}\n---\nsecond",
+		"blog/2013-03-01-third.md":  "third",
+		"blog/undated.md":           "undated",
+		"index.html":                "home",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages, errs := Transform(s, paths, 1, NewDependencyGraph())
+		if len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+
+		items, err := FeedItems(s, paths, pages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 3 {
+			t.Fatalf("expected 3 items, got %d", len(items))
+		}
+		for i, title := range []string{"Third", "Second", "First"} {
+			if items[i].Title != title {
+				t.Errorf("item %d: expected '%s', got '%s'", i, title, items[i].Title)
+			}
+		}
+
+		if err := WriteFeeds(s, paths, pages); err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(*targetDir, "rss.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		feed := string(buf)
+		for _, expected := range []string{
+			"<title>T</title>",
+			"<link>http://example.com/blog/2013/03/01/third.html</link>",
+			"<description>the second</description>",
+		} {
+			if !strings.Contains(feed, expected) {
+				t.Errorf("expected feed to contain %s", expected)
+			}
+		}
+		if strings.Contains(feed, "first.html") {
+			t.Errorf("expected limit to drop the oldest item")
+		}
+
+		defer func(format string) { *feedFormat = format }(*feedFormat)
+		*feedFormat = "rss, atom"
+		if err := WriteFeeds(s, paths, pages); err != nil {
+			t.Fatal(err)
+		}
+		buf, err = ioutil.ReadFile(filepath.Join(*targetDir, "atom.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		feed = string(buf)
+		for _, expected := range []string{
+			"<updated>2013-03-01T00:00:00Z</updated>",
+			"<id>http://example.com/blog/2013/02/01/second.html</id>",
+			`<content type="html">&lt;p&gt;third&lt;/p&gt;`,
+		} {
+			if !strings.Contains(feed, expected) {
+				t.Errorf("expected feed to contain %s", expected)
+			}
+		}
+
+		*feedFormat = "jsonfeed"
+		if err := WriteFeeds(s, paths, pages); err != nil {
+			t.Fatal(err)
+		}
+		var jf struct {
+			Version string `json:"version"`
+			Title   string `json:"title"`
+			FeedURL string `json:"feed_url"`
+			Items   []struct {
+				ID            string `json:"id"`
+				URL           string `json:"url"`
+				ContentHTML   string `json:"content_html"`
+				Summary       string `json:"summary"`
+				DatePublished string `json:"date_published"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(Read(filepath.Join(*targetDir, JSONFeedFile)), &jf); err != nil {
+			t.Fatal(err)
+		}
+		if jf.Version != "https://jsonfeed.org/version/1.1" || jf.Title != "T" || jf.FeedURL != "http://example.com/feed.json" {
+			t.Errorf("bad feed: %+v", jf)
+		}
+		if len(jf.Items) != 2 {
+			t.Fatalf("expected the limit of 2 items, got %d", len(jf.Items))
+		}
+		if item := jf.Items[0]; item.ID != "http://example.com/blog/2013/03/01/third.html" || item.URL != item.ID ||
+			item.ContentHTML != "<p>third</p>\n" || item.DatePublished != "2013-03-01T00:00:00Z" {
+			t.Errorf("bad first item: %+v", item)
+		}
+		if jf.Items[1].Summary != "the second" {
+			t.Errorf("second item: expected summary, got %q", jf.Items[1].Summary)
+		}
+
+		*feedFormat = "bogus"
+		if err := WriteFeeds(s, paths, pages); err == nil {
+			t.Errorf("expected error for unknown feed format")
+		}
+	})
+}
+
+func TestFeedBaseURL(t *testing.T) {
+	defer func(b, format string) { *baseURL, *feedFormat = b, format }(*baseURL, *feedFormat)
+	*baseURL, *feedFormat = "https://example.com/blog/", "rss,jsonfeed"
+	files := map[string]string{
+		"_.json":          `{"template":"entry.template","feed":{"title":"T","link":"https://example.com/blog"}}`,
+		"entry.template":  `{{ .content }}`,
+		"2013-01-01-a.md": "a",
+	}
+	withSite(t, files, func() {
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		for file, expected := range map[string]string{
+			"rss.xml":    "<link>https://example.com/blog/2013/01/01/a.html</link>",
+			JSONFeedFile: `"feed_url": "https://example.com/blog/feed.json"`,
+		} {
+			if feed := string(Read(filepath.Join(*targetDir, file))); !strings.Contains(feed, expected) {
+				t.Errorf("%s: expected %s in:\n%s", file, expected, feed)
+			}
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// FingerprintTypes are the extensions of the assets that -fingerprint
+	// renames.
+	FingerprintTypes = map[string]bool{".css": true, ".js": true}
+
+	// Fingerprints maps the source file of every fingerprinted asset to its
+	// target file. FingerprintAssets sets it before every Transform.
+	Fingerprints = map[string]string{}
+)
+
+// FingerprintAssets returns the fingerprinted target file of every CSS and JS
+// asset among paths, by source file, if -fingerprint is set.
+func FingerprintAssets(paths []string) map[string]string {
+	fingerprints := map[string]string{}
+	if !*fingerprint {
+		return fingerprints
+	}
+	for _, path := range paths {
+		if !FingerprintTypes[strings.ToLower(filepath.Ext(path))] {
+			continue
+		}
+		dst := TargetFileFor(path, filepath.Ext(path))
+		fingerprints[path] = FingerprintFile(dst, Minify(dst, Read(path)))
+	}
+	Debugf("%d asset(s) fingerprinted", len(fingerprints))
+	return fingerprints
+}
+
+// FingerprintFile returns filename with a hash of its contents inserted
+// before the extension: style.css becomes style.0123456789.css. The hash
+// only changes when the contents do.
+func FingerprintFile(filename string, contents []byte) string {
+	ext, sum := filepath.Ext(filename), sha256.Sum256(contents)
+	return fmt.Sprintf("%s.%x%s", strings.TrimSuffix(filename, ext), sum[:5], ext)
+}
+
+// FingerprintURL returns the fingerprinted URL of the asset at url, which is
+// either absolute (with or without the -baseurl path), or relative to the URL
+// of the page that refers to it. URLs of anything but fingerprinted assets are
+// returned as they are.
+func FingerprintURL(url, pageURL string, deps *Dependencies) string {
+	p := SitePath(url)
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(path.Dir(SitePath(pageURL)), p)
+	}
+	var source, target string
+	for _, dir := range SourceDirs() {
+		if t, ok := Fingerprints[filepath.Join(dir, filepath.FromSlash(p))]; ok {
+			source, target = filepath.Join(dir, filepath.FromSlash(p)), t
+		}
+	}
+	if source == "" {
+		return url
+	}
+	deps.Read(source) // the page changes when the asset does
+	return path.Join(path.Dir(url), filepath.Base(target))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	files := map[string]string{
+		"css/style.css":  "a { color: red }",
+		"js/app.js":      "var x = 1;",
+		"img/logo.txt":   "logo",
+		"index.html":     `{{ fingerprint "/css/style.css" }} {{ fingerprint "js/app.js" }} {{ fingerprint "/img/logo.txt" }}`,
+		"blog/post.html": `{{ fingerprint "../css/style.css" }}`,
+	}
+	withSite(t, files, func() {
+		defer func(f bool) { *fingerprint = f }(*fingerprint)
+		*fingerprint = true
+
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Fingerprints = FingerprintAssets(paths)
+		defer func() { Fingerprints = map[string]string{} }()
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+
+		style := FingerprintFile("style.css", []byte(files["css/style.css"]))
+		app := FingerprintFile("app.js", []byte(files["js/app.js"]))
+		if style == "style.css" || style != FingerprintFile("style.css", []byte(files["css/style.css"])) {
+			t.Errorf("unstable or missing fingerprint: %s", style)
+		}
+		for name, expected := range map[string]string{
+			"index.html":     "/css/" + style + " js/" + app + " /img/logo.txt",
+			"blog/post.html": "../css/" + style,
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+		for _, name := range []string{"css/" + style, "js/" + app, "img/logo.txt"} {
+			if _, err := os.Stat(filepath.Join(*targetDir, name)); err != nil {
+				t.Errorf("%s: %s", name, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "css", "style.css")); err == nil {
+			t.Errorf("unfingerprinted style.css written")
+		}
+	})
+}
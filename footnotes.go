@@ -0,0 +1,31 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+)
+
+// FootnotesStart opens the block of footnotes that blackfriday renders at the
+// end of the content.
+const FootnotesStart = `<div class="footnotes">`
+
+// SplitFootnotes returns the rendered content without its block of footnotes,
+// and the block, which is empty if there are no footnotes.
+func SplitFootnotes(content template.HTML) (template.HTML, template.HTML) {
+	i := strings.LastIndex(string(content), FootnotesStart)
+	if i < 0 {
+		return content, ""
+	}
+	return content[:i], content[i:]
+}
+
+// SeparateFootnotes returns true if a page with the passed metadata has its
+// footnotes only under "footnotes", and not at the end of its "content": with
+// -footnotes.separate, unless it sets "separatefootnotes" false, or without
+// it, if it sets "separatefootnotes" true.
+func SeparateFootnotes(metadata map[string]interface{}) bool {
+	if v, ok := metadata["separatefootnotes"].(bool); ok {
+		return v
+	}
+	return *sepFootnotes
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFootnotes(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"page.template"}`,
+		"page.template": `{{ .content }}|{{ .footnotes }}`,
+		"notes.md":      "Hi[^1].\n\n[^1]: A note.\n",
+		"apart.md":      "{\"separatefootnotes\":true}\n---\nHi[^1].\n\n[^1]: A note.\n",
+		"plain.md":      "Hi, no notes.\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		for name, expected := range map[string][2]bool{ // footnotes in content, and in footnotes
+			"notes.md": {true, true},
+			"apart.md": {false, true},
+			"plain.md": {false, false},
+		} {
+			buf, _, err := RenderFile(s, filepath.Join(*sourceDir, name), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts := strings.SplitN(string(buf), "|", 2)
+			got := [2]bool{strings.Contains(parts[0], "A note"), strings.Contains(parts[1], "A note")}
+			if got != expected {
+				t.Errorf("%s: expected footnotes in content, footnotes %v, got %v: %q", name, expected, got, buf)
+			}
+			if !strings.Contains(parts[0], "Hi") {
+				t.Errorf("%s: content is missing: %q", name, parts[0])
+			}
+		}
+
+		defer func(f bool) { *sepFootnotes = f }(*sepFootnotes)
+		*sepFootnotes = true
+		buf, _, err := RenderFile(s, filepath.Join(*sourceDir, "notes.md"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content := strings.SplitN(string(buf), "|", 2)[0]; strings.Contains(content, FootnotesStart) {
+			t.Errorf("-footnotes.separate: expected no footnotes in content, got %q", content)
+		}
+	})
+}
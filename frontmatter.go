@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// FrontMatter describes a front matter format: the separator which delimits
+// it from the content of a source file, and the parser for its metadata. An
+// Enclosed format is only recognized between a pair of separators at the very
+// start of the file, so that its separator can appear in the content.
+type FrontMatter struct {
+	Separator []byte
+	Parse     func([]byte) (map[string]interface{}, error)
+	Enclosed  bool
+}
+
+// FrontMatters lists the recognized front matter formats. The separator of the
+// first (JSON or YAML) entry is set by the -front.separator flag.
+var (
+	FrontMatters = []FrontMatter{
+		FrontMatter{Separator: []byte("---\n"), Parse: MaybeFrontMatter},
+		FrontMatter{Separator: []byte("+++\n"), Parse: ParseTOML, Enclosed: true},
+	}
+)
+
+// SetFrontSeparator sets the separator of the JSON and YAML front matter, as a
+// line of its own. It can't be the separator of another format, which would
+// then never be recognized.
+func SetFrontSeparator(sep string) error {
+	if !strings.HasSuffix(sep, "\n") {
+		sep += "\n"
+	}
+	if strings.TrimSpace(sep) == "" {
+		return fmt.Errorf("empty separator")
+	}
+	for _, fm := range FrontMatters[1:] {
+		if sep == string(fm.Separator) {
+			return fmt.Errorf("%q is already the separator of another front matter format", strings.TrimSpace(sep))
+		}
+	}
+	FrontMatters[0].Separator = []byte(sep)
+	return nil
+}
+
+// splitMetadata splits the input buffer on the first front matter separator
+// it contains. It returns a byte-slice suitable for unmarshaling into
+// metadata, if it exists, the remainder of the input buffer, and the
+// FrontMatter whose separator was found.
+//
+// If the buffer opens with a separator (Jekyll-style), the metadata is taken
+// to be everything between that and the next instance of the same separator.
+// Otherwise, the separator of a format that isn't Enclosed may come anywhere.
+// Separators match with Windows (CRLF) line endings, too.
+func splitMetadata(buf []byte) ([]byte, []byte, FrontMatter) {
+	for _, fm := range FrontMatters {
+		for _, sep := range separators(fm.Separator) {
+			if bytes.HasPrefix(buf, sep) {
+				if split := bytes.SplitN(buf[len(sep):], sep, 2); len(split) == 2 {
+					return split[0], split[1], fm
+				}
+			}
+		}
+	}
+
+	index, length, found := -1, 0, FrontMatter{}
+	for _, fm := range FrontMatters {
+		if fm.Enclosed {
+			continue
+		}
+		for _, sep := range separators(fm.Separator) {
+			if i := bytes.Index(buf, sep); i >= 0 && (index < 0 || i < index) {
+				index, length, found = i, len(sep), fm
+			}
+		}
+	}
+	if index < 0 {
+		return []byte{}, buf, FrontMatter{}
+	}
+	return buf[:index], buf[index+length:], found
+}
+
+// separators returns the passed separator, and, if it ends in a newline, its
+// CRLF spelling.
+func separators(sep []byte) [][]byte {
+	if !bytes.HasSuffix(sep, []byte("\n")) || bytes.HasSuffix(sep, []byte("\r\n")) {
+		return [][]byte{sep}
+	}
+	crlf := append(append([]byte{}, sep[:len(sep)-1]...), '\r', '\n')
+	return [][]byte{sep, crlf}
+}
+
+// ParseYAML parses the passed YAML buffer and returns a map. Nested mappings
+// are converted to map[string]interface{}, so they behave like parsed JSON.
+func ParseYAML(buf []byte) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal(buf, &m); err != nil {
+		return map[string]interface{}{}, err
+	}
+	for k, v := range m {
+		m[k] = stringKeys(v)
+	}
+	return m, nil
+}
+
+// stringKeys recursively converts the map[interface{}]interface{} values
+// produced by the YAML decoder into map[string]interface{}.
+func stringKeys(i interface{}) interface{} {
+	switch v := i.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v0 := range v {
+			m[fmt.Sprint(k)] = stringKeys(v0)
+		}
+		return m
+	case []interface{}:
+		for j, v0 := range v {
+			v[j] = stringKeys(v0)
+		}
+		return v
+	}
+	return i
+}
+
+// MaybeFrontMatter parses the passed front matter buffer as JSON if it looks
+// like a JSON object, and as YAML otherwise.
+func MaybeFrontMatter(buf []byte) (map[string]interface{}, error) {
+	trimmed := bytes.TrimSpace(buf)
+	if len(trimmed) <= 0 {
+		return map[string]interface{}{}, nil
+	}
+	if trimmed[0] == '{' {
+		m := map[string]interface{}{}
+		if err := UnmarshalJSON(buf, &m); err != nil {
+			return map[string]interface{}{}, fmt.Errorf("parse JSON: %s", err)
+		}
+		return m, nil
+	}
+	m, err := ParseYAML(buf)
+	if err != nil {
+		return map[string]interface{}{}, fmt.Errorf("parse YAML: %s", err)
+	}
+	return m, nil
+}
+
+// ParseFrontMatter calls MaybeFrontMatter, and warns on error, for callers
+// that would rather have empty metadata than none. GatherSource doesn't: bad
+// front matter is an error there, as a page could lose e.g. its draft flag.
+func ParseFrontMatter(buf []byte) map[string]interface{} {
+	m, err := MaybeFrontMatter(buf)
+	if err != nil {
+		Warningf("front matter: %s", err)
+	}
+	return m
+}
+
+// ParseTOML parses the passed TOML buffer and returns a map.
+func ParseTOML(buf []byte) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if err := toml.Unmarshal(buf, &m); err != nil {
+		return map[string]interface{}{}, fmt.Errorf("parse TOML: %s", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSplitMetadata(t *testing.T) {
+	type tuple struct{ metadata, content string }
+	for buf, expected := range map[string]tuple{
+		"content":                         tuple{"", "content"},
+		"{\"a\":1}\n---\ncontent":         tuple{"{\"a\":1}\n", "content"},
+		"---\na: 1\n---\ncontent":         tuple{"a: 1\n", "content"},
+		"---\nno closing separator":       tuple{"", "no closing separator"},
+		"a: 1\n---\ncontent\n---\nmore\n": tuple{"a: 1\n", "content\n---\nmore\n"},
+		"+++\na = 1\n+++\ncontent":        tuple{"a = 1\n", "content"},
+		"a = 1\n+++\ncontent\n---\n":      tuple{"a = 1\n+++\ncontent\n", ""},
+		"Content.\n+++\nMore content.\n":  tuple{"", "Content.\n+++\nMore content.\n"},
+		"{\"a\":1}\r\n---\r\ncontent\r\n": tuple{"{\"a\":1}\r\n", "content\r\n"},
+		"---\r\na: 1\r\n---\r\ncontent":   tuple{"a: 1\r\n", "content"},
+		"+++\r\na = 1\r\n+++\r\ncontent":  tuple{"a = 1\r\n", "content"},
+	} {
+		metadata, content, _ := splitMetadata([]byte(buf))
+		if got := (tuple{string(metadata), string(content)}); expected != got {
+			t.Errorf("%q: expected %q, got %q", buf, expected, got)
+		}
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	for buf, expected := range map[string]string{
+		`{"title":"JSON"}`:                  `{"title":"JSON"}`,
+		"title: YAML\n":                     `{"title":"YAML"}`,
+		"title: YAML\nauthor:\n  name: A\n": `{"author":{"name":"A"},"title":"YAML"}`,
+		"tags: [a, b]\n":                    `{"tags":["a","b"]}`,
+		`{"broken":`:                        `{}`,
+		"":                                  `{}`,
+	} {
+		got, err := json.Marshal(ParseFrontMatter([]byte(buf)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != string(got) {
+			t.Errorf("%q: expected '%s', got '%s'", buf, expected, string(got))
+		}
+	}
+}
+
+func TestBadFrontMatter(t *testing.T) {
+	for name, contents := range map[string]string{
+		"post.md":   "{\"draft\": true,\n---\nSecret.\n",
+		"page.html": "+++\ndraft = \n+++\nSecret.\n",
+	} {
+		withSite(t, map[string]string{name: contents}, func() {
+			_, _, err := Gather()
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("%s: expected an error naming the file, got %v", name, err)
+			}
+		})
+	}
+}
+
+func TestMaybeFrontMatter(t *testing.T) {
+	for buf, expected := range map[string]string{
+		`{"title":"JSON"}`:                  `{"title":"JSON"}`,
+		"title: YAML\n":                     `{"title":"YAML"}`,
+		"title: YAML\nauthor:\n  name: A\n": `{"author":{"name":"A"},"title":"YAML"}`,
+		"tags: [a, b]\n":                    `{"tags":["a","b"]}`,
+		"":                                  `{}`,
+	} {
+		m, err := MaybeFrontMatter([]byte(buf))
+		if err != nil {
+			t.Fatalf("%q: %s", buf, err)
+		}
+		got, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != string(got) {
+			t.Errorf("%q: expected '%s', got '%s'", buf, expected, string(got))
+		}
+	}
+	if _, err := MaybeFrontMatter([]byte(`{"broken":`)); err == nil {
+		t.Errorf("expected an error for broken JSON")
+	}
+}
+
+func TestCRLFFrontMatter(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "grender-test-crlf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	buf := []byte("---\r\ntitle: CRLF\r\ntags:\r\n  - a\r\n---\r\ncontent\r\n")
+	if err := ioutil.WriteFile(tmpFile.Name(), buf, 0655); err != nil {
+		t.Fatal(err)
+	}
+
+	metadataBuf, contentBuf, frontMatter := splitMetadata(Read(tmpFile.Name()))
+	if expected, got := "content\r\n", string(contentBuf); expected != got {
+		t.Fatalf("content: expected %q, got %q", expected, got)
+	}
+	m, err := frontMatter.Parse(metadataBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"tags":["a"],"title":"CRLF"}`; expected != string(got) {
+		t.Errorf("expected '%s', got '%s'", expected, string(got))
+	}
+}
+
+func TestTOMLFrontMatter(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "grender-test-toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	buf := []byte("+++\ntitle = \"TOML\"\n\n[author]\nname = \"A\"\n\n[author.links]\nhome = \"/a\"\n+++\ncontent\n")
+	if err := ioutil.WriteFile(tmpFile.Name(), buf, 0655); err != nil {
+		t.Fatal(err)
+	}
+
+	metadataBuf, contentBuf, frontMatter := splitMetadata(Read(tmpFile.Name()))
+	if expected, got := "content\n", string(contentBuf); expected != got {
+		t.Fatalf("content: expected %q, got %q", expected, got)
+	}
+	m, err := frontMatter.Parse(metadataBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"author":{"links":{"home":"/a"},"name":"A"},"title":"TOML"}`; expected != string(got) {
+		t.Errorf("expected '%s', got '%s'", expected, string(got))
+	}
+}
+
+func TestSetFrontSeparator(t *testing.T) {
+	defer func(sep []byte) { FrontMatters[0].Separator = sep }(FrontMatters[0].Separator)
+	for _, sep := range []string{"+++", "+++\n", "", "\n"} {
+		if err := SetFrontSeparator(sep); err == nil {
+			t.Errorf("%q: expected error", sep)
+		}
+	}
+	if string(FrontMatters[0].Separator) != "---\n" {
+		t.Errorf("expected a rejected separator to change nothing, got %q", FrontMatters[0].Separator)
+	}
+
+	if err := SetFrontSeparator("..."); err != nil {
+		t.Fatal(err)
+	}
+	metadata, content, fm := splitMetadata([]byte("a: 1\n...\ncontent\n---\n"))
+	if string(metadata) != "a: 1\n" || string(content) != "content\n---\n" || fm.Enclosed {
+		t.Errorf("expected YAML split on ..., got %q, %q", metadata, content)
+	}
+	if metadata, _, fm := splitMetadata([]byte("+++\na = 1\n+++\ncontent\n")); string(metadata) != "a = 1\n" || !fm.Enclosed {
+		t.Errorf("expected TOML still recognized, got %q", metadata)
+	}
+}
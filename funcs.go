@@ -0,0 +1,503 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// HelperFuncs are the template functions that don't depend on the page
+	// being rendered. TemplateFuncs adds them to every template's functions.
+	// Functions that take a string accept any kind of string, including
+	// template.HTML values like .content.
+	HelperFuncs = template.FuncMap{
+		"dateformat": DateFormat,
+		"now":        time.Now,
+		"lower":      func(s interface{}) string { return strings.ToLower(stringValue(s)) },
+		"upper":      func(s interface{}) string { return strings.ToUpper(stringValue(s)) },
+		"title":      func(s interface{}) string { return Title(stringValue(s)) },
+		"trim":       func(s interface{}) string { return strings.TrimSpace(stringValue(s)) },
+		"replace": func(old, new string, s interface{}) string {
+			return strings.Replace(stringValue(s), old, new, -1)
+		},
+		"truncate": func(n int, s interface{}) string { return Truncate(stringValue(s), n) },
+		"slugify":  func(s interface{}) string { return Slugify(stringValue(s)) },
+		"where":    Where,
+		"sort":     Sort,
+		"groupBy":  GroupBy,
+		"first":    First,
+		"last":     Last,
+		"after":    After,
+		"jsonify":  JSONify,
+		"default":  Default,
+		"dict":     Dict,
+		"markdownify": func(s interface{}) template.HTML {
+			return Markdownify([]byte(stringValue(s)), map[string]interface{}{})
+		},
+		"opengraph": OpenGraph,
+		"canonical": Canonical,
+	}
+)
+
+var (
+	// funcScopes are template functions that only some pages get, by scope
+	// name: those whose "funcs" metadata names the scope, e.g. "photos" for
+	// {"photos": {"gallery": Gallery}}. It's for functions compiled into
+	// grender, and empty unless a build adds some; sites scope functions with
+	// FuncScopesKey metadata instead.
+	funcScopes = map[string]template.FuncMap{}
+)
+
+// FuncScopesKey is the metadata key under which a site scopes grender's own
+// template functions, as a scope name: function names object, e.g.
+// {"funcscopes": {"photos": ["resize", "imagesize"]}}.
+const FuncScopesKey = "funcscopes"
+
+// AddScopedFuncs adds the functions of the funcScopes named by the "funcs"
+// metadata, a name or a list of them, to funcMap. Every other scoped function
+// that funcMap doesn't have is added as a stub that fails when it's called,
+// so that templates which use it still parse, but only run for the pages it's
+// meant for. Functions of funcMap listed under FuncScopesKey are scoped the
+// same way: pages outside their scopes get the stub instead.
+func AddScopedFuncs(funcMap template.FuncMap, metadata map[string]interface{}) {
+	scopes, configured := map[string]template.FuncMap{}, map[string]bool{}
+	for scope, funcs := range funcScopes {
+		scopes[scope] = template.FuncMap{}
+		for name, f := range funcs {
+			scopes[scope][name] = f
+		}
+	}
+	m, _ := metadata[FuncScopesKey].(map[string]interface{})
+	for scope, names := range m {
+		for _, name := range Terms(names) {
+			f, ok := funcMap[name]
+			if !ok {
+				Debugf("%s: no template function '%s' to scope to '%s'", FuncScopesKey, name, scope)
+				continue
+			}
+			if scopes[scope] == nil {
+				scopes[scope] = template.FuncMap{}
+			}
+			scopes[scope][name], configured[name] = f, true
+		}
+	}
+
+	names := []string{}
+	for name := range scopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	selected := map[string]bool{}
+	for _, name := range Terms(metadata["funcs"]) {
+		if _, ok := scopes[name]; !ok {
+			Debugf("no template function scope '%s'", name)
+		}
+		selected[name] = true
+	}
+
+	for name := range configured {
+		for _, scope := range names {
+			if _, ok := scopes[scope][name]; ok && !selected[scope] {
+				funcMap[name] = scopeStub(name, scope)
+			}
+		}
+	}
+	for _, scope := range names {
+		for name, f := range scopes[scope] {
+			if selected[scope] {
+				funcMap[name] = f
+			} else if _, ok := funcMap[name]; !ok {
+				funcMap[name] = scopeStub(name, scope)
+			}
+		}
+	}
+}
+
+func scopeStub(name, scope string) func(...interface{}) (interface{}, error) {
+	return func(...interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("%s is only for pages with \"funcs\": \"%s\"", name, scope)
+	}
+}
+
+// DateFormat formats the date with the Go time layout. The date may be a
+// time.Time, or a string in any of the DateLayouts, like the "2013 03 04" of
+// a blog entry's default date.
+func DateFormat(layout string, date interface{}) (string, error) {
+	t, ok := ParseDate(date)
+	if !ok {
+		return "", fmt.Errorf("dateformat: can't parse date %v", date)
+	}
+	return t.Format(layout), nil
+}
+
+// Title returns s with the first letter of every word in upper case.
+func Title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) || prev == '-' {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// Truncate returns s cut down to at most n characters, ending in an
+// ellipsis if anything was cut.
+func Truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	return strings.TrimRightFunc(string(runes[:n-1]), unicode.IsSpace) + "…"
+}
+
+// Where returns the elements of the collection whose value under the dotted
+// key path matches value, according to the operator:
+//
+//	eq      equal to value
+//	ne      not equal to value
+//	in      equal to any element of value, which must be a list; or, for a
+//	        list itself, having any element in common with it
+//	prefix  a string starting with value
+//
+// The collection may be a list, or a map, whose values are taken in the order
+// of sorted. Elements without the key never match.
+func Where(collection interface{}, key, op string, value interface{}) ([]interface{}, error) {
+	elements, err := Elements(collection)
+	if err != nil {
+		return nil, fmt.Errorf("where: %s", err)
+	}
+
+	var match func(interface{}) bool
+	switch op {
+	case "eq":
+		match = func(v interface{}) bool { return looseEqual(v, value) }
+	case "ne":
+		match = func(v interface{}) bool { return !looseEqual(v, value) }
+	case "in":
+		candidates, err := Elements(value)
+		if err != nil {
+			return nil, fmt.Errorf("where: in: %s", err)
+		}
+		match = func(v interface{}) bool {
+			values, err := Elements(v)
+			if err != nil {
+				values = []interface{}{v}
+			}
+			for _, v := range values {
+				for _, candidate := range candidates {
+					if looseEqual(v, candidate) {
+						return true
+					}
+				}
+			}
+			return false
+		}
+	case "prefix":
+		prefix := stringValue(value)
+		match = func(v interface{}) bool {
+			s := reflect.ValueOf(v)
+			return s.Kind() == reflect.String && strings.HasPrefix(s.String(), prefix)
+		}
+	default:
+		return nil, fmt.Errorf("where: unknown operator '%s'", op)
+	}
+
+	matches := []interface{}{}
+	for _, element := range elements {
+		if v, ok := lookupKey(element, key); ok && match(v) {
+			matches = append(matches, element)
+		}
+	}
+	return matches, nil
+}
+
+// Elements returns the elements of a list, or the values of a map in the
+// order of sorted.
+func Elements(collection interface{}) ([]interface{}, error) {
+	if m, ok := collection.(map[string]interface{}); ok {
+		return SortedValues(m), nil
+	}
+	v := reflect.ValueOf(collection)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		elements := make([]interface{}, v.Len())
+		for i := range elements {
+			elements[i] = v.Index(i).Interface()
+		}
+		return elements, nil
+	}
+	return nil, fmt.Errorf("%T isn't a list or map", collection)
+}
+
+// lookupKey returns the value under the dotted key path, e.g. "author.name",
+// in the metadata i.
+func lookupKey(i interface{}, key string) (interface{}, bool) {
+	for _, k := range strings.Split(key, ".") {
+		m, ok := i.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if i, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return i, true
+}
+
+// looseEqual compares metadata values, treating every kind of string as a
+// string, and every kind of number as a number, wherever they came from.
+func looseEqual(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.String && vb.Kind() == reflect.String {
+		return va.String() == vb.String()
+	}
+	if fa, ok := floatValue(a); ok {
+		fb, ok := floatValue(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// floatValue returns i as a float64, if it's any kind of number.
+func floatValue(i interface{}) (float64, bool) {
+	v := reflect.ValueOf(i)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// Sort returns the elements of the collection (see Elements) sorted by their
+// value under the dotted key path, in "asc" or "desc" order. Values compare
+// as dates if they're both dates (see ParseDate), as numbers if they're both
+// numbers, and as strings otherwise. Elements without the key come last.
+func Sort(key, order string, collection interface{}) ([]interface{}, error) {
+	elements, err := Elements(collection)
+	if err != nil {
+		return nil, fmt.Errorf("sort: %s", err)
+	}
+	var desc bool
+	switch order {
+	case "asc":
+	case "desc":
+		desc = true
+	default:
+		return nil, fmt.Errorf("sort: unknown order '%s'", order)
+	}
+
+	sorted := make([]interface{}, len(elements))
+	copy(sorted, elements)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		vi, iok := lookupKey(sorted[i], key)
+		vj, jok := lookupKey(sorted[j], key)
+		if !iok || !jok {
+			return iok && !jok
+		}
+		if desc {
+			return compare(vj, vi) < 0
+		}
+		return compare(vi, vj) < 0
+	})
+	return sorted, nil
+}
+
+// compare returns a negative number if a sorts before b, a positive number
+// if it sorts after, and zero otherwise.
+func compare(a, b interface{}) int {
+	if ta, ok := ParseDate(a); ok {
+		if tb, ok := ParseDate(b); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+	if fa, ok := floatValue(a); ok {
+		if fb, ok := floatValue(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// Group is a set of pages sharing the same value under a key.
+type Group struct {
+	Key   string
+	Pages []interface{}
+}
+
+// GroupBy groups the elements of the collection (see Elements) by their value
+// under the dotted key path. Following the key path with a colon and a Go
+// time layout groups by that part of a date: "date:2006" groups by year. The
+// groups are ordered by their values, "asc" or "desc", as Sort orders pages;
+// within a group, pages keep the order of the collection. Elements without
+// the key are left out.
+func GroupBy(key, order string, collection interface{}) ([]Group, error) {
+	elements, err := Elements(collection)
+	if err != nil {
+		return nil, fmt.Errorf("groupBy: %s", err)
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("groupBy: unknown order '%s'", order)
+	}
+	layout := ""
+	if i := strings.Index(key, ":"); i >= 0 {
+		key, layout = key[:i], key[i+1:]
+	}
+
+	groups := []Group{}
+	values := []interface{}{} // of the first page in each group
+	index := map[string]int{} // group key: index in groups
+	for _, element := range elements {
+		v, ok := lookupKey(element, key)
+		if !ok {
+			continue
+		}
+		groupKey := fmt.Sprint(v)
+		if layout != "" {
+			t, ok := ParseDate(v)
+			if !ok {
+				continue
+			}
+			groupKey = t.Format(layout)
+		}
+		i, ok := index[groupKey]
+		if !ok {
+			i = len(groups)
+			index[groupKey] = i
+			groups = append(groups, Group{Key: groupKey})
+			values = append(values, v)
+		}
+		groups[i].Pages = append(groups[i].Pages, element)
+	}
+
+	sort.Stable(byGroupValue{groups, values, order == "desc"})
+	return groups, nil
+}
+
+// byGroupValue sorts groups along with the values they're ordered by.
+type byGroupValue struct {
+	groups []Group
+	values []interface{}
+	desc   bool
+}
+
+func (a byGroupValue) Len() int { return len(a.groups) }
+func (a byGroupValue) Swap(i, j int) {
+	a.groups[i], a.groups[j] = a.groups[j], a.groups[i]
+	a.values[i], a.values[j] = a.values[j], a.values[i]
+}
+func (a byGroupValue) Less(i, j int) bool {
+	if a.desc {
+		return compare(a.values[j], a.values[i]) < 0
+	}
+	return compare(a.values[i], a.values[j]) < 0
+}
+
+// First returns the first n elements of the collection (see Elements), or
+// all of them if there are fewer.
+func First(n int, collection interface{}) ([]interface{}, error) {
+	elements, err := Elements(collection)
+	if err != nil {
+		return nil, fmt.Errorf("first: %s", err)
+	}
+	return elements[:clamp(n, len(elements))], nil
+}
+
+// Last returns the last n elements of the collection (see Elements), or all
+// of them if there are fewer.
+func Last(n int, collection interface{}) ([]interface{}, error) {
+	elements, err := Elements(collection)
+	if err != nil {
+		return nil, fmt.Errorf("last: %s", err)
+	}
+	return elements[len(elements)-clamp(n, len(elements)):], nil
+}
+
+// After returns the elements of the collection (see Elements) after the
+// first n, or none if there aren't more than n.
+func After(n int, collection interface{}) ([]interface{}, error) {
+	elements, err := Elements(collection)
+	if err != nil {
+		return nil, fmt.Errorf("after: %s", err)
+	}
+	return elements[clamp(n, len(elements)):], nil
+}
+
+// clamp returns n, limited to between 0 and max.
+func clamp(n, max int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// JSONify returns the value as JSON, for use in scripts. Characters with a
+// meaning in HTML are escaped, so the JSON can't close the script element.
+func JSONify(v interface{}) (template.JS, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("jsonify: %s", err)
+	}
+	return template.JS(buf), nil
+}
+
+// Default returns v, unless it's missing: nil, an empty string, or an empty
+// list or map. Then it returns def.
+func Default(def, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		if rv.Len() <= 0 {
+			return def
+		}
+	}
+	return v
+}
+
+// Dict returns a map of the passed keys and values, which alternate.
+func Dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+	m := map[string]interface{}{}
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v isn't a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHelperFuncs(t *testing.T) {
+	metadata := map[string]interface{}{
+		"date":    "2013 03 04",
+		"title":   "  Hello, big World  ",
+		"content": template.HTML("<p>Some content</p>"),
+	}
+	for input, expected := range map[string]string{
+		`{{ .date | dateformat "Jan 2, 2006" }}`:      "Mar 4, 2013",
+		`{{ dateformat "2006" "2013-05-06" }}`:        "2013",
+		`{{ .title | trim | lower }}`:                 "hello, big world",
+		`{{ .title | trim | upper }}`:                 "HELLO, BIG WORLD",
+		`{{ title "one two-three" }}`:                 "One Two-Three",
+		`{{ .title | trim | replace "big" "small" }}`: "Hello, small World",
+		`{{ .title | trim | truncate 8 }}`:            "Hello,…",
+		`{{ truncate 20 "short" }}`:                   "short",
+		`{{ .title | slugify }}`:                      "hello-big-world",
+		`{{ .content | lower }}`:                      "&lt;p&gt;some content&lt;/p&gt;",
+	} {
+		tmpl, err := template.New("test").Funcs(HelperFuncs).Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, metadata); err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+		if got := buf.String(); expected != got {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+	}
+
+	if _, err := DateFormat("2006", "someday"); err == nil {
+		t.Errorf("expected error for unparseable date")
+	}
+	if got := HelperFuncs["now"].(func() time.Time)(); time.Since(got) > time.Minute {
+		t.Errorf("now: got %s", got)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	files := map[string]interface{}{
+		"a": map[string]interface{}{"sortkey": "1", "url": "/blog/a.html", "featured": true, "n": 1.0, "tags": []interface{}{"go", "web"}},
+		"b": map[string]interface{}{"sortkey": "2", "url": "/blog/b.html", "featured": false, "n": 2.0, "author": map[string]interface{}{"name": "Pat"}},
+		"c": map[string]interface{}{"sortkey": "3", "url": "/about.html", "n": 3.0, "tags": []interface{}{"web"}},
+		"d": "not a page",
+	}
+	urls := func(elements []interface{}) string {
+		s := []string{}
+		for _, e := range elements {
+			s = append(s, stringValue(e.(map[string]interface{})["url"]))
+		}
+		return strings.Join(s, " ")
+	}
+	for _, c := range []struct {
+		key, op  string
+		value    interface{}
+		expected string
+	}{
+		{"featured", "eq", true, "/blog/a.html"},
+		{"featured", "ne", true, "/blog/b.html"},
+		{"n", "eq", 2, "/blog/b.html"},
+		{"n", "in", []interface{}{1, 3}, "/about.html /blog/a.html"},
+		{"tags", "in", []string{"go"}, "/blog/a.html"},
+		{"url", "prefix", "/blog", "/blog/b.html /blog/a.html"},
+		{"author.name", "eq", "Pat", "/blog/b.html"},
+		{"missing", "ne", "x", ""},
+	} {
+		got, err := Where(files, c.key, c.op, c.value)
+		if err != nil {
+			t.Errorf("%s %s %v: %s", c.key, c.op, c.value, err)
+			continue
+		}
+		if urls(got) != c.expected {
+			t.Errorf("%s %s %v: expected %q, got %q", c.key, c.op, c.value, c.expected, urls(got))
+		}
+	}
+
+	if _, err := Where(files, "n", "lt", 2); err == nil {
+		t.Errorf("expected error for unknown operator")
+	}
+	if _, err := Where(42, "n", "eq", 2); err == nil {
+		t.Errorf("expected error for non-collection")
+	}
+}
+
+func TestSort(t *testing.T) {
+	pages := []interface{}{
+		map[string]interface{}{"title": "b", "date": "2013 03 04", "n": 10.0},
+		map[string]interface{}{"title": "c", "date": "2012-12-31", "n": 9},
+		map[string]interface{}{"title": "a", "date": "2013 11 01"},
+		map[string]interface{}{"date": "2013 01 01", "n": 100.0},
+	}
+	titles := func(elements []interface{}) string {
+		s := []string{}
+		for _, e := range elements {
+			s = append(s, stringValue(e.(map[string]interface{})["title"]))
+		}
+		return strings.Join(s, ",")
+	}
+	for _, c := range []struct{ key, order, expected string }{
+		{"date", "desc", "a,b,,c"},
+		{"date", "asc", "c,,b,a"},
+		{"n", "asc", "c,b,,a"},
+		{"n", "desc", ",b,c,a"},
+		{"title", "asc", "a,b,c,"},
+	} {
+		got, err := Sort(c.key, c.order, pages)
+		if err != nil {
+			t.Errorf("%s %s: %s", c.key, c.order, err)
+			continue
+		}
+		if titles(got) != c.expected {
+			t.Errorf("%s %s: expected %q, got %q", c.key, c.order, c.expected, titles(got))
+		}
+	}
+	if _, err := Sort("date", "up", pages); err == nil {
+		t.Errorf("expected error for unknown order")
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	pages := []interface{}{
+		map[string]interface{}{"title": "a", "date": "2013 11 01", "author": "Kim"},
+		map[string]interface{}{"title": "b", "date": "2013 03 04", "author": "Pat"},
+		map[string]interface{}{"title": "c", "date": "2012-12-31", "author": "Kim"},
+		map[string]interface{}{"title": "d"},
+	}
+	summary := func(groups []Group) string {
+		s := []string{}
+		for _, g := range groups {
+			titles := []string{}
+			for _, p := range g.Pages {
+				titles = append(titles, stringValue(p.(map[string]interface{})["title"]))
+			}
+			s = append(s, g.Key+":"+strings.Join(titles, ","))
+		}
+		return strings.Join(s, " ")
+	}
+	for _, c := range []struct{ key, order, expected string }{
+		{"date:2006", "desc", "2013:a,b 2012:c"},
+		{"date:2006", "asc", "2012:c 2013:a,b"},
+		{"date:January 2006", "desc", "November 2013:a March 2013:b December 2012:c"},
+		{"author", "asc", "Kim:a,c Pat:b"},
+	} {
+		got, err := GroupBy(c.key, c.order, pages)
+		if err != nil {
+			t.Errorf("%s %s: %s", c.key, c.order, err)
+			continue
+		}
+		if summary(got) != c.expected {
+			t.Errorf("%s %s: expected %q, got %q", c.key, c.order, c.expected, summary(got))
+		}
+	}
+}
+
+func TestFirstLastAfter(t *testing.T) {
+	list := []interface{}{1, 2, 3}
+	for _, c := range []struct {
+		f        func(int, interface{}) ([]interface{}, error)
+		n        int
+		expected string
+	}{
+		{First, 2, "[1 2]"},
+		{First, 5, "[1 2 3]"},
+		{First, 0, "[]"},
+		{First, -1, "[]"},
+		{Last, 2, "[2 3]"},
+		{Last, 5, "[1 2 3]"},
+		{Last, 0, "[]"},
+		{After, 1, "[2 3]"},
+		{After, 5, "[]"},
+		{After, 0, "[1 2 3]"},
+	} {
+		got, err := c.f(c.n, list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprint(got); s != c.expected {
+			t.Errorf("%d: expected %s, got %s", c.n, c.expected, s)
+		}
+	}
+	if _, err := First(1, "nope"); err == nil {
+		t.Errorf("expected error for non-collection")
+	}
+}
+
+func TestJSONify(t *testing.T) {
+	tmpl := template.Must(template.New("test").Funcs(HelperFuncs).Parse(`<script>var data = {{ jsonify . }};</script>`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]interface{}{"title": "</script>", "n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := `<script>var data = {"n":1,"title":"\u003c/script\u003e"};</script>`, buf.String(); expected != got {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	buf.Reset()
+	if err := tmpl.Execute(&buf, map[string]interface{}{"f": func() {}}); err == nil {
+		t.Errorf("expected error for unmarshalable value")
+	}
+}
+
+func TestDefaultAndDict(t *testing.T) {
+	metadata := map[string]interface{}{
+		"title": "Title",
+		"empty": "",
+		"none":  []interface{}{},
+		"zero":  0.0,
+	}
+	for input, expected := range map[string]string{
+		`{{ .title | default "Untitled" }}`:                 "Title",
+		`{{ .missing | default "Untitled" }}`:               "Untitled",
+		`{{ .empty | default "Untitled" }}`:                 "Untitled",
+		`{{ .none | default "Untitled" }}`:                  "Untitled",
+		`{{ .zero | default 1 }}`:                           "0",
+		`{{ with dict "a" 1 "b" .title }}{{ .b }}{{ end }}`: "Title",
+	} {
+		tmpl, err := template.New("test").Funcs(HelperFuncs).Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, metadata); err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+		if got := buf.String(); expected != got {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+	}
+
+	if _, err := Dict("a"); err == nil {
+		t.Errorf("expected error for odd arguments")
+	}
+	if _, err := Dict(1, 2); err == nil {
+		t.Errorf("expected error for non-string key")
+	}
+}
+
+func TestScopedFuncs(t *testing.T) {
+	defer func(scopes map[string]template.FuncMap) { funcScopes = scopes }(funcScopes)
+	funcScopes = map[string]template.FuncMap{
+		"photos": {"gallery": func(n int) string { return strings.Repeat("[]", n) }},
+		"shouty": {"upper": func(s string) string { return "!" + s }},
+	}
+
+	files := map[string]string{
+		"photos/_.json": `{"funcs":"photos"}`,
+		"photos/a.html": `{{ gallery 2 }} {{ upper "x" }}`,
+		"both.html":     "{\"funcs\":[\"photos\",\"shouty\"]}\n---\n{{ gallery 1 }} {{ upper \"x\" }}",
+		"plain.html":    `{{ upper "x" }}`,
+		"typo.html":     `{{ gallery 1 }}`,
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		for name, expected := range map[string]string{
+			"photos/a.html": "[][] X",
+			"both.html":     "[] !x",
+			"plain.html":    "X",
+		} {
+			buf, _, err := RenderFile(s, filepath.Join(*sourceDir, name), nil)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+		_, _, err := RenderFile(s, filepath.Join(*sourceDir, "typo.html"), nil)
+		if err == nil || !strings.Contains(err.Error(), `gallery is only for pages with "funcs": "photos"`) {
+			t.Errorf("expected an error for gallery outside photos, got %v", err)
+		}
+	})
+}
+
+func TestConfiguredFuncScopes(t *testing.T) {
+	files := map[string]string{
+		"_.json":      `{"funcscopes":{"docs":["markdownify","nosuchfunc"],"shouty":["upper"]}}`,
+		"docs/_.json": `{"funcs":"docs"}`,
+		"docs/a.html": `{{ markdownify "*x*" }}`,
+		"both.html":   "{\"funcs\":[\"docs\",\"shouty\"]}\n---\n{{ markdownify \"*x*\" }} {{ upper \"y\" }}",
+		"other.html":  `{{ lower "Y" }}`,
+	}
+	withSite(t, files, func() {
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range map[string]string{
+			"docs/a.html": "<p><em>x</em></p>\n",
+			"both.html":   "<p><em>x</em></p>\n Y",
+			"other.html":  "y",
+		} {
+			if got := string(Read(filepath.Join(*targetDir, name))); expected != got {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+
+		Write(filepath.Join(*sourceDir, "docs", "upper.html"), []byte(`{{ upper "y" }}`))
+		if err := Build(); err == nil {
+			t.Errorf("expected upper outside shouty to fail the build")
+		}
+		os.Remove(filepath.Join(*sourceDir, "docs", "upper.html"))
+		Write(filepath.Join(*sourceDir, "typo.html"), []byte(`{{ markdownify "*x*" }}`))
+		if err := Build(); err == nil {
+			t.Errorf("expected markdownify outside docs to fail the build")
+		}
+		s := gather(t)
+		_, _, err := RenderFile(s, filepath.Join(*sourceDir, "typo.html"), nil)
+		if err == nil || !strings.Contains(err.Error(), `markdownify is only for pages with "funcs": "docs"`) {
+			t.Errorf("expected an error for markdownify outside docs, got %v", err)
+		}
+	})
+}
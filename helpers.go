@@ -1,15 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"html"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/peterbourgon/mergemap"
 )
@@ -23,14 +32,68 @@ func Read(filename string) []byte {
 	return buf
 }
 
-// Write writes the buffer to the target file.
+var (
+	writeMtx sync.Mutex
+	removed  []string            // by Clean, with -dry-run
+	written  = map[string]bool{} // by Write, since the build began
+)
+
+// Write writes the buffer to the target file. Writes are serialized, so that
+// concurrent transformations that target the same file don't interleave.
+// With -dry-run, Write only logs what it would do.
 func Write(tgt string, buf []byte) {
+	writeMtx.Lock()
+	defer writeMtx.Unlock()
+
+	written[tgt] = true
+	if *dryRun {
+		logDryRun(tgt, int64(len(buf)))
+		return
+	}
 	os.MkdirAll(filepath.Dir(tgt), 0777)
 	if err := ioutil.WriteFile(tgt, buf, 0755); err != nil {
 		Fatalf("must write: %s: %s", tgt, err)
 	}
 }
 
+// logDryRun logs what writing size bytes to tgt would do, for -dry-run.
+func logDryRun(tgt string, size int64) {
+	action := "create"
+	if _, err := os.Stat(tgt); err == nil && !wasRemoved(tgt) {
+		action = "overwrite"
+	}
+	Infof("dry run: %s %s (%d byte(s))", action, tgt, size)
+}
+
+// wasWritten returns true if Write wrote path since the build began.
+func wasWritten(path string) bool {
+	writeMtx.Lock()
+	defer writeMtx.Unlock()
+	return written[path]
+}
+
+// Written returns every file Write wrote since the build began.
+func Written() []string {
+	writeMtx.Lock()
+	defer writeMtx.Unlock()
+	files := []string{}
+	for path := range written {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// wasRemoved returns true if Clean would have removed path, with -dry-run.
+func wasRemoved(path string) bool {
+	for _, r := range removed {
+		if path == r || strings.HasPrefix(path, r+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 // Relative gives the relative path from base for complete. complete must have
 // base as a prefix.
 func Relative(base, complete string) string {
@@ -47,31 +110,227 @@ func Relative(base, complete string) string {
 	return rel
 }
 
-// Copy copies src to dst.
+// Clean removes the contents of the target directory. It refuses to clean a
+// filesystem root, or a directory that is, or contains, the source directory.
+// With -dry-run, Clean only logs what it would remove.
+func Clean(dir string) error {
+	if dir == filepath.Dir(dir) {
+		return fmt.Errorf("refusing to clean %s: filesystem root", dir)
+	}
+	for _, source := range SourceDirs() {
+		if rel, err := filepath.Rel(dir, source); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("refusing to clean %s: contains source directory %s", dir, source)
+		}
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		path := filepath.Join(dir, info.Name())
+		if *dryRun {
+			Infof("dry run: delete %s", path)
+			writeMtx.Lock()
+			removed = append(removed, path)
+			writeMtx.Unlock()
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		Debugf("%s removed", path)
+	}
+	return nil
+}
+
+// Copy copies src to dst, with the same permissions, so that executables stay
+// executable. Symlinks are followed: dst is a regular file with the contents
+// and mode of the file src points to. The contents are streamed, rather than
+// read into memory, so large assets cost no more than small ones. Copies run
+// concurrently: each streams into a temporary file next to dst, which then
+// replaces dst, so that copies to the same file don't interleave. Like Write,
+// Copy only logs with -dry-run.
 func Copy(dst, src string) {
-	Write(dst, Read(src))
+	info, err := os.Stat(src)
+	if err != nil {
+		Fatalf("must copy: %s: %s", src, err)
+	}
+
+	writeMtx.Lock()
+	written[dst] = true
+	if *dryRun {
+		logDryRun(dst, info.Size())
+		writeMtx.Unlock()
+		return
+	}
+	writeMtx.Unlock()
+
+	os.MkdirAll(filepath.Dir(dst), 0777)
+	if err := copyFile(dst, src, info.Mode().Perm()); err != nil {
+		Fatalf("must copy: %s", err)
+	}
+}
+
+// copyFile streams src into a temporary file in the directory of dst, with
+// the given permissions, and renames it to dst.
+func copyFile(dst, src string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name()) // unless renamed
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %s", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("%s: %s", dst, err)
+	}
+	if err := os.Chmod(out.Name(), perm); err != nil {
+		return fmt.Errorf("%s: %s", dst, err)
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+// HashFile returns the SHA-256 hash of the contents of filename, which are
+// streamed through it rather than read into memory.
+func HashFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
 }
 
 // ParseJSON parses the passed JSON buffer and returns a map.
 func ParseJSON(buf []byte) map[string]interface{} {
 	m := map[string]interface{}{}
-	if err := json.Unmarshal(buf, &m); err != nil {
+	if err := UnmarshalJSON(buf, &m); err != nil {
 		Fatalf("parse JSON: %s", err)
 	}
 	return m
 }
 
+// Unpublished returns true if the page with the passed metadata shouldn't be
+// rendered, or listed under the Global Key: that is, if it's a draft, and
+// drafts weren't requested with -drafts, or if its date is in the future, and
+// future pages weren't requested with -future.
+func Unpublished(metadata map[string]interface{}) bool {
+	if draft, _ := metadata["draft"].(bool); draft && !*drafts {
+		return true
+	}
+	if date, ok := ParseDate(metadata["date"]); ok && date.After(time.Now()) && !*future {
+		return true
+	}
+	return false
+}
+
+// BasePath returns the path of the -baseurl, without a trailing slash, which
+// every URL of the site is under: "/blog" for "https://example.com/blog/".
+// It's empty for a site at the root of its host.
+func BasePath() string {
+	u, err := url.Parse(*baseURL)
+	if err != nil {
+		Fatalf("-baseurl: %s", err)
+	}
+	p := strings.TrimRight(u.Path, "/")
+	if p != "" && !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// URLFor returns the URL of the given target file.
+func URLFor(target string) string {
+	return BasePath() + "/" + Relative(*targetDir, target)
+}
+
+// IsIndex returns true if the file at path, less its extension, is one of the
+// -index.names, or a section index: a page that stands for its directory,
+// rather than a leaf in it.
+func IsIndex(path string) bool {
+	if IsSection(path) {
+		return true
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, index := range strings.Split(*indexNames, ",") {
+		if index = strings.TrimSpace(index); index != "" && name == index {
+			return true
+		}
+	}
+	return false
+}
+
+// PageFile returns the file an HTML page with the given target is written to.
+// An index page (see IsIndex) is its directory's index.html; a leaf page is
+// name.html, or name/index.html with -pretty-urls. Other files are unchanged.
+func PageFile(target string) string {
+	switch {
+	case filepath.Ext(target) != ".html":
+		return target
+	case IsIndex(target):
+		return filepath.Join(filepath.Dir(target), "index.html")
+	case *prettyURLs:
+		name := strings.TrimSuffix(filepath.Base(target), ".html")
+		return filepath.Join(filepath.Dir(target), name, "index.html")
+	}
+	return target
+}
+
+// PageURL returns the URL of the given page target file, which with
+// -pretty-urls is its directory for an index.html.
+func PageURL(target string) string {
+	url := URLFor(target)
+	if *prettyURLs && filepath.Base(target) == "index.html" {
+		url = strings.TrimSuffix(url, "index.html")
+	}
+	return url
+}
+
+// SitePath returns the path of the URL u within the site, that is, without
+// the BasePath.
+func SitePath(u string) string {
+	if base := BasePath(); base != "" && (u == base || strings.HasPrefix(u, base+"/")) {
+		return "/" + strings.TrimPrefix(strings.TrimPrefix(u, base), "/")
+	}
+	return u
+}
+
 // TargetFileFor returns the target filename for the given source filename.
 func TargetFileFor(sourceFilename, targetExt string) string {
-	relativePath := Relative(*sourceDir, sourceFilename)
+	relativePath := SourceRelative(sourceFilename)
 	dst := filepath.Clean(filepath.Join(*targetDir, relativePath))
 	n := len(dst) - len(filepath.Ext(dst))
 	return dst[:n] + targetExt
 }
 
+// SourceFileFor returns the file that name refers to from the template at
+// path: relative to its directory, or to the source directory with a leading
+// slash, from the last source directory that has it, as with SourceFile.
+func SourceFileFor(path, name string) string {
+	if strings.HasPrefix(name, "/") {
+		return SourceFile(filepath.Join(*sourceDir, filepath.FromSlash(name)))
+	}
+	return SourceFile(filepath.Join(filepath.Dir(path), filepath.FromSlash(name)))
+}
+
 // MaybeTemplate returns the contents of the template file specified under the
 // "template" key for the metadata in the stack identified by the given path.
-// In human words, it means "get me the template for this file".
+// In human words, it means "get me the template for this file". A template in
+// a later source directory overrides the one next to the file.
 func MaybeTemplate(s StackReader, path string) (string, []byte, error) {
 	templateInterface, ok := s.Get(path)["template"]
 	if !ok {
@@ -81,7 +340,10 @@ func MaybeTemplate(s StackReader, path string) (string, []byte, error) {
 	if !ok {
 		return "", []byte{}, fmt.Errorf("%s: bad type for template key", path)
 	}
-	templateFilename := filepath.Join(filepath.Dir(path), templateStr) // rel
+	templateFilename := SourceFile(filepath.Join(filepath.Dir(path), templateStr)) // rel
+	if _, err := os.Stat(templateFilename); os.IsNotExist(err) {
+		return "", []byte{}, fmt.Errorf("%s: template %s doesn't exist", path, templateStr)
+	}
 	return templateFilename, Read(templateFilename), nil
 }
 
@@ -112,60 +374,106 @@ func SplitPath(path string) []string {
 }
 
 var (
-	BlogEntryRegexp = regexp.MustCompile(`^([0-9]+)-([0-9]+)-([0-9]+)-(.*)\.[^\.]*$`)
+	tagRegexp = regexp.MustCompile(`<[^>]*>`)
 )
 
-type BlogTuple struct {
-	Year     int
-	Month    int
-	Day      int
-	Title    string
-	Filename string
+// StripHTML returns the text of the passed HTML: without tags, and with
+// entities unescaped.
+func StripHTML(s string) string {
+	return html.UnescapeString(tagRegexp.ReplaceAllString(s, " "))
 }
 
-func NewBlogTuple(path, targetExt string) (BlogTuple, bool) {
-	path = filepath.Base(path)
-	m := BlogEntryRegexp.FindAllStringSubmatch(path, -1)
+// IsBinary returns true if buf isn't text: if it has a NUL byte, or isn't
+// valid UTF-8. Such files can't be parsed as templates.
+func IsBinary(buf []byte) bool {
+	return bytes.IndexByte(buf, 0) >= 0 || !utf8.Valid(buf)
+}
 
-	if len(m) <= 0 {
-		Debugf("Blog Tuple: %s: failed to parse stage 0", path)
-		return BlogTuple{}, false
-	}
+// PlainText returns the text of the passed HTML, as StripHTML, with runs of
+// whitespace collapsed into single spaces.
+func PlainText(s string) string {
+	return strings.Join(strings.Fields(StripHTML(s)), " ")
+}
 
-	if len(m[0]) < 5 {
-		Debugf("Blog Tuple: %s: failed to parse stage 1", path)
-		return BlogTuple{}, false
+// slugLetters transliterates accented letters, and others outside ASCII
+// with a common spelling in it, for Slugify.
+var slugLetters = func() map[rune]string {
+	m := map[rune]string{}
+	for ascii, letters := range map[string]string{
+		"a": "àáâãäåāăą", "ae": "æ", "c": "çćĉċč", "d": "ďđð",
+		"e": "èéêëēĕėęě", "g": "ĝğġģ", "h": "ĥħ", "i": "ìíîïĩīĭįı",
+		"ij": "ĳ", "j": "ĵ", "k": "ķ", "l": "ĺļľŀł", "n": "ñńņňŉ",
+		"o": "òóôõöøōŏő", "oe": "œ", "r": "ŕŗř", "s": "śŝşšș",
+		"ss": "ß", "t": "ţťŧț", "th": "þ", "u": "ùúûüũūŭůűų",
+		"w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+	} {
+		for _, r := range letters {
+			m[r] = ascii
+		}
 	}
-
-	if len(m[0][1]) <= 0 || len(m[0][2]) <= 0 || len(m[0][3]) <= 0 {
-		Debugf("Blog Tuple: %s: failed to parse stage 2", path)
-		return BlogTuple{}, false
+	return m
+}()
+
+// Slugify turns the passed string into something suitable for a URL path
+// segment: lowercase, with accented letters transliterated, punctuation and
+// symbols (like emoji) stripped, and every run of whitespace, hyphens and
+// underscores replaced by a single hyphen. Letters of other scripts are kept.
+func Slugify(s string) string {
+	var buf strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		switch ascii, ok := slugLetters[r]; {
+		case ok || unicode.IsLetter(r) || unicode.IsDigit(r):
+			if hyphen && buf.Len() > 0 {
+				buf.WriteByte('-')
+			}
+			hyphen = false
+			if ok {
+				buf.WriteString(ascii)
+			} else {
+				buf.WriteRune(r)
+			}
+		case unicode.IsSpace(r) || unicode.Is(unicode.Pd, r) || r == '_':
+			hyphen = true
+		}
 	}
+	return buf.String()
+}
 
-	yyyy, err := strconv.ParseInt(m[0][1], 10, 32)
-	if err != nil {
-		Debugf("Blog Tuple: %s: bad year '%s'", path, m[1])
-		return BlogTuple{}, false
+// SlugPath returns path with its filename, less the extension, replaced by
+// slug. An empty slug leaves it as it is.
+func SlugPath(path, slug string) string {
+	if slug == "" {
+		return path
 	}
+	return filepath.Join(filepath.Dir(path), slug+filepath.Ext(path))
+}
 
-	mm, err := strconv.ParseInt(m[0][2], 10, 32)
-	if err != nil {
-		Debugf("Blog Tuple: %s: bad month '%s'", path, m[2])
-		return BlogTuple{}, false
-	}
+type BlogTuple struct {
+	Year     int
+	Month    int
+	Day      int
+	Title    string
+	Filename string
+}
 
-	dd, err := strconv.ParseInt(m[0][3], 10, 32)
-	if err != nil {
-		Debugf("Blog Tuple: %s: bad day '%s'", path, m[3])
+// NewBlogTuple parses the filename of the blog entry at path: a date prefix
+// in one of the -blog.dates layouts, tried in order, and the rest of the
+// name. Files without one aren't blog entries, and return false.
+func NewBlogTuple(path, targetExt string) (BlogTuple, bool) {
+	path = filepath.Base(path)
+	name := strings.TrimSuffix(path, filepath.Ext(path))
+	if name == path {
+		Debugf("Blog Tuple: %s: no extension", path)
 		return BlogTuple{}, false
 	}
 
-	if len(m[0][4]) <= 0 {
-		Debugf("Blog Tuple: %s: failed to parse stage 3", path)
+	date, filename, ok := splitBlogDate(name)
+	if !ok {
+		Debugf("Blog Tuple: %s: no date in any of %s", path, *blogDates)
 		return BlogTuple{}, false
 	}
 
-	filename := m[0][4]
 	title := filename
 	title = strings.Replace(title, "-", " ", -1)
 	title = strings.Replace(title, "_", " ", -1)
@@ -173,28 +481,111 @@ func NewBlogTuple(path, targetExt string) (BlogTuple, bool) {
 
 	Debugf("Blog Tuple: %s: OK", path)
 	return BlogTuple{
-		Year:     int(yyyy),
-		Month:    int(mm),
-		Day:      int(dd),
+		Year:     date.Year(),
+		Month:    int(date.Month()),
+		Day:      date.Day(),
 		Title:    title,
 		Filename: filename + targetExt,
 	}, true
 }
 
+// splitBlogDate splits the passed filename, without its extension, into the
+// date at its start, in the first of the -blog.dates layouts it's in, and the
+// rest, which mustn't be empty.
+func splitBlogDate(name string) (time.Time, string, bool) {
+	for _, layout := range strings.Split(*blogDates, ",") {
+		if layout == "" {
+			continue
+		}
+		for i := 1; i < len(name); i++ {
+			if date, err := time.Parse(layout, name[:i]); err == nil {
+				return date, name[i:], true
+			}
+		}
+	}
+	return time.Time{}, "", false
+}
+
+var (
+	DateLayouts = []string{
+		"2006 01 02", // BlogTuple.DateString
+		"2006-01-02",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		time.RFC3339,
+	}
+)
+
+// ParseDate interprets a "date" metadata value, which may be a time.Time
+// (from TOML or YAML front matter) or a string in one of the DateLayouts.
+func ParseDate(i interface{}) (time.Time, bool) {
+	switch v := i.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range DateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
 func (bt BlogTuple) DateString() string {
 	return fmt.Sprintf("%04d %02d %02d", bt.Year, bt.Month, bt.Day)
 }
 
+// TargetFileFor returns the blog entry's target file in baseDir, following
+// the -permalink pattern if one is set, and baseDir/yyyy/mm/dd/filename
+// otherwise, as a PageFile.
 func (bt BlogTuple) TargetFileFor(baseDir string) string {
-	return filepath.Join(
+	if *permalink != "" {
+		return PageFile(filepath.Join(baseDir, filepath.FromSlash(bt.Permalink(*permalink))))
+	}
+	return PageFile(filepath.Join(
 		baseDir,
 		fmt.Sprintf("%04d", bt.Year),
 		fmt.Sprintf("%02d", bt.Month),
 		fmt.Sprintf("%02d", bt.Day),
 		bt.Filename,
-	)
+	))
 }
 
+// URLFor returns the URL of the blog entry's target file in baseDir. When
+// the -permalink pattern ends in a slash, or with -pretty-urls, the URL does
+// too.
+func (bt BlogTuple) URLFor(baseDir string) string {
+	url := PageURL(bt.TargetFileFor(baseDir))
+	if strings.HasSuffix(*permalink, "/") {
+		url = strings.TrimSuffix(url, "index.html")
+	}
+	return url
+}
+
+// Permalink expands the tokens :year, :month, :day, :title (the filename,
+// without its extension) and :slug (the same, slugified) in pattern. A
+// pattern ending in a slash names a directory, so index.html is appended.
+func (bt BlogTuple) Permalink(pattern string) string {
+	title := strings.TrimSuffix(bt.Filename, filepath.Ext(bt.Filename))
+	s := strings.NewReplacer(
+		":year", fmt.Sprintf("%04d", bt.Year),
+		":month", fmt.Sprintf("%02d", bt.Month),
+		":day", fmt.Sprintf("%02d", bt.Day),
+		":title", title,
+		":slug", Slugify(title),
+	).Replace(pattern)
+	if strings.HasSuffix(s, "/") {
+		s += "index.html"
+	}
+	return s
+}
+
+// RedirectFromURLs returns the URLs of every other yyyy/mm/dd/filename (and
+// yyyy/mm/dd/index.html) spelling of the blog entry's default location in
+// baseDir, without leading zeroes or with them, which should redirect to it.
+// With a -permalink pattern or -pretty-urls, they include the default location
+// itself.
 func (bt BlogTuple) RedirectFromURLs(baseDir string) []string {
 	uniqueFiles := map[string]struct{}{}
 	for _, yearFmt := range []string{"%d", "%04d"} {
@@ -205,7 +596,7 @@ func (bt BlogTuple) RedirectFromURLs(baseDir string) []string {
 					fmt.Sprintf(yearFmt, bt.Year),
 					fmt.Sprintf(monthFmt, bt.Month),
 					fmt.Sprintf(dayFmt, bt.Day),
-					fmt.Sprintf(bt.Filename),
+					bt.Filename,
 				)] = struct{}{}
 				uniqueFiles[filepath.Join(
 					baseDir,
@@ -224,6 +615,7 @@ func (bt BlogTuple) RedirectFromURLs(baseDir string) []string {
 		redirectFromUrl := "/" + Relative(*targetDir, uniqueFile)
 		redirectFromUrls = append(redirectFromUrls, redirectFromUrl)
 	}
+	sort.Strings(redirectFromUrls)
 	return redirectFromUrls
 }
 
@@ -255,6 +647,29 @@ func SplatInto(m map[string]interface{}, path string, metadata map[string]interf
 	m0 = mergemap.Merge(m0, metadata)
 }
 
+// stringValue returns i as a string, if it's any kind of string (including
+// e.g. template.HTML), and the empty string otherwise.
+func stringValue(i interface{}) string {
+	if v := reflect.ValueOf(i); v.Kind() == reflect.String {
+		return v.String()
+	}
+	return ""
+}
+
+// intValue returns i as an int, if it's any kind of number. JSON numbers are
+// float64s, but TOML and YAML integers aren't.
+func intValue(i interface{}) (int, bool) {
+	switch v := i.(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	}
+	return 0, false
+}
+
 func PrettyPrint(i interface{}) string {
 	buf, _ := json.MarshalIndent(i, "# ", "    ")
 	return string(buf)
@@ -262,40 +677,32 @@ func PrettyPrint(i interface{}) string {
 
 // SortedValues returns a slice of every value in the passed map, ordered by
 // the "sortkey" (if it exists) or the name of the entry (if it doesn't).
+// Entries with the same sort key are ordered by name, so the order doesn't
+// depend on map iteration.
 func SortedValues(i interface{}) []interface{} {
 	m, ok := i.(map[string]interface{})
 	if !ok {
 		Fatalf("SortedValues: expected map[string]interface{}, didn't get it")
 	}
-	mapping := map[string]string{} // sort key: original key
+	sortkeys := map[string]string{} // original key: sort key
+	names := stringSlice{}
 	for name, element := range m {
+		names = append(names, name)
+		sortkeys[name] = name
 		submap, ok := element.(map[string]interface{})
 		if !ok {
-			mapping[name] = name
 			continue
 		}
-		sortkey, ok := submap["sortkey"]
-		if !ok {
-			mapping[name] = name
-			continue
+		if sortkey, ok := submap["sortkey"].(string); ok {
+			sortkeys[name] = sortkey
 		}
-		sortkeyString, ok := sortkey.(string)
-		if !ok {
-			mapping[name] = name
-			continue
-		}
-		mapping[sortkeyString] = name
-	}
-
-	sortkeys := stringSlice{}
-	for sortkey, _ := range mapping {
-		sortkeys = append(sortkeys, sortkey)
 	}
-	sort.Sort(sortkeys)
+	sort.Sort(names)
+	sort.SliceStable(names, func(i, j int) bool { return sortkeys[names[i]] > sortkeys[names[j]] })
 
 	orderedValues := []interface{}{}
-	for _, k := range sortkeys {
-		orderedValues = append(orderedValues, m[mapping[k]])
+	for _, name := range names {
+		orderedValues = append(orderedValues, m[name])
 	}
 	return orderedValues
 }
@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestDiffPath(t *testing.T) {
@@ -57,6 +61,133 @@ func TestMustCopy(t *testing.T) {
 	}
 }
 
+func TestCopyMode(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "grender-test-copymode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	script := filepath.Join(root, "run.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(root, "data.txt")
+	if err := ioutil.WriteFile(data, []byte("data\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(data, 0640); err != nil { // regardless of umask
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link.sh")
+	if err := os.Symlink(script, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for src, expected := range map[string]os.FileMode{
+		script: 0755,
+		data:   0640,
+		link:   0755,
+	} {
+		dst := filepath.Join(root, "tgt", filepath.Base(src))
+		Copy(dst, src)
+		info, err := os.Lstat(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Mode().IsRegular() {
+			t.Errorf("%s: expected a regular file, got %s", dst, info.Mode())
+		}
+		if got := info.Mode().Perm(); expected != got {
+			t.Errorf("%s: expected mode %s, got %s", dst, expected, got)
+		}
+	}
+}
+
+func TestCopyLarge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("copies a large file")
+	}
+	root, err := ioutil.TempDir(os.TempDir(), "grender-test-copylarge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	const size = 256 << 20
+	src := filepath.Join(root, "video.mp4")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("end"), size-3); err != nil { // sparse, but for the end
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	dst := filepath.Join(root, "tgt", "video.mp4")
+	Copy(dst, src)
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 8<<20 {
+		t.Errorf("expected Copy to stream, but it allocated %d byte(s) for a %d byte file", allocated, size)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != size {
+		t.Errorf("expected %d byte(s), got %d", size, info.Size())
+	}
+	sums := [2][]byte{}
+	for i, filename := range []string{src, dst} {
+		if sums[i], err = HashFile(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(sums[0], sums[1]) {
+		t.Errorf("expected the copy to have the same contents")
+	}
+}
+
+func TestCopyConcurrent(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "grender-test-copyconcurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	sources := []string{filepath.Join(root, "a.bin"), filepath.Join(root, "b.bin")}
+	for i, src := range sources {
+		if err := ioutil.WriteFile(src, bytes.Repeat([]byte{byte('a' + i)}, 1<<20), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := filepath.Join(root, "tgt", "asset.bin")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(src string) {
+			defer wg.Done()
+			Copy(dst, src)
+		}(sources[i%2])
+	}
+	wg.Wait()
+
+	buf := Read(dst)
+	if len(buf) != 1<<20 || (!bytes.Equal(buf, Read(sources[0])) && !bytes.Equal(buf, Read(sources[1]))) {
+		t.Errorf("expected dst to be one of the sources, whole")
+	}
+	if infos, _ := ioutil.ReadDir(filepath.Dir(dst)); len(infos) != 1 {
+		t.Errorf("expected no temporary files left, got %d file(s)", len(infos))
+	}
+}
+
 func TestMustJSON(t *testing.T) {
 	tmpFile, err := ioutil.TempFile(os.TempDir(), "grender-test-mustjson")
 	if err != nil {
@@ -166,6 +297,163 @@ func TestDefaultDate(t *testing.T) {
 	}
 }
 
+func TestBlogDates(t *testing.T) {
+	defer func(d string) { *blogDates = d }(*blogDates)
+	*blogDates = "2006-1-2-,20060102_"
+	for path, expected := range map[string]string{
+		"2024-01-02-title.md": "2024 01 02 title.html",
+		"2024-1-2-title.md":   "2024 01 02 title.html",
+		"20240102_title.md":   "2024 01 02 title.html",
+		"20240102-title.md":   "",
+		"2024-13-02-title.md": "",
+		"2024-01-02-.md":      "",
+		"2024-01-02-title":    "",
+		"about.md":            "",
+	} {
+		bt, ok := NewBlogTuple(path, ".html")
+		got := ""
+		if ok {
+			got = bt.DateString() + " " + bt.Filename
+		}
+		if expected != got {
+			t.Errorf("'%s': expected '%s', got '%s'", path, expected, got)
+		}
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	bt, _ := NewBlogTuple("/foo/2013-1-2-Foo_Bar.md", ".html")
+	for pattern, expected := range map[string]string{
+		"/:year/:month/:slug/":          "/2013/01/foo-bar/index.html",
+		"/:slug.html":                   "/foo-bar.html",
+		":year-:month-:day/:title.html": "2013-01-02/Foo_Bar.html",
+	} {
+		if got := bt.Permalink(pattern); expected != got {
+			t.Errorf("'%s': expected '%s', got '%s'", pattern, expected, got)
+		}
+	}
+
+	defer func(p, tgt string) { *permalink, *targetDir = p, tgt }(*permalink, *targetDir)
+	*permalink, *targetDir = "/:year/:slug/", "/tgt"
+	if expected, got := "/tgt/blog/2013/foo-bar/index.html", bt.TargetFileFor("/tgt/blog"); expected != got {
+		t.Errorf("TargetFileFor: expected '%s', got '%s'", expected, got)
+	}
+	if expected, got := "/blog/2013/foo-bar/", bt.URLFor("/tgt/blog"); expected != got {
+		t.Errorf("URLFor: expected '%s', got '%s'", expected, got)
+	}
+	redirects := map[string]bool{}
+	for _, url := range bt.RedirectFromURLs("/tgt/blog") {
+		redirects[url] = true
+	}
+	for _, url := range []string{"/blog/2013/01/02/Foo_Bar.html", "/blog/2013/1/2/Foo_Bar.html"} {
+		if !redirects[url] {
+			t.Errorf("RedirectFromURLs: %s missing", url)
+		}
+	}
+}
+
+func TestPrettyURLs(t *testing.T) {
+	defer func(p bool, tgt string) { *prettyURLs, *targetDir = p, tgt }(*prettyURLs, *targetDir)
+	*prettyURLs, *targetDir = true, "/tgt"
+	for target, expected := range map[string]string{
+		"/tgt/about.html":      "/tgt/about/index.html",
+		"/tgt/blog/index.html": "/tgt/blog/index.html",
+		"/tgt/feed.xml":        "/tgt/feed.xml",
+	} {
+		if got := PageFile(target); expected != got {
+			t.Errorf("PageFile(%s): expected '%s', got '%s'", target, expected, got)
+		}
+	}
+	if expected, got := "/blog/", PageURL("/tgt/blog/index.html"); expected != got {
+		t.Errorf("PageURL: expected '%s', got '%s'", expected, got)
+	}
+
+	bt, _ := NewBlogTuple("/foo/2013-1-2-Foo_Bar.md", ".html")
+	if expected, got := "/tgt/blog/2013/01/02/Foo_Bar/index.html", bt.TargetFileFor("/tgt/blog"); expected != got {
+		t.Errorf("TargetFileFor: expected '%s', got '%s'", expected, got)
+	}
+	if expected, got := "/blog/2013/01/02/Foo_Bar/", bt.URLFor("/tgt/blog"); expected != got {
+		t.Errorf("URLFor: expected '%s', got '%s'", expected, got)
+	}
+	redirects := map[string]bool{}
+	for _, url := range bt.RedirectFromURLs("/tgt/blog") {
+		redirects[url] = true
+	}
+	if !redirects["/blog/2013/01/02/Foo_Bar.html"] {
+		t.Errorf("RedirectFromURLs: the default location is missing")
+	}
+
+	*prettyURLs = false
+	if expected, got := "/tgt/about.html", PageFile("/tgt/about.html"); expected != got {
+		t.Errorf("PageFile without -pretty-urls: expected '%s', got '%s'", expected, got)
+	}
+}
+
+func TestIndexNames(t *testing.T) {
+	defer func(n string, p bool) { *indexNames, *prettyURLs = n, p }(*indexNames, *prettyURLs)
+	*indexNames = "index, README"
+	for _, pretty := range []bool{false, true} {
+		*prettyURLs = pretty
+		for target, expected := range map[string]string{
+			"/tgt/index.html":       "/tgt/index.html",
+			"/tgt/docs/README.html": "/tgt/docs/index.html",
+			"/tgt/docs/README.txt":  "/tgt/docs/README.txt",
+		} {
+			if got := PageFile(target); expected != got {
+				t.Errorf("pretty %v: PageFile(%s): expected '%s', got '%s'", pretty, target, expected, got)
+			}
+		}
+	}
+	if IsIndex("/src/indexes.md") {
+		t.Errorf("indexes.md isn't an index")
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	defer func(b, tgt string) { *baseURL, *targetDir = b, tgt }(*baseURL, *targetDir)
+	*targetDir = "/tgt"
+	for base, expected := range map[string]string{
+		"":                          "",
+		"/":                         "",
+		"https://example.com":       "",
+		"https://example.com/blog/": "/blog",
+		"https://example.com/a/b//": "/a/b",
+		"blog":                      "/blog",
+	} {
+		*baseURL = base
+		if got := BasePath(); expected != got {
+			t.Errorf("BasePath(%s): expected '%s', got '%s'", base, expected, got)
+		}
+	}
+
+	*baseURL = "https://example.com/blog/"
+	if expected, got := "/blog/a/b.html", URLFor("/tgt/a/b.html"); expected != got {
+		t.Errorf("URLFor: expected '%s', got '%s'", expected, got)
+	}
+	bt, _ := NewBlogTuple("/src/2013-01-02-foo.md", ".html")
+	if expected, got := "/blog/2013/01/02/foo.html", bt.URLFor("/tgt"); expected != got {
+		t.Errorf("BlogTuple.URLFor: expected '%s', got '%s'", expected, got)
+	}
+	for u, expected := range map[string]string{
+		"/blog":        "/",
+		"/blog/":       "/",
+		"/blog/a.html": "/a.html",
+		"/blogroll":    "/blogroll",
+		"/other/x":     "/other/x",
+	} {
+		if got := SitePath(u); expected != got {
+			t.Errorf("SitePath(%s): expected '%s', got '%s'", u, expected, got)
+		}
+	}
+
+	relative := TemplateFuncs("", map[string]interface{}{"url": "/blog/a/b.html"}, nil)["relative"].(func(string) string)
+	for _, u := range []string{"/blog/css/c.css", "/css/c.css"} {
+		if expected, got := "../css/c.css", relative(u); expected != got {
+			t.Errorf("relative(%s): expected '%s', got '%s'", u, expected, got)
+		}
+	}
+}
+
 func TestSplatInto(t *testing.T) {
 	m := map[string]interface{}{}
 	assert := func(expected string) {
@@ -193,3 +481,76 @@ func TestSplatInto(t *testing.T) {
 	SplatInto(m, "foo", map[string]interface{}{"a": "x"})
 	assert(`{"bar":{"baz":{"x":{"y":"!","yy":"!!"}}},"foo":{"a":"x","b":2}}`)
 }
+
+func TestClean(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "grender-test-clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	Write(filepath.Join(root, "tgt", "a.html"), []byte("a"))
+	Write(filepath.Join(root, "tgt", "b", "c.html"), []byte("c"))
+	if err := Clean(filepath.Join(root, "tgt")); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(root, "tgt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("expected empty target, got %d file(s)", len(infos))
+	}
+
+	for _, dir := range []string{"/", *sourceDir, filepath.Dir(*sourceDir)} {
+		if err := Clean(dir); err == nil {
+			t.Errorf("%s: expected refusal to clean", dir)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	for s, expected := range map[string]string{
+		"go":                    "go",
+		"Static Sites":          "static-sites",
+		"  C++ & Go!  ":         "c-go",
+		"already-slugged":       "already-slugged",
+		"Tabs\tand  spaces":     "tabs-and-spaces",
+		"snake_case -- en–dash": "snake-case-en-dash",
+		"Crème Brûlée":          "creme-brulee",
+		"Straße, Øresund":       "strasse-oresund",
+		"Don't panic.":          "dont-panic",
+		"🎉 Launch 🚀 day":        "launch-day",
+		"Привет мир":            "привет-мир",
+		"🎉":                     "",
+	} {
+		if got := Slugify(s); expected != got {
+			t.Errorf("'%s': expected '%s', got '%s'", s, expected, got)
+		}
+	}
+}
+
+func TestUnpublished(t *testing.T) {
+	tomorrow := time.Now().Add(24 * time.Hour)
+	for _, tu := range []struct {
+		metadata       map[string]interface{}
+		drafts, future bool
+		expected       bool
+	}{
+		{map[string]interface{}{}, false, false, false},
+		{map[string]interface{}{"draft": true}, false, false, true},
+		{map[string]interface{}{"draft": true}, true, false, false},
+		{map[string]interface{}{"date": "2013 01 02"}, false, false, false},
+		{map[string]interface{}{"date": tomorrow.Format("2006-01-02 15:04:05")}, false, false, true},
+		{map[string]interface{}{"date": tomorrow}, false, true, false},
+		{map[string]interface{}{"date": "not a date"}, false, false, false},
+	} {
+		func() {
+			defer func(d, f bool) { *drafts, *future = d, f }(*drafts, *future)
+			*drafts, *future = tu.drafts, tu.future
+			if got := Unpublished(tu.metadata); tu.expected != got {
+				t.Errorf("%v (drafts=%v future=%v): expected %v, got %v", tu.metadata, tu.drafts, tu.future, tu.expected, got)
+			}
+		}()
+	}
+}
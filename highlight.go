@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/russross/blackfriday"
+)
+
+var (
+	HighlightCSSFile = "highlight.css"
+)
+
+// HighlightRenderer is a blackfriday Renderer which syntax-highlights fenced
+// code blocks with a language tag. Other code blocks, and blocks in languages
+// chroma doesn't know, pass through to the wrapped Renderer unchanged.
+type HighlightRenderer struct {
+	blackfriday.Renderer
+}
+
+func (r HighlightRenderer) BlockCode(out *bytes.Buffer, text []byte, infoString string) {
+	fields := strings.Fields(infoString)
+	if len(fields) <= 0 {
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+	lexer := lexers.Get(fields[0])
+	if lexer == nil {
+		Debugf("highlight: no lexer for '%s'", fields[0])
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(text))
+	if err != nil {
+		Warningf("highlight %s: %s", fields[0], err)
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+	buf := bytes.Buffer{}
+	if err := highlightFormatter().Format(&buf, styles.Get(*highlightStyle), iterator); err != nil {
+		Warningf("highlight %s: %s", fields[0], err)
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	out.Write(buf.Bytes())
+}
+
+func highlightFormatter() *html.Formatter {
+	return html.New(html.WithClasses(!*highlightInline))
+}
+
+// WriteHighlightCSS writes the stylesheet for class-based highlighting to
+// HighlightCSSFile in the target directory. Pages must link it themselves.
+func WriteHighlightCSS() error {
+	if *highlightStyle == "" || *highlightInline {
+		return nil
+	}
+	buf := bytes.Buffer{}
+	if err := highlightFormatter().WriteCSS(&buf, styles.Get(*highlightStyle)); err != nil {
+		return err
+	}
+	dst := filepath.Join(*targetDir, HighlightCSSFile)
+	Write(dst, buf.Bytes())
+	Debugf("%s written", dst)
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlightRenderer(t *testing.T) {
+	htmlBits, extensionBits := MarkdownBits(map[string]interface{}{})
+	render := func(md string) string {
+		return string(RenderMarkdown([]byte(md), htmlBits, extensionBits))
+	}
+
+	if got := render("```\nplain := true\n```\n"); got != "<pre><code>plain := true\n</code></pre>\n" {
+		t.Errorf("untagged block: got %q", got)
+	}
+	if got := render("```nosuchlanguage\nplain\n```\n"); !strings.Contains(got, "<code class=\"language-nosuchlanguage\">plain") {
+		t.Errorf("unknown language: got %q", got)
+	}
+
+	got := render("```go\nfunc main() {}\n```\n")
+	if !strings.Contains(got, `<span style="`) || strings.Contains(got, `class="language-go"`) {
+		t.Errorf("inline highlighting: got %q", got)
+	}
+
+	defer func(inline bool) { *highlightInline = inline }(*highlightInline)
+	*highlightInline = false
+	got = render("```go\nfunc main() {}\n```\n")
+	if !strings.Contains(got, `<span class="`) || strings.Contains(got, `style="`) {
+		t.Errorf("class highlighting: got %q", got)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Languages returns the -languages of a multilingual site, the default one
+// first, or none.
+func Languages() []string {
+	languages := []string{}
+	for _, lang := range strings.Split(*languagesList, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// DefaultLanguage returns the language rendered at the root of the target
+// directory, or "" if the site isn't multilingual.
+func DefaultLanguage() string {
+	if languages := Languages(); len(languages) > 0 {
+		return languages[0]
+	}
+	return ""
+}
+
+// PageLanguage returns the language of the page at path, and path without
+// the language suffix: post.es.md is in "es", and renders like post.md would.
+// Pages without a suffix are in the language of their "lang" metadata, the
+// last of the passed maps winning, or the DefaultLanguage.
+func PageLanguage(path string, metadata ...map[string]interface{}) (string, string) {
+	languages := Languages()
+	if len(languages) <= 0 {
+		return "", path
+	}
+	ext := filepath.Ext(path)
+	if suffix := filepath.Ext(strings.TrimSuffix(path, ext)); suffix != "" {
+		for _, lang := range languages {
+			if suffix == "."+lang {
+				return lang, strings.TrimSuffix(path, suffix+ext) + ext
+			}
+		}
+	}
+	lang := languages[0]
+	for _, m := range metadata {
+		if s := stringValue(m["lang"]); s != "" {
+			lang = s
+		}
+	}
+	return lang, path
+}
+
+// LanguagePath returns the file or directory in the target directory where
+// target goes in the language: under a directory named for it, unless it's
+// the default language, or target is in that directory already.
+func LanguagePath(target, lang string) string {
+	if lang == "" || lang == DefaultLanguage() {
+		return target
+	}
+	relative := Relative(*targetDir, target)
+	if relative == lang || strings.HasPrefix(relative, lang+string(filepath.Separator)) {
+		return target
+	}
+	return filepath.Join(*targetDir, lang, relative)
+}
+
+// LinkTranslations adds "translations" metadata to every page among paths
+// that exists in more than one language: the "lang", url and title of each of
+// the others, in -languages order. Pages are translations of one another if
+// they have the same "translationkey" metadata, or else the same source path,
+// without language suffixes and language directories.
+func LinkTranslations(s StackReadWriter, paths []string) {
+	if len(Languages()) <= 0 {
+		return
+	}
+	order := map[string]int{}
+	for i, lang := range Languages() {
+		order[lang] = i
+	}
+
+	groups := map[string][]map[string]interface{}{} // translation key: pages
+	keys := []string{}
+	for _, path := range paths {
+		if ext := PageExt(path); ext != ".html" && ext != ".md" {
+			continue
+		}
+		metadata := s.Get(path)
+		if Unpublished(metadata) {
+			continue
+		}
+		key := stringValue(metadata["translationkey"])
+		if key == "" {
+			lang, page := PageLanguage(path, metadata)
+			key = filepath.ToSlash(SourceRelative(page))
+			key = strings.TrimPrefix(key, lang+"/")
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], metadata)
+	}
+
+	for _, key := range keys {
+		pages := groups[key]
+		if len(pages) < 2 {
+			continue
+		}
+		sort.SliceStable(pages, func(i, j int) bool {
+			return order[stringValue(pages[i]["lang"])] < order[stringValue(pages[j]["lang"])]
+		})
+		for _, page := range pages {
+			translations := []map[string]interface{}{}
+			for _, other := range pages {
+				if other["source"] != page["source"] {
+					translations = append(translations, map[string]interface{}{
+						"lang":  other["lang"],
+						"url":   other["url"],
+						"title": other["title"],
+					})
+				}
+			}
+			s.Add(stringValue(page["source"]), map[string]interface{}{"translations": translations})
+		}
+		Debugf("%s: linked %d translation(s)", key, len(pages))
+	}
+}
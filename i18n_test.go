@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageLanguage(t *testing.T) {
+	defer func(languages string) { *languagesList = languages }(*languagesList)
+	*languagesList = "en, es"
+	for _, c := range []struct {
+		path     string
+		metadata map[string]interface{}
+		lang     string
+		page     string
+	}{
+		{"post.md", nil, "en", "post.md"},
+		{"post.es.md", nil, "es", "post.md"},
+		{"post.en.md", map[string]interface{}{"lang": "es"}, "en", "post.md"},
+		{"post.fr.md", nil, "en", "post.fr.md"},
+		{"about.html", map[string]interface{}{"lang": "es"}, "es", "about.html"},
+		{"jquery.min.js", nil, "en", "jquery.min.js"},
+	} {
+		if lang, page := PageLanguage(c.path, c.metadata); c.lang != lang || c.page != page {
+			t.Errorf("%s: expected %s %s, got %s %s", c.path, c.lang, c.page, lang, page)
+		}
+	}
+
+	*languagesList = ""
+	if lang, page := PageLanguage("post.es.md"); lang != "" || page != "post.es.md" {
+		t.Errorf("not multilingual: expected no language, got %s %s", lang, page)
+	}
+}
+
+func TestMultilingual(t *testing.T) {
+	files := map[string]string{
+		"_.json":                      `{"template":"page.template"}`,
+		"feed.json":                   `{"feed":{"title":"Blog","link":"https://example.com"}}`,
+		"page.template":               `{{ .lang }} {{ .url }}{{ range .translations }} {{ .lang }}={{ .url }}{{ end }}{{ with .prev }} prev={{ .url }}{{ end }}`,
+		"blog/page.template":          `{{ .lang }} {{ .url }}{{ range .translations }} {{ .lang }}={{ .url }}{{ end }}{{ with .prev }} prev={{ .url }}{{ end }}`,
+		"about.md":                    "about",
+		"about.es.md":                 "acerca",
+		"es/contact.html":             "{{ .lang }} {{ .url }}",
+		"es/_.json":                   `{"lang":"es"}`,
+		"contact.html":                "{\"translationkey\":\"contact\"}\n---\n{{ .lang }} {{ .url }}{{ range .translations }} {{ .lang }}={{ .url }}{{ end }}",
+		"es/contacto.html":            "{\"translationkey\":\"contact\"}\n---\n{{ .lang }} {{ .url }}{{ range .translations }} {{ .lang }}={{ .url }}{{ end }}",
+		"blog/2013-01-02-hello.md":    "hello",
+		"blog/2013-01-02-hello.es.md": "hola",
+		"blog/2013-02-03-again.md":    "again",
+	}
+	defer func(languages string) { *languagesList = languages }(*languagesList)
+	*languagesList = "en,es"
+	defer func(format string) { *feedFormat = format }(*feedFormat)
+	*feedFormat = "jsonfeed"
+	withSite(t, files, func() {
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range map[string]string{
+			"about.html":                    "en /about.html es=/es/about.html",
+			"es/about.html":                 "es /es/about.html en=/about.html",
+			"es/contact.html":               "es /es/contact.html",
+			"contact.html":                  "en /contact.html es=/es/contacto.html",
+			"es/contacto.html":              "es /es/contacto.html en=/contact.html",
+			"blog/2013/01/02/hello.html":    "en /blog/2013/01/02/hello.html es=/es/blog/2013/01/02/hello.html",
+			"es/blog/2013/01/02/hello.html": "es /es/blog/2013/01/02/hello.html en=/blog/2013/01/02/hello.html",
+			"blog/2013/02/03/again.html":    "en /blog/2013/02/03/again.html prev=/blog/2013/01/02/hello.html",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(buf)); expected != got {
+				t.Errorf("%s: expected '%s', got '%s'", name, expected, got)
+			}
+		}
+
+		for name, expected := range map[string][]string{
+			"feed.json":    {"https://example.com/blog/2013/02/03/again.html", "https://example.com/blog/2013/01/02/hello.html"},
+			"es/feed.json": {"https://example.com/es/blog/2013/01/02/hello.html"},
+		} {
+			feed := struct {
+				FeedURL string `json:"feed_url"`
+				Items   []struct {
+					URL string `json:"url"`
+				} `json:"items"`
+			}{}
+			if err := json.Unmarshal(Read(filepath.Join(*targetDir, name)), &feed); err != nil {
+				t.Fatal(err)
+			}
+			if feed.FeedURL != "https://example.com/"+name {
+				t.Errorf("%s: bad feed_url %s", name, feed.FeedURL)
+			}
+			urls := []string{}
+			for _, item := range feed.Items {
+				urls = append(urls, item.URL)
+			}
+			if strings.Join(expected, " ") != strings.Join(urls, " ") {
+				t.Errorf("%s: expected %v, got %v", name, expected, urls)
+			}
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Patterns is a flag.Value of glob patterns, which may be set more than
+// once, and to comma-separated lists.
+type Patterns struct {
+	patterns []string
+	regexps  []*regexp.Regexp
+}
+
+func patternsVar(name, usage string) *Patterns {
+	p := &Patterns{}
+	flag.Var(p, name, usage)
+	return p
+}
+
+func (p *Patterns) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(p.patterns, ",")
+}
+
+func (p *Patterns) Set(s string) error {
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			p.patterns = append(p.patterns, pattern)
+			p.regexps = append(p.regexps, globRegexp(pattern))
+		}
+	}
+	return nil
+}
+
+// Match returns whether the slash-separated path matches any of the
+// patterns. Patterns without a slash match the last element of the path.
+func (p *Patterns) Match(path string) bool {
+	for i, re := range p.regexps {
+		name := path
+		if !strings.Contains(p.patterns[i], "/") {
+			name = name[strings.LastIndex(name, "/")+1:]
+		}
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp compiles a glob pattern: * matches anything but a slash, ? a
+// single character but a slash, and ** anything, slashes included, so that
+// node_modules/** matches node_modules and everything in it.
+func globRegexp(pattern string) *regexp.Regexp {
+	pattern = strings.Trim(pattern, "/")
+	re := strings.Builder{}
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "/**"):
+			re.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			re.WriteString("[^/]*")
+		case pattern[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+// skipIgnored is what a filepath.WalkFunc returns for an ignored path.
+func skipIgnored(path string, info os.FileInfo) error {
+	Debugf("%s ignored", path)
+	if info.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// IgnoreFile is the file at the root of the source directory with more
+// patterns to ignore, in .gitignore syntax.
+const IgnoreFile = ".grenderignore"
+
+// IgnoreRule is a line of an IgnoreFile.
+type IgnoreRule struct {
+	Pattern  string
+	Negate   bool // "!pattern" re-includes what an earlier rule ignored
+	DirOnly  bool // "pattern/" only matches directories
+	Anchored bool // patterns with a slash match the whole path
+	re       *regexp.Regexp
+}
+
+// IgnoreRules are the rules of an IgnoreFile, in order.
+type IgnoreRules []IgnoreRule
+
+// ignoreRules are the rules Gather last loaded from the IgnoreFile.
+var ignoreRules IgnoreRules
+
+// ParseIgnoreRules parses the lines of an IgnoreFile. Blank lines and lines
+// starting with # are skipped; a leading backslash escapes a # or !.
+func ParseIgnoreRules(buf []byte) IgnoreRules {
+	rules := IgnoreRules{}
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := IgnoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.Negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, "\\") {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.DirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.Pattern = line
+		rule.Anchored = strings.Contains(line, "/")
+		rule.re = globRegexp(line)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// LoadIgnoreRules parses the IgnoreFile at filename. It's not an error for
+// the file not to exist.
+func LoadIgnoreRules(filename string) (IgnoreRules, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return IgnoreRules{}, nil
+	} else if err != nil {
+		return IgnoreRules{}, err
+	}
+	rules := ParseIgnoreRules(buf)
+	Debugf("%s: %d ignore rule(s)", filename, len(rules))
+	return rules, nil
+}
+
+// Match returns whether the slash-separated path, of a directory or not, is
+// ignored by the rules: whether the last rule that matches it, or any of
+// the directories it's in, isn't a negation.
+func (rules IgnoreRules) Match(path string, dir bool) bool {
+	if len(rules) <= 0 {
+		return false
+	}
+	elements := strings.Split(path, "/")
+	for i := 1; i < len(elements); i++ {
+		if rules.match(strings.Join(elements[:i], "/"), true) {
+			return true
+		}
+	}
+	return rules.match(path, dir)
+}
+
+func (rules IgnoreRules) match(path string, dir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.DirOnly && !dir {
+			continue
+		}
+		name := path
+		if !rule.Anchored {
+			name = name[strings.LastIndex(name, "/")+1:]
+		}
+		if rule.re.MatchString(name) {
+			ignored = !rule.Negate
+		}
+	}
+	return ignored
+}
+
+// Ignored returns whether the file or directory at path, in the source
+// directory, matches an -ignore pattern or the IgnoreFile.
+func Ignored(path string, dir bool) bool {
+	relative := filepath.ToSlash(SourceRelative(path))
+	if relative == "" || strings.HasPrefix(relative, "../") {
+		return false
+	}
+	return ignorePatterns.Match(relative) || ignoreRules.Match(relative, dir)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatterns(t *testing.T) {
+	p := &Patterns{}
+	p.Set("node_modules/**, *~")
+	p.Set(".DS_Store,drafts/*.md,**/cache/**")
+	if expected, got := "node_modules/**,*~,.DS_Store,drafts/*.md,**/cache/**", p.String(); expected != got {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	for path, expected := range map[string]bool{
+		"node_modules":        true,
+		"node_modules/a/b.js": true,
+		"lib/node_modules":    false,
+		"index.html~":         true,
+		"blog/entry.md~":      true,
+		"blog/.DS_Store":      true,
+		"drafts/a.md":         true,
+		"drafts/sub/a.md":     false,
+		"drafts/a.html":       false,
+		"cache":               true,
+		"a/b/cache/c":         true,
+		"a/cached":            false,
+		"index.html":          false,
+		"node_modules.html":   false,
+	} {
+		if got := p.Match(path); expected != got {
+			t.Errorf("%s: expected %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	files := map[string]string{
+		"_.json":                    `{"template":"page.template"}`,
+		"page.template":             `{{ .content }}`,
+		"index.html":                `{{ range .files }}{{ .url }} {{ end }}`,
+		"a.md":                      "a",
+		"a.md~":                     "backup",
+		"node_modules/_.json":       `{"template":"missing.template"}`,
+		"node_modules/pkg/index.js": "js",
+		"node_modules/pkg/b.md":     "b",
+	}
+	defer func(p *Patterns) { ignorePatterns = p }(ignorePatterns)
+	ignorePatterns = &Patterns{}
+	ignorePatterns.Set("node_modules/**,*~")
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(*targetDir, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "/a.html /index.html ", string(buf); expected != got {
+			t.Errorf("expected '%s', got '%s'", expected, got)
+		}
+		for _, name := range []string{"a.md~", "node_modules"} {
+			if _, err := os.Stat(filepath.Join(*targetDir, name)); err == nil {
+				t.Errorf("%s: expected it to be ignored", name)
+			}
+		}
+		if got := s.Get(filepath.Join(*sourceDir, "node_modules", "pkg", "b.md"))["template"]; got != "page.template" {
+			t.Errorf("expected node_modules/_.json to be ignored, got template %v", got)
+		}
+	})
+}
+
+func TestIgnoreRules(t *testing.T) {
+	rules := ParseIgnoreRules([]byte("# comment\n\n*.log\n!keep.log\nbuild/\n/drafts/*.md\ntmp/**\n\\#hash\n"))
+	if len(rules) != 6 {
+		t.Fatalf("expected 6 rules, got %d: %v", len(rules), rules)
+	}
+	for _, c := range []struct {
+		path     string
+		dir      bool
+		expected bool
+	}{
+		{"a.log", false, true},
+		{"sub/b.log", false, true},
+		{"keep.log", false, false},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"sub/build", true, true},
+		{"build/x.html", false, true},
+		{"drafts/a.md", false, true},
+		{"sub/drafts/a.md", false, false},
+		{"tmp", true, true},
+		{"tmp/a/b", false, true},
+		{"#hash", false, true},
+		{"index.html", false, false},
+	} {
+		if got := rules.Match(c.path, c.dir); c.expected != got {
+			t.Errorf("%s (dir %v): expected %v, got %v", c.path, c.dir, c.expected, got)
+		}
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	files := map[string]string{
+		IgnoreFile:         "vendor/\n*.bak\n!important.bak\n",
+		"index.html":       `{{ range .files }}{{ .url }} {{ end }}`,
+		"a.html":           "a",
+		"a.html.bak":       "old",
+		"important.bak":    "kept",
+		"vendor/lib.js":    "js",
+		"vendor/page.html": "page",
+	}
+	defer func(rules IgnoreRules) { ignoreRules = rules }(ignoreRules)
+	withSite(t, files, func() {
+		s, paths, err := Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(*targetDir, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "/a.html /index.html ", string(buf); expected != got {
+			t.Errorf("expected '%s', got '%s'", expected, got)
+		}
+		for name, expected := range map[string]bool{
+			"a.html.bak":    false,
+			"important.bak": true,
+			"vendor":        false,
+			IgnoreFile:      false,
+		} {
+			if _, err := os.Stat(filepath.Join(*targetDir, name)); (err == nil) != expected {
+				t.Errorf("%s: expected it to be written %v, got %v", name, expected, err == nil)
+			}
+		}
+	})
+}
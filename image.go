@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ImageSize is the size of an image in pixels.
+type ImageSize struct {
+	Width  int
+	Height int
+}
+
+// ImageSizeCache holds the sizes of images, keyed by file, so that each is
+// only decoded once however many pages refer to it. A file is decoded again
+// whenever its modification time changes. It's safe for concurrent use.
+type ImageSizeCache struct {
+	mtx sync.Mutex
+	m   map[string]cachedImageSize // filename: size
+}
+
+type cachedImageSize struct {
+	modTime time.Time
+	size    ImageSize
+}
+
+var (
+	ImageSizes = NewImageSizeCache()
+)
+
+func NewImageSizeCache() *ImageSizeCache {
+	return &ImageSizeCache{
+		m: map[string]cachedImageSize{},
+	}
+}
+
+// Lookup returns the size of the PNG, JPEG or GIF image in filename.
+func (c *ImageSizeCache) Lookup(filename string) (ImageSize, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return ImageSize{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if cached, ok := c.m[filename]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.size, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return ImageSize{}, err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return ImageSize{}, err
+	}
+	size := ImageSize{Width: cfg.Width, Height: cfg.Height}
+	c.m[filename] = cachedImageSize{modTime: info.ModTime(), size: size}
+	Debugf("%s decoded (%dx%d)", filename, size.Width, size.Height)
+	return size, nil
+}
+
+// ImageFile returns the image file that name refers to from the template at
+// path, as for SourceFileFor. An image that isn't in the source directory is
+// looked for at the same place in the -static directory, and then in the
+// target directory. It also returns the image's path relative to them.
+func ImageFile(path, name string) (string, string) {
+	filename := SourceFileFor(path, name)
+	relative := SourceRelative(filename)
+	if _, err := os.Stat(filename); err != nil {
+		for _, dir := range []string{*staticDir, *targetDir} {
+			if _, err := os.Stat(filepath.Join(dir, relative)); dir != "" && err == nil {
+				return filepath.Join(dir, relative), relative
+			}
+		}
+	}
+	return filename, relative
+}
+
+// ImageSizeOf returns the size of the image that name refers to from the
+// template at path, as found by ImageFile.
+func ImageSizeOf(path, name string, deps *Dependencies) (ImageSize, error) {
+	filename, _ := ImageFile(path, name)
+	size, err := ImageSizes.Lookup(filename)
+	if err != nil {
+		return ImageSize{}, fmt.Errorf("imagesize %s: %s", name, err)
+	}
+	deps.Read(filename)
+	return size, nil
+}
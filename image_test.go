@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageSize(t *testing.T) {
+	encoded := map[string]func(*bytes.Buffer, image.Image) error{
+		"img/a.png": func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) },
+		"img/b.jpg": func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) },
+		"c.gif":     func(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) },
+	}
+	files := map[string]string{
+		"blog/post.html": `{{ with imagesize "../img/a.png" }}{{ .Width }}x{{ .Height }}{{ end }}`,
+		"img/bad.png":    "not an image",
+	}
+	withSite(t, files, func() {
+		for name, encode := range encoded {
+			buf := bytes.Buffer{}
+			if err := encode(&buf, image.NewRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+				t.Fatal(err)
+			}
+			Write(filepath.Join(*sourceDir, name), buf.Bytes())
+		}
+		Write(filepath.Join(*targetDir, "copied.png"), Read(filepath.Join(*sourceDir, "img", "a.png")))
+
+		page := filepath.Join(*sourceDir, "index.html")
+		for _, name := range []string{"/img/a.png", "img/b.jpg", "c.gif", "copied.png"} {
+			size, err := ImageSizeOf(page, name, nil)
+			if err != nil {
+				t.Errorf("%s: %s", name, err)
+			} else if size != (ImageSize{3, 2}) {
+				t.Errorf("%s: expected 3x2, got %dx%d", name, size.Width, size.Height)
+			}
+		}
+		for _, name := range []string{"img/bad.png", "missing.png"} {
+			if _, err := ImageSizeOf(page, name, nil); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+
+		s := gather(t)
+		buf, _, err := RenderFile(s, filepath.Join(*sourceDir, "blog", "post.html"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "3x2", string(buf); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+}
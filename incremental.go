@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/template/parse"
+)
+
+var (
+	DependencyFile = ".grender-deps.json"
+)
+
+// Dependencies records the files that were read (Sources) and written
+// (Targets) while transforming a single source file. A nil *Dependencies
+// records nothing. The Summary of a Markdown page is kept too, so that an
+// incremental build doesn't render its content again only to summarize it.
+type Dependencies struct {
+	Sources     []string `json:"sources"`
+	Targets     []string `json:"targets"`
+	Summary     string   `json:"summary,omitempty"`
+	SummaryHTML bool     `json:"summaryhtml,omitempty"` // a template.HTML, not text
+	Pages       bool     `json:"-"`                     // see ReadPages
+}
+
+// Read records that filename went into the transformation.
+func (d *Dependencies) Read(filename string) {
+	if d != nil {
+		d.Sources = append(d.Sources, filename)
+	}
+}
+
+// Wrote records that filename came out of the transformation.
+func (d *Dependencies) Wrote(filename string) {
+	if d != nil {
+		d.Targets = append(d.Targets, filename)
+	}
+}
+
+// Summarized records the summary of the transformed page.
+func (d *Dependencies) Summarized(summary interface{}) {
+	if d != nil {
+		_, d.SummaryHTML = summary.(template.HTML)
+		d.Summary = stringValue(summary)
+	}
+}
+
+// ListingKeys are the metadata keys under which a page gets the metadata of
+// other pages: the global key, section and paginator pages, neighbors,
+// related pages, translations and term counts.
+func ListingKeys() []string {
+	keys := []string{*globalKey, "pages", "paginator", "prev", "next", "related", "translations", TermCountKey}
+	if *globalFlat != "" {
+		keys = append(keys, *globalFlat)
+	}
+	return keys
+}
+
+// ReadPages records that the metadata of other pages went into the
+// transformation, as it does wherever a template is handed a section's or a
+// paginator's pages, or refers to one of the ListingKeys. Transform then
+// records every page as a source, so that the file is rebuilt whenever any
+// page changes.
+func (d *Dependencies) ReadPages() {
+	if d != nil {
+		d.Pages = true
+	}
+}
+
+// IsListing returns true if the metadata of other pages went into the
+// transformation recorded in d, as recorded by ReadPages.
+func IsListing(d *Dependencies) bool {
+	return d != nil && d.Pages
+}
+
+// listsPages returns true if the template tree at node refers to any of the
+// keys, as a field, e.g. .files or $.prev.title, or a string, as in index .
+// "files".
+func listsPages(node parse.Node, keys map[string]bool) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if listsPages(child, keys) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return listsPages(n.Pipe, keys)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if listsPages(cmd, keys) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if listsPages(arg, keys) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		return anyKey(n.Ident, keys)
+	case *parse.VariableNode:
+		return anyKey(n.Ident[1:], keys)
+	case *parse.ChainNode:
+		return anyKey(n.Field, keys) || listsPages(n.Node, keys)
+	case *parse.StringNode:
+		return keys[n.Text]
+	case *parse.IfNode:
+		return listsPages(n.Pipe, keys) || listsPages(n.List, keys) || listsPages(n.ElseList, keys)
+	case *parse.RangeNode:
+		return listsPages(n.Pipe, keys) || listsPages(n.List, keys) || listsPages(n.ElseList, keys)
+	case *parse.WithNode:
+		return listsPages(n.Pipe, keys) || listsPages(n.List, keys) || listsPages(n.ElseList, keys)
+	case *parse.TemplateNode:
+		return listsPages(n.Pipe, keys)
+	}
+	return false
+}
+
+func anyKey(idents []string, keys map[string]bool) bool {
+	for _, ident := range idents {
+		if keys[ident] {
+			return true
+		}
+	}
+	return false
+}
+
+// DependencyGraph maps every transformed source file to its Dependencies. It
+// persists between builds, so that incremental builds can tell which target
+// files are already up to date. It's safe for concurrent use.
+type DependencyGraph struct {
+	mtx sync.Mutex
+	m   map[string]*Dependencies // source file: dependencies
+}
+
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{
+		m: map[string]*Dependencies{},
+	}
+}
+
+// LoadDependencyGraph reads the DependencyGraph saved in filename. If the file
+// doesn't exist or can't be parsed, it returns an empty graph, which results
+// in a full rebuild.
+func LoadDependencyGraph(filename string) *DependencyGraph {
+	g := NewDependencyGraph()
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		Debugf("%s: %s; no dependency graph", filename, err)
+		return g
+	}
+	if err := json.Unmarshal(buf, &g.m); err != nil {
+		Warningf("%s: %s; ignoring dependency graph", filename, err)
+		return NewDependencyGraph()
+	}
+	return g
+}
+
+// Save writes the DependencyGraph to filename.
+func (g *DependencyGraph) Save(filename string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	buf, err := json.MarshalIndent(g.m, "", "\t")
+	if err != nil {
+		Fatalf("dependency graph: %s", err)
+	}
+	Write(filename, buf)
+}
+
+// Set records the Dependencies of the given source file. Passing nil
+// Dependencies forgets the file, so that it's rebuilt next time.
+func (g *DependencyGraph) Set(path string, d *Dependencies) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if d == nil {
+		delete(g.m, path)
+		return
+	}
+	g.m[path] = d
+}
+
+// Summary returns the summary recorded for the given source file, if any.
+func (g *DependencyGraph) Summary(path string) (interface{}, bool) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	d, ok := g.m[path]
+	if !ok || (d.Summary == "" && !d.SummaryHTML) {
+		return nil, false
+	}
+	if d.SummaryHTML {
+		return template.HTML(d.Summary), true
+	}
+	return d.Summary, true
+}
+
+// Covers returns true if the graph knows about exactly the given source
+// files. When files have been added or removed, listings built from the
+// global key may have changed, so the graph can't be trusted.
+func (g *DependencyGraph) Covers(paths []string) bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if len(paths) != len(g.m) {
+		return false
+	}
+	for _, path := range paths {
+		if _, ok := g.m[path]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Targets returns every target file recorded in the graph.
+func (g *DependencyGraph) Targets() map[string]bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	targets := map[string]bool{}
+	for _, d := range g.m {
+		for _, target := range d.Targets {
+			targets[target] = true
+		}
+	}
+	return targets
+}
+
+// SourceOf returns the source file of every target file recorded in the
+// graph, by target file.
+func (g *DependencyGraph) SourceOf() map[string]string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	sources := map[string]string{}
+	for path, d := range g.m {
+		for _, target := range d.Targets {
+			sources[target] = path
+		}
+	}
+	return sources
+}
+
+// UpToDate returns true if every target file recorded for the given source
+// file exists, and is newer than every recorded source file.
+func (g *DependencyGraph) UpToDate(path string) bool {
+	g.mtx.Lock()
+	d, ok := g.m[path]
+	g.mtx.Unlock()
+	if !ok || len(d.Targets) <= 0 {
+		return false
+	}
+
+	var oldestTarget int64
+	for i, target := range d.Targets {
+		info, err := os.Stat(target)
+		if err != nil {
+			return false
+		}
+		if t := info.ModTime().UnixNano(); i == 0 || t < oldestTarget {
+			oldestTarget = t
+		}
+	}
+	for _, source := range d.Sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			return false
+		}
+		if info.ModTime().UnixNano() > oldestTarget {
+			return false
+		}
+	}
+	return true
+}
+
+// MetadataFiles returns every .json file in the directories between the
+// source directory and the given source file, the -site file, and the data
+// files, as they contribute to its inherited metadata.
+func MetadataFiles(path string) []string {
+	files := []string{}
+	dir := filepath.Dir(path)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		files = append(files, matches...)
+		if dir == SourceDirOf(path) || dir == filepath.Dir(dir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	if _, err := os.Stat(*siteFile); *siteFile != "" && err == nil {
+		files = append(files, *siteFile)
+	}
+	files = append(files, dataFiles...)
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDependencyGraphUpToDate(t *testing.T) {
+	files := map[string]string{
+		"index.html":         `{{ importhtml "header.html.source" }} {{ .title }}`,
+		"header.html.source": `<h1>Header</h1>`,
+		"_.json":             `{"title":"Title"}`,
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		graph := NewDependencyGraph()
+		if _, errs := Transform(s, paths, 1, graph); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+
+		index := filepath.Join(*sourceDir, "index.html")
+		if !graph.UpToDate(index) {
+			t.Fatalf("%s: expected up to date after build", index)
+		}
+		if !graph.Covers(paths) {
+			t.Fatalf("expected graph to cover %v", paths)
+		}
+		if graph.Covers(append(paths, filepath.Join(*sourceDir, "new.html"))) {
+			t.Fatalf("expected graph not to cover a new file")
+		}
+
+		filename := filepath.Join(*targetDir, DependencyFile)
+		graph.Save(filename)
+		graph = LoadDependencyGraph(filename)
+		if !graph.UpToDate(index) {
+			t.Fatalf("%s: expected up to date after reload", index)
+		}
+
+		for _, dependency := range []string{"header.html.source", "_.json"} {
+			future := time.Now().Add(time.Hour)
+			if err := os.Chtimes(filepath.Join(*sourceDir, dependency), future, future); err != nil {
+				t.Fatal(err)
+			}
+			if graph.UpToDate(index) {
+				t.Errorf("%s: expected out of date after touching %s", index, dependency)
+			}
+			if _, errs := Transform(s, paths, 1, graph); len(errs) > 0 {
+				t.Fatal(errs[0])
+			}
+		}
+	})
+}
+
+func TestDependencyGraphListings(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"post.template"}`,
+		"post.template": `{{ .content }}`,
+		"post.md":       "{\"title\":\"Old\"}\n---\nPost.\n",
+		"index.html":    `{{ index .files "post.md" "title" }}`,
+		"other.html":    `{{ .title }}`,
+	}
+	withSite(t, files, func() {
+		defer func(i bool) { *incremental = i }(*incremental)
+		*incremental = true
+		graph := NewDependencyGraph()
+		build := func() {
+			s := gather(t)
+			paths, err := TransformPaths(*sourceDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, errs := Transform(s, paths, 1, graph); len(errs) > 0 {
+				t.Fatal(errs[0])
+			}
+		}
+		build()
+
+		post := filepath.Join(*sourceDir, "post.md")
+		Write(post, []byte("{\"title\":\"New\"}\n---\nPost.\n"))
+		future := time.Now().Add(time.Hour)
+		if err := os.Chtimes(post, future, future); err != nil {
+			t.Fatal(err)
+		}
+		if graph.UpToDate(filepath.Join(*sourceDir, "index.html")) {
+			t.Errorf("expected the listing out of date after editing a page it lists")
+		}
+		if !graph.UpToDate(filepath.Join(*sourceDir, "other.html")) {
+			t.Errorf("expected a page that lists nothing to stay up to date")
+		}
+		build()
+		if got := string(Read(filepath.Join(*targetDir, "index.html"))); got != "New" {
+			t.Errorf("expected the listing rebuilt with the new title, got %q", got)
+		}
+	})
+}
+
+func TestListingTemplates(t *testing.T) {
+	for input, expected := range map[string]bool{
+		`{{ range .files.blog }}{{ .title }}{{ end }}`:      true,
+		`{{ with $.prev }}{{ .url }}{{ end }}`:              true,
+		`{{ $p := . }}{{ $p.related }}`:                     true,
+		`{{ index . "files" }}`:                             true,
+		`{{ define "nav" }}{{ .paginator.next }}{{ end }}`:  true,
+		`{{ if .title }}{{ template "x" .pages }}{{ end }}`: true,
+		`{{ .title }} {{/* not .files */}} .files "files"`:  false,
+		`{{ .filesize }} {{ "file" | printf "%s" }}`:        false,
+		`{{ with .site }}{{ .title }}{{ else }}{{ end }}`:   false,
+	} {
+		cached, err := parseTemplate("test.html", "test.html", []byte(input))
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		if cached.listing != expected {
+			t.Errorf("%s: expected listing %v, got %v", input, expected, cached.listing)
+		}
+	}
+}
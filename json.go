@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// UnmarshalJSON parses the passed JSON buffer into v, first with RelaxJSON
+// under -json.relaxed. Syntax and type errors say the line they're on.
+func UnmarshalJSON(buf []byte, v interface{}) error {
+	if *relaxedJSON {
+		buf = RelaxJSON(buf)
+	}
+	err := json.Unmarshal(buf, v)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return fmt.Errorf("line %d: %s", jsonLine(buf, e.Offset), err)
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("line %d: %s", jsonLine(buf, e.Offset), err)
+	}
+	return err
+}
+
+// jsonLine returns the line of the byte at offset in buf, counting from 1.
+func jsonLine(buf []byte, offset int64) int {
+	if offset > int64(len(buf)) {
+		offset = int64(len(buf))
+	}
+	return bytes.Count(buf[:offset], []byte("\n")) + 1
+}
+
+// RelaxJSON returns the passed buffer of relaxed JSON as strict JSON: without
+// // line and /* block */ comments, and without trailing commas in objects and
+// arrays. Everything removed is replaced by spaces, or kept newlines, so that
+// offsets, and lines, are the same in both.
+func RelaxJSON(buf []byte) []byte {
+	out := make([]byte, len(buf))
+	copy(out, buf)
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(out); i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	comma := -1 // a comma that may turn out to be trailing
+	for i := 0; i < len(out); i++ {
+		switch c := out[i]; {
+		case c == '"':
+			comma = -1
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			end := bytes.IndexByte(out[i:], '\n')
+			if end < 0 {
+				end = len(out) - i
+			}
+			blank(i, i+end)
+			i += end - 1
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				return out // unterminated; let the parser complain
+			}
+			blank(i, i+2+end+2)
+			i += 2 + end + 1
+		case c == ',':
+			comma = i
+		case c == '}' || c == ']':
+			if comma >= 0 {
+				out[comma] = ' '
+			}
+			comma = -1
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		default:
+			comma = -1
+		}
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRelaxJSON(t *testing.T) {
+	for input, expected := range map[string]string{
+		`{"a":1}`:                                `{"a":1}`,
+		`{"a":1,}`:                               `{"a":1 }`,
+		"[1, 2,\n]":                              "[1, 2 \n]",
+		"{\"a\":1, // one\n\"b\":2}":             "{\"a\":1,       \n\"b\":2}",
+		`{/* c */"a":"/* not */ // a comment,"}`: `{       "a":"/* not */ // a comment,"}`,
+		`{"a":"say \"hi\",", /* , */ }`:          `{"a":"say \"hi\","          }`,
+		"/* a\nb */{}":                           "    \n    {}",
+	} {
+		if got := string(RelaxJSON([]byte(input))); got != expected {
+			t.Errorf("RelaxJSON(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	defer func(r bool) { *relaxedJSON = r }(*relaxedJSON)
+	buf := []byte("{\n  // the site\n  \"title\": \"T\",\n}\n")
+
+	*relaxedJSON = false
+	m := map[string]interface{}{}
+	if err := UnmarshalJSON(buf, &m); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("strict: expected an error on line 2, got %v", err)
+	}
+
+	*relaxedJSON = true
+	if err := UnmarshalJSON(buf, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["title"] != "T" {
+		t.Errorf("relaxed: expected title T, got %v", m)
+	}
+	if err := UnmarshalJSON([]byte("{\n\"a\": 1\n\"b\": 2}"), &m); err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("relaxed: expected an error on line 3, got %v", err)
+	}
+}
+
+func TestGatherRelaxedJSON(t *testing.T) {
+	files := map[string]string{
+		"_.json": "{\n  \"title\": \"T\", // comment\n}\n",
+	}
+	withSite(t, files, func() {
+		defer func(r bool) { *relaxedJSON = r }(*relaxedJSON)
+		*relaxedJSON = false
+		err := filepath.Walk(*sourceDir, GatherJSON(NewStack()))
+		if err == nil || !strings.Contains(err.Error(), "_.json: parse JSON: line 2:") {
+			t.Errorf("strict: expected the file and line in the error, got %v", err)
+		}
+
+		*relaxedJSON = true
+		s := NewStack()
+		if err := filepath.Walk(*sourceDir, GatherJSON(s)); err != nil {
+			t.Fatal(err)
+		}
+		if title := s.Get(filepath.Join(*sourceDir, "x.html"))["title"]; title != "T" {
+			t.Errorf("relaxed: expected title T, got %v", title)
+		}
+	})
+}
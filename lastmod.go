@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LastModCache maps files to the time of the last commit that changed them,
+// from a single git log of the whole repository, rather than one per file.
+type LastModCache struct {
+	m map[string]time.Time // absolute path: commit time
+}
+
+var (
+	GitLastMods = LastModCache{}
+)
+
+// LoadGitLastMods reads the commit times of every file in the git
+// repositories the dirs are in, for LastMod with -lastmod.git. Without git, or
+// outside a repository, it's empty, and LastMod falls back to modification
+// times.
+func LoadGitLastMods(dirs ...string) LastModCache {
+	c := LastModCache{m: map[string]time.Time{}}
+	roots := map[string]bool{}
+	for _, dir := range dirs {
+		cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+		cmd.Dir = dir
+		root, err := cmd.Output()
+		if err != nil {
+			Warningf("lastmod: git: %s; using modification times", err)
+			continue
+		}
+		if roots[string(root)] {
+			continue // another dir in the same repository
+		}
+		roots[string(root)] = true
+		if err := loadGitLastMods(c, strings.TrimSpace(string(root))); err != nil {
+			Warningf("lastmod: %s; using modification times", err)
+		}
+	}
+	Debugf("lastmod: %d file(s) in git", len(c.m))
+	return c
+}
+
+func loadGitLastMods(c LastModCache, root string) error {
+	cmd := exec.Command("git", "log", "--format=%x00%cI", "--name-only", "--no-renames")
+	var err error
+	if cmd.Dir, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+	buf, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("git log: %s", err)
+	}
+
+	var commit time.Time
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "\x00"):
+			commit, _ = time.Parse(time.RFC3339, line[1:])
+		case line != "" && !commit.IsZero():
+			path := filepath.Join(cmd.Dir, filepath.FromSlash(line))
+			if _, ok := c.m[path]; !ok { // newest first
+				c.m[path] = commit
+			}
+		}
+	}
+	return nil
+}
+
+// LastMod returns the time the file at path was last changed, which pages get
+// under "lastmod": its last commit with -lastmod.git, if it's tracked, and its
+// modification time otherwise.
+func LastMod(path string) time.Time {
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil && *lastmodGit {
+		if t, ok := GitLastMods.m[filepath.Join(dir, filepath.Base(path))]; ok {
+			return t.UTC()
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime().UTC()
+}
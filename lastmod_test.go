@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLastMod(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git")
+	}
+	files := map[string]string{
+		"committed.md": "Committed.\n",
+		"untracked.md": "Untracked.\n",
+	}
+	withSite(t, files, func() {
+		git := func(args ...string) {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = *sourceDir
+			cmd.Env = append(os.Environ(),
+				"GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@example.com", "GIT_AUTHOR_DATE=2015-01-02T03:04:05Z",
+				"GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@example.com", "GIT_COMMITTER_DATE=2015-01-02T03:04:05Z",
+			)
+			if buf, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %s: %s", args, err, buf)
+			}
+		}
+		git("init", "-q")
+		git("add", "committed.md")
+		git("commit", "-q", "-m", "first")
+
+		mtime := time.Date(2020, 6, 7, 8, 9, 10, 0, time.UTC)
+		for name := range files {
+			if err := os.Chtimes(filepath.Join(*sourceDir, name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		defer func(g bool, c LastModCache) { *lastmodGit, GitLastMods = g, c }(*lastmodGit, GitLastMods)
+		for _, tu := range []struct {
+			git      bool
+			name     string
+			expected time.Time
+		}{
+			{false, "committed.md", mtime},
+			{true, "committed.md", time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)},
+			{true, "untracked.md", mtime},
+		} {
+			*lastmodGit = tu.git
+			s, _, err := Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := tu.expected.Format(time.RFC3339)
+			if got := s.Get(filepath.Join(*sourceDir, tu.name))["lastmod"]; got != expected {
+				t.Errorf("%s, -lastmod.git=%v: expected %s, got %v", tu.name, tu.git, expected, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"text/template/parse"
+)
+
+// LayoutsDir returns the absolute path of the layouts directory. Its files
+// are never transformed themselves.
+func LayoutsDir() string {
+	return filepath.Join(*sourceDir, *layoutsDir)
+}
+
+// ParseLayout parses the named layout into the template set of tmpl, after
+// every other layout it invokes with {{ template }}, so that defines in the
+// layout override the blocks of the layouts it extends. Layouts are named by
+// their path relative to the layouts directory, which must have the named one.
+func ParseLayout(tmpl *template.Template, name string, deps *Dependencies) error {
+	if _, err := os.Stat(filepath.Join(LayoutsDir(), filepath.FromSlash(name))); os.IsNotExist(err) {
+		return fmt.Errorf("layout %s doesn't exist in %s", name, LayoutsDir())
+	}
+	parsed := map[string]bool{}
+	var parseLayout func(name string) error
+	parseLayout = func(name string) error {
+		if parsed[name] {
+			return nil
+		}
+		parsed[name] = true
+
+		filename := filepath.Join(LayoutsDir(), filepath.FromSlash(name))
+		cached, err := Templates.Lookup(filename, name, nil)
+		if err != nil {
+			return err
+		}
+		layout, err := cached.Clone()
+		if err != nil {
+			return err
+		}
+		deps.Read(filename)
+		if cached.listing {
+			deps.ReadPages()
+		}
+
+		for _, t := range layout.Templates() {
+			if t.Tree == nil {
+				continue
+			}
+			for _, ref := range templateRefs(t.Tree.Root, nil) {
+				if _, err := os.Stat(filepath.Join(LayoutsDir(), filepath.FromSlash(ref))); err == nil {
+					if err := parseLayout(ref); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return addTemplates(tmpl, layout)
+	}
+	return parseLayout(name)
+}
+
+// addTemplates adds every template defined in src to the template set of
+// dst, replacing any of the same name.
+func addTemplates(dst, src *template.Template) error {
+	for _, t := range src.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if _, err := dst.AddParseTree(t.Name(), t.Tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateRefs appends the names of the templates invoked beneath node.
+func templateRefs(node parse.Node, refs []string) []string {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return refs
+		}
+		for _, child := range n.Nodes {
+			refs = templateRefs(child, refs)
+		}
+	case *parse.IfNode:
+		refs = templateRefs(n.List, templateRefs(n.ElseList, refs))
+	case *parse.RangeNode:
+		refs = templateRefs(n.List, templateRefs(n.ElseList, refs))
+	case *parse.WithNode:
+		refs = templateRefs(n.List, templateRefs(n.ElseList, refs))
+	case *parse.TemplateNode:
+		refs = append(refs, n.Name)
+	}
+	return refs
+}
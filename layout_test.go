@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayouts(t *testing.T) {
+	files := map[string]string{
+		"_layouts/base.html": `<title>{{ .title }}</title>{{ block "main" . }}default{{ end }}`,
+		"_layouts/post.html": `{{ define "main" }}<article>{{ .content }}</article>{{ end }}{{ template "base.html" . }}`,
+		"page.html":          "{\"title\":\"Page\",\"layout\":\"base.html\"}\n---\n{{ define \"main\" }}overridden{{ end }}",
+		"plain.html":         "{\"layout\":\"base.html\"}\n---\n",
+		"post.md":            "{\"title\":\"Post\",\"layout\":\"post.html\"}\n---\n*Hi*\n",
+		"missing.html":       "{\"layout\":\"nope.html\"}\n---\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := 4, len(paths); expected != got {
+			t.Fatalf("expected %d path(s), got %d: %v", expected, got, paths)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) != 1 {
+			t.Errorf("expected 1 error (missing layout), got %v", errs)
+		} else if expected := "layout nope.html doesn't exist"; !strings.Contains(errs[0].Error(), expected) {
+			t.Errorf("expected %q in the error, got %s", expected, errs[0])
+		}
+
+		for name, expected := range map[string]string{
+			"page.html":  "<title>Page</title>overridden",
+			"plain.html": "<title></title>default",
+			"post.html":  "<title>Post</title><article><p><em>Hi</em></p>\n</article>",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Errorf("%s: %s", name, err)
+				continue
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "_layouts")); err == nil {
+			t.Errorf("layouts copied to target")
+		}
+	})
+}
+
+func TestPageTemplate(t *testing.T) {
+	files := map[string]string{
+		"_.json":             `{"template":"default.template"}`,
+		"default.template":   `default:{{ .content }}`,
+		"wide.template":      `wide:{{ .content }}`,
+		"post.md":            "Post.\n",
+		"wide.md":            "{\"template\":\"wide.template\"}\n---\nWide.\n",
+		"missing.md":         "{\"template\":\"nope.template\"}\n---\nMissing.\n",
+		"laidout.md":         "{\"layout\":\"base.html\",\"template\":\"nope.template\"}\n---\nLaid out.\n",
+		"_layouts/base.html": `base:{{ .content }}`,
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		for name, expected := range map[string]string{"post.md": "default:", "wide.md": "wide:"} {
+			buf, _, err := RenderFile(s, filepath.Join(*sourceDir, name), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(buf), expected) {
+				t.Errorf("%s: expected %s template, got %q", name, expected, buf)
+			}
+		}
+		for _, name := range []string{"missing.md", "laidout.md"} {
+			_, _, err := RenderFile(s, filepath.Join(*sourceDir, name), nil)
+			if expected := "template nope.template doesn't exist"; err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: expected %q in the error, got %v", name, expected, err)
+			}
+		}
+	})
+}
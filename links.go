@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// BrokenLink is an internal link, in an href or src attribute of a page in the
+// target directory, to a file that doesn't exist there.
+type BrokenLink struct {
+	Page   string // target file
+	Source string // source file of the page; empty if it has none
+	URL    string
+}
+
+// CheckLinks returns the broken internal links of every HTML file in dir,
+// ordered by page. Links with a scheme or host are external, and skipped, as
+// are links to a fragment of the same page. With a -baseurl, absolute links
+// outside its path are broken.
+func CheckLinks(dir string, pages Pages) ([]BrokenLink, error) {
+	sources := map[string]string{} // target: source
+	for source, metadata := range pages {
+		if target, ok := metadata["target"].(string); ok {
+			sources[target] = source
+		}
+	}
+
+	broken := []BrokenLink{}
+	err := filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := strings.ToLower(filepath.Ext(filename)); info.IsDir() || (ext != ".html" && ext != ".htm") {
+			return nil
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		pageURL := "/" + filepath.ToSlash(Relative(dir, filename))
+		for _, link := range pageLinks(html.NewTokenizer(f)) {
+			if !linkExists(dir, pageURL, link) {
+				broken = append(broken, BrokenLink{Page: filename, Source: sources[filename], URL: link})
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(broken, func(i, j int) bool { return broken[i].Page < broken[j].Page })
+	return broken, err
+}
+
+// pageLinks returns the values of every href and src attribute in the
+// tokenized document.
+func pageLinks(z *html.Tokenizer) []string {
+	links := []string{}
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for _, attr := range z.Token().Attr {
+				if attr.Key == "href" || attr.Key == "src" {
+					links = append(links, strings.TrimSpace(attr.Val))
+				}
+			}
+		}
+	}
+}
+
+// linkExists returns true if the link on the page at pageURL (within the
+// site) is external, or names a file, or a directory with an index.html, in
+// dir.
+func linkExists(dir, pageURL, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return true // external, or this page
+	}
+
+	p := u.Path
+	if strings.HasPrefix(p, "/") {
+		if base := BasePath(); base != "" && p != base && !strings.HasPrefix(p, base+"/") {
+			return false // outside the site
+		}
+		p = SitePath(p)
+	} else {
+		p = path.Join(path.Dir(pageURL), p)
+	}
+
+	filename := filepath.Join(dir, filepath.FromSlash(p))
+	info, err := os.Stat(filename)
+	if err == nil && info.IsDir() {
+		_, err = os.Stat(filepath.Join(filename, "index.html"))
+	}
+	return err == nil
+}
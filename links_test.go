@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	files := map[string]string{
+		"index.html": `<a href="/about.html">ok</a> <a href="blog/">ok</a> <img src="missing.png">` +
+			`<a href="https://example.com/x">external</a> <a href="#top">fragment</a> <a href="mailto:a@b.c">mail</a>`,
+		"about.html":      `<link href="css/site.css?v=1"> <a href="index.html#x">ok</a> <a href="/nowhere/">broken</a>`,
+		"css/site.css":    `body {}`,
+		"blog/index.html": `<a href="../about.html">ok</a> <a href="../missing.html">broken</a>`,
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages, errs := Transform(s, paths, 1, NewDependencyGraph())
+		if len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+
+		broken, err := CheckLinks(*targetDir, pages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []BrokenLink{
+			{filepath.Join(*targetDir, "about.html"), filepath.Join(*sourceDir, "about.html"), "/nowhere/"},
+			{filepath.Join(*targetDir, "blog", "index.html"), filepath.Join(*sourceDir, "blog", "index.html"), "../missing.html"},
+			{filepath.Join(*targetDir, "index.html"), filepath.Join(*sourceDir, "index.html"), "missing.png"},
+		}
+		if fmt.Sprint(expected) != fmt.Sprint(broken) {
+			t.Errorf("expected %v, got %v", expected, broken)
+		}
+
+		defer func(b string) { *baseURL = b }(*baseURL)
+		*baseURL = "https://example.com/docs/"
+		for link, ok := range map[string]bool{
+			"/docs/about.html": true,
+			"/docs/":           true,
+			"/about.html":      false,
+			"about.html":       true,
+		} {
+			if got := linkExists(*targetDir, "/index.html", link); ok != got {
+				t.Errorf("-baseurl: %s: expected %v, got %v", link, ok, got)
+			}
+		}
+	})
+}
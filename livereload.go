@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+var (
+	LiveReloadPath   = "/.grender/livereload"
+	LiveReloadScript = []byte(`<script>
+(function() {
+	var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+	var ws = new WebSocket(scheme + location.host + "` + LiveReloadPath + `");
+	ws.onmessage = function() { location.reload(); };
+})();
+</script>
+`)
+)
+
+// LiveReload pushes a reload message to every connected browser whenever
+// Reload is called. It serves the WebSocket endpoint at LiveReloadPath, and
+// Inject wraps a handler so that served HTML pages connect to it.
+type LiveReload struct {
+	mtx     sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func NewLiveReload() *LiveReload {
+	return &LiveReload{
+		clients: map[chan struct{}]struct{}{},
+	}
+}
+
+// Reload tells every connected browser to reload.
+func (lr *LiveReload) Reload() {
+	lr.mtx.Lock()
+	defer lr.mtx.Unlock()
+
+	Debugf("live reload: notifying %d client(s)", len(lr.clients))
+	for c := range lr.clients {
+		select {
+		case c <- struct{}{}:
+		default: // a reload is already pending
+		}
+	}
+}
+
+func (lr *LiveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	websocket.Handler(lr.serve).ServeHTTP(w, r)
+}
+
+func (lr *LiveReload) serve(ws *websocket.Conn) {
+	c := make(chan struct{}, 1)
+	lr.mtx.Lock()
+	lr.clients[c] = struct{}{}
+	lr.mtx.Unlock()
+	defer func() {
+		lr.mtx.Lock()
+		delete(lr.clients, c)
+		lr.mtx.Unlock()
+	}()
+
+	// The browser never sends anything; reading just detects the disconnect.
+	closed := make(chan struct{})
+	go func() {
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-c:
+			if err := websocket.Message.Send(ws, "reload"); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Inject wraps the passed handler, inserting LiveReloadScript before the
+// closing body tag of every HTML response.
+func (lr *LiveReload) Inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The script can't be injected into compressed pages.
+		r = r.Clone(r.Context())
+		r.Header.Del("Accept-Encoding")
+
+		iw := &injectingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(iw, r)
+		if !iw.html {
+			return
+		}
+
+		body := iw.buf.Bytes()
+		if iw.status == http.StatusOK {
+			if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i >= 0 {
+				body = append(body[:i:i], append(LiveReloadScript, body[i:]...)...)
+			} else {
+				body = append(body, LiveReloadScript...)
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(iw.status)
+		w.Write(body)
+	})
+}
+
+// injectingWriter buffers HTML responses, so that they can be modified before
+// they're sent. Other responses pass straight through.
+type injectingWriter struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	status      int
+	html        bool
+	wroteHeader bool
+}
+
+func (w *injectingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		w.html, w.status = true, status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *injectingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.html {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
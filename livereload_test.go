@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLiveReloadInject(t *testing.T) {
+	handler := NewLiveReload().Inject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Length", "36")
+			io.WriteString(w, "<html><body>content</body></html>")
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css; charset=utf-8")
+			io.WriteString(w, "body {}")
+		}
+	}))
+
+	for path, expected := range map[string]string{
+		"/index.html": "<html><body>content" + string(LiveReloadScript) + "</body></html>",
+		"/style.css":  "body {}",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := rec.Body.String(); expected != got {
+			t.Errorf("%s: expected %q, got %q", path, expected, got)
+		}
+		if path == "/index.html" {
+			if got := rec.Header().Get("Content-Length"); strconv.Itoa(len(expected)) != got {
+				t.Errorf("%s: expected Content-Length %d, got %s", path, len(expected), got)
+			}
+		}
+	}
+}
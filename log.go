@@ -24,6 +24,10 @@ func Warningf(format string, args ...interface{}) {
 	log.Printf("Warning: "+format, args...)
 }
 
+func Errorf(format string, args ...interface{}) {
+	log.Printf("Error: "+format, args...)
+}
+
 func Fatalf(format string, args ...interface{}) {
 	log.Fatalf("Fatal: "+format, args...)
 }
@@ -2,77 +2,425 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"flag"
+	"fmt"
 	"html/template"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/peterbourgon/mergemap"
 	"github.com/russross/blackfriday"
 )
 
 var (
-	FrontSeparator = []byte("---\n")
-)
-
-var (
-	debug     = flag.Bool("debug", false, "print debug information")
-	sourceDir = flag.String("source", "src", "path to site source (input)")
-	targetDir = flag.String("target", "tgt", "path to site target (output)")
-	globalKey = flag.String("global.key", "files", "template node name for per-file metadata")
+	debug           = flag.Bool("debug", false, "print debug information")
+	configFile      = flag.String("config", ConfigFile, "JSON file of flag values; flags on the commandline override it")
+	sourceDir       = flag.String("source", "src", "path to site source (input), or a comma-separated list of them, later ones overriding earlier ones")
+	targetDir       = flag.String("target", "tgt", "path to site target (output)")
+	siteFile        = flag.String("site", "site.json", "JSON file of metadata for every page, if it exists")
+	envStrict       = flag.Bool("env.strict", false, "fail on ${VAR} in metadata when VAR isn't set, rather than expanding it to nothing")
+	strictKeys      = flag.Bool("strict.keys", false, "fail on template keys missing from the metadata, rather than rendering nothing")
+	globalKey       = flag.String("global.key", "files", "template node name for per-file metadata")
+	globalFlat      = flag.String("global.flat", "", "template node name for a list of every page's metadata, besides the Global Key")
+	dryRun          = flag.Bool("dry-run", false, "build, but only log the files that would be written or deleted, and exit")
+	buildOnly       = flag.Bool("build", false, "build the site and exit, without serving it")
+	serveOnly       = flag.Bool("serve", false, "serve the target directory, without building it first")
+	drafts          = flag.Bool("drafts", false, "render pages with draft metadata")
+	future          = flag.Bool("future", false, "render pages dated in the future")
+	clean           = flag.Bool("clean", false, "remove the contents of the target directory before building")
+	incremental     = flag.Bool("incremental", false, "only transform files whose target is older than their dependencies")
+	jobs            = flag.Int("jobs", runtime.NumCPU(), "number of files to transform concurrently")
+	watch           = flag.Bool("watch", false, "rebuild when files in the source directory change")
+	livereload      = flag.Bool("livereload", false, "reload served pages in the browser when the target changes")
+	feedFormat      = flag.String("feed.format", "rss", "comma-separated feed formats to write (rss, atom, jsonfeed)")
+	markdownEngine  = flag.String("markdown.engine", "blackfriday", "engine which renders .md files")
+	highlightStyle  = flag.String("highlight.style", "github", "color theme for fenced code blocks (empty disables highlighting)")
+	highlightInline = flag.Bool("highlight.inline", true, "highlight with inline styles, rather than classes (see "+HighlightCSSFile+")")
+	anchorSymbol    = flag.String("anchor.symbol", "#", "text of the permalinks appended to Markdown headings (empty disables them)")
+	sanitize        = flag.Bool("sanitize", false, "strip HTML outside an allowlist from rendered Markdown, unless a page sets \"sanitize\" false")
+	sanitizeAllow   = flag.String("sanitize.allow", "", "comma-separated elements, like video, or elements with attributes, like iframe[src width], to allow besides the defaults")
+	relaxedJSON     = flag.Bool("json.relaxed", false, "allow comments and trailing commas in JSON metadata")
+	searchIndex     = flag.String("search.index", "", "write a JSON search index of the pages to this path in the target directory")
+	searchFields    = flag.String("search.fields", "title,url,tags,content", "comma-separated page fields in the search index")
+	manifestFile    = flag.String("manifest", "", "write a JSON manifest of the output files to this path in the target directory")
+	sepFootnotes    = flag.Bool("footnotes.separate", false, "leave Markdown footnotes out of content, for templates to place with footnotes")
+	emoji           = flag.Bool("emoji", false, "replace :name: codes in Markdown with emoji, unless a page sets \"emoji\" false")
+	anchorClass     = flag.String("anchor.class", "heading-anchor", "class of the permalinks appended to Markdown headings")
+	summaryWords    = flag.Int("summary.words", 50, "number of words in automatic page summaries")
+	relatedCount    = flag.Int("related.count", 5, "maximum number of pages in every page's related metadata, ranked by shared tags")
+	readingWPM      = flag.Int("reading.wpm", 200, "reading speed, in words per minute, for page reading times")
+	indexNames      = flag.String("index.names", "index", "comma-separated names, without extension, of pages written to their directory's index.html")
+	prettyURLs      = flag.Bool("pretty-urls", false, "write pages to name/index.html, with url name/, rather than to name.html")
+	permalink       = flag.String("permalink", "", "pattern for blog entry targets, e.g. /:year/:month/:slug/ (default yyyy/mm/dd/filename)")
+	redirectFormat  = flag.String("redirect.format", "html", "how to write blog entry redirects: html (meta refresh pages), netlify, nginx or apache")
+	layoutsDir      = flag.String("layouts", "_layouts", "directory of layout templates, relative to the source directory")
+	partialsDir     = flag.String("partials", "_partials", "directory of partial templates, relative to the source directory")
+	templateExts    = flag.String("template.ext", "", "comma-separated extensions of other files to render like .html pages, e.g. .xml,.txt")
+	ignorePatterns  = patternsVar("ignore", "comma-separated glob patterns of source files and directories to skip, e.g. node_modules/**,*~ (repeatable)")
+	staticDir       = flag.String("static", "", "directory whose files are copied verbatim into the target directory, after the build")
+	dataDir         = flag.String("data", "_data", "directory of JSON, YAML and TOML files for every template's "+DataKey+" key, relative to the source directory")
+	shortcodesDir   = flag.String("shortcodes", "_shortcodes", "directory of shortcode templates, relative to the source directory")
+	minifyOutput    = flag.Bool("minify", false, "minify HTML pages, and CSS and JS files")
+	fingerprint     = flag.Bool("fingerprint", false, "add a hash of their contents to the names of CSS and JS files")
+	precompress     = flag.String("precompress", "", "comma-separated formats to precompress text files in (gzip, br)")
+	precompressMin  = flag.Int64("precompress.min", 1024, "size in bytes below which files aren't precompressed")
+	dirListing      = flag.Bool("dir.listing", false, "serve listings of directories without an index.html")
+	tlsCert         = flag.String("tls.cert", "", "certificate file, to serve HTTPS (with -tls.key)")
+	tlsKey          = flag.String("tls.key", "", "private key file, to serve HTTPS (with -tls.cert)")
+	tlsSelf         = flag.Bool("tls.self", false, "serve HTTPS with a new self-signed certificate")
+	robots          = flag.Bool("robots", false, "write "+RobotsFile+", unless the source has one")
+	checkLinks      = flag.Bool("checklinks", false, "warn about internal links to files that aren't in the target directory")
+	lastmodGit      = flag.Bool("lastmod.git", false, "take the lastmod of pages from their last git commit, rather than their modification time")
+	blogDates       = flag.String("blog.dates", "2006-1-2-", "comma-separated layouts of the date that starts blog entry filenames, tried in order")
+	termCountKeys   = flag.String("termcount.keys", "tags", "comma-separated metadata keys whose terms are counted under termcount")
+	strictTargets   = flag.Bool("targets.strict", false, "fail the build when two source files are written to the same target file")
+	strictLinks     = flag.Bool("checklinks.strict", false, "fail the build on broken internal links (implies -checklinks)")
+	baseURL         = flag.String("baseurl", "", "URL the site is hosted at, e.g. https://example.com/blog/, whose path prefixes every url")
+	languagesList   = flag.String("languages", "", "comma-separated languages of a multilingual site, e.g. en,es; the first is rendered at the root")
+	frontSep        = flag.String("front.separator", "---\n", "line separating JSON or YAML front matter from content")
 )
 
 func init() {
 	flag.Parse()
 
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+	if err := LoadConfig(flag.CommandLine, *configFile, explicit); err != nil {
+		Fatalf("config: %s", err)
+	}
+	if err := SplitSources(); err != nil {
+		Fatalf("%s", err)
+	}
+
 	var err error
-	for _, s := range []*string{sourceDir, targetDir} {
+	for _, s := range []*string{sourceDir, targetDir, siteFile, staticDir} {
+		if *s == "" || *s == StdoutTarget {
+			continue // -site or -static disabled, or -target to stdout
+		}
 		if *s, err = filepath.Abs(*s); err != nil {
 			Fatalf("%s", err)
 		}
 	}
+
+	if _, ok := RedirectFormats[*redirectFormat]; !ok && *redirectFormat != "html" {
+		Fatalf("unknown -redirect.format '%s'", *redirectFormat)
+	}
+
+	if _, ok := MarkdownEngines[*markdownEngine]; !ok {
+		Fatalf("unknown -markdown.engine '%s'", *markdownEngine)
+	}
+	for i, option := range MarkdownHTMLOptions {
+		if option.Bit == HTMLEmoji {
+			MarkdownHTMLOptions[i].Default = *emoji
+		}
+	}
+	SanitizeAllow(*sanitizeAllow)
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		Fatalf("-tls.cert and -tls.key go together")
+	}
+
+	if *readingWPM <= 0 {
+		Fatalf("-reading.wpm must be positive")
+	}
+
+	if err := SetFrontSeparator(*frontSep); err != nil {
+		Fatalf("-front.separator: %s", err)
+	}
 }
 
 func main() {
+	if files, ok, err := SourceFiles(*sourceDir); err != nil && ok {
+		Fatalf("%s", err)
+	} else if ok {
+		if err := RenderFiles(files, os.Stdout); err != nil {
+			Fatalf("%s", err)
+		}
+		return
+	}
+
+	// Neither (or both) of -build and -serve means build, then serve.
+	if *serveOnly && !*buildOnly && !*dryRun {
+		Debugf("serve only; skipping build")
+	} else if err := Build(); err != nil {
+		Fatalf("%s", err)
+	}
+	if (*buildOnly && !*serveOnly) || *dryRun {
+		return
+	}
+
+	if *watch {
+		go func() {
+			// One watcher over every source directory, so rebuilds never overlap.
+			if err := Watch(SourceDirs(), 250*time.Millisecond, Rebuild); err != nil {
+				Errorf("watch: %s", err)
+			}
+		}()
+	}
+
+	//host site
+	var handler http.Handler = ServeETags(*targetDir, http.FileServer(http.Dir(*targetDir)))
+	if !*dirListing {
+		handler = HideListings(*targetDir, handler)
+	}
+	handler = ServeNotFound(*targetDir, handler)
+	handler = ServePrecompressed(*targetDir, handler)
+	if *livereload {
+		lr := NewLiveReload()
+		go func() {
+			if err := Watch([]string{*targetDir}, 100*time.Millisecond, func([]string) { lr.Reload() }); err != nil {
+				Errorf("live reload: %s", err)
+			}
+		}()
+		http.Handle(LiveReloadPath, lr)
+		handler = lr.Inject(handler)
+	}
+	http.Handle("/", handler)
+	switch {
+	case *tlsSelf:
+		cert, err := SelfSignedCertificate()
+		if err != nil {
+			Fatalf("self-signed certificate: %s", err)
+		}
+		server := &http.Server{Addr: ":8080", TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}}}
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	case *tlsCert != "":
+		log.Fatal(http.ListenAndServeTLS(":8080", *tlsCert, *tlsKey, nil))
+	default:
+		log.Fatal(http.ListenAndServe(":8080", nil))
+	}
+
+}
+
+// Build gathers metadata from the source directory, and transforms every
+// source file into the target directory. With -clean, the target directory is
+// emptied first.
+func Build() error {
+	removed, written, bundles = nil, map[string]bool{}, map[string][]string{} // by a previous build
+	if *clean {
+		if err := Clean(*targetDir); err != nil {
+			return fmt.Errorf("clean: %s", err)
+		}
+	}
+
+	s, paths, err := Gather()
+	if err != nil {
+		return err
+	}
+	graph := NewDependencyGraph()
+	if *incremental {
+		graph = LoadDependencyGraph(filepath.Join(*targetDir, DependencyFile))
+		if !graph.Covers(paths) {
+			Debugf("source files changed since the last build")
+			graph = NewDependencyGraph()
+		}
+	}
+	pages, errs := Transform(s, paths, *jobs, graph)
+	if *incremental {
+		graph.Save(filepath.Join(*targetDir, DependencyFile))
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			Errorf("%s", err)
+		}
+		return fmt.Errorf("%d file(s) failed to render", len(errs))
+	}
+	if err := WriteHighlightCSS(); err != nil {
+		return fmt.Errorf("highlight: %s", err)
+	}
+	if err := WriteFeeds(s, paths, pages); err != nil {
+		return fmt.Errorf("feed: %s", err)
+	}
+	if err := WriteRedirects(s, paths); err != nil {
+		return fmt.Errorf("redirects: %s", err)
+	}
+	if err := WriteTaxonomies(s, paths); err != nil {
+		return err
+	}
+	if err := WriteRobots(s); err != nil {
+		return fmt.Errorf("robots: %s", err)
+	}
+	if err := WriteSearchIndex(s, paths, pages); err != nil {
+		return fmt.Errorf("search: %s", err)
+	}
+	if err := CopyStatic(*staticDir, graph); err != nil {
+		return fmt.Errorf("static: %s", err)
+	}
+	if err := WriteManifest(s, graph); err != nil {
+		return fmt.Errorf("manifest: %s", err)
+	}
+	if (*checkLinks || *strictLinks) && !*dryRun {
+		broken, err := CheckLinks(*targetDir, pages)
+		if err != nil {
+			return fmt.Errorf("check links: %s", err)
+		}
+		for _, b := range broken {
+			page := Relative(*targetDir, b.Page)
+			if b.Source != "" {
+				page += " (from " + SourceRelative(b.Source) + ")"
+			}
+			Warningf("%s: broken link %s", page, b.URL)
+		}
+		if *strictLinks && len(broken) > 0 {
+			return fmt.Errorf("%d broken link(s)", len(broken))
+		}
+	}
+	if err := Precompress(*targetDir); err != nil {
+		return fmt.Errorf("precompress: %s", err)
+	}
+	return nil
+}
+
+// GlobalMetadata returns the metadata visible to every page: the Global Key
+// map m, mirroring the source directory, and with -global.flat, the metadata
+// of every page in it as one list, newest first.
+func GlobalMetadata(m map[string]interface{}) map[string]interface{} {
+	global := map[string]interface{}{*globalKey: m}
+	if *globalFlat != "" {
+		global[*globalFlat] = PagesIn(m, "")
+	}
+	return global
+}
+
+// Gather reads the metadata of the source directory into a stack, and returns
+// it with the source files to transform.
+func Gather() (*Stack, []string, error) {
+	rules, err := LoadIgnoreRules(filepath.Join(*sourceDir, IgnoreFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ignore: %s", err)
+	}
+	ignoreRules = rules
 
-	//build site
 	m := map[string]interface{}{}
 	s := NewStack()
-	filepath.Walk(*sourceDir, GatherJSON(s))
-	filepath.Walk(*sourceDir, GatherSource(s, m))
-	s.Add("", map[string]interface{}{*globalKey: m})
-	filepath.Walk(*sourceDir, Transform(s))
+	if err := GatherSite(s, *siteFile); err != nil {
+		return nil, nil, fmt.Errorf("gather site: %s", err)
+	}
+	data, files, err := LoadData(DataDir())
+	if err != nil {
+		return nil, nil, fmt.Errorf("data: %s", err)
+	}
+	dataFiles = files
+	s.Add("", map[string]interface{}{DataKey: data})
+	for _, dir := range SourceDirs() {
+		if err := filepath.Walk(dir, GatherJSON(s)); err != nil {
+			return nil, nil, fmt.Errorf("gather JSON: %s", err)
+		}
+	}
+	if *lastmodGit {
+		GitLastMods = LoadGitLastMods(SourceDirs()...)
+	}
+	for _, dir := range SourceDirs() {
+		if err := filepath.Walk(dir, GatherSource(s, m)); err != nil {
+			return nil, nil, fmt.Errorf("gather source: %s", err)
+		}
+	}
+	paths, err := TransformPaths(SourceDirs()...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transform: %s", err)
+	}
+	s.Add("", GlobalMetadata(m))
+	s.Add("", map[string]interface{}{BuildKey: BuildMetadata()}) // not in the pages' own metadata
+	s.Add("", map[string]interface{}{TermCountKey: TermCounts(s, paths)})
+	LinkNeighbors(s, paths)
+	LinkRelated(s, paths)
+	LinkTranslations(s, paths)
+	Fingerprints = FingerprintAssets(paths)
+	if err := CheckTargets(s, paths); err != nil {
+		return nil, nil, fmt.Errorf("targets: %s", err)
+	}
+	return s, paths, nil
+}
 
-	//host site
-	fs := http.FileServer(http.Dir(*targetDir))
-	http.Handle("/", fs)
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// Rebuild runs Build in response to the passed source files changing. Hidden
+// files (like editor swap files), other than the IgnoreFile, and files in the
+// target directory don't trigger a rebuild.
+func Rebuild(changed []string) {
+	triggers := []string{}
+	for _, name := range changed {
+		if base := filepath.Base(name); strings.HasPrefix(base, ".") && base != IgnoreFile {
+			continue
+		}
+		if name == *targetDir || strings.HasPrefix(name, *targetDir+string(filepath.Separator)) {
+			continue
+		}
+		triggers = append(triggers, SourceRelative(name))
+	}
+	if len(triggers) <= 0 {
+		return
+	}
 
+	Infof("rebuilding: %s changed", strings.Join(triggers, ", "))
+	if err := Build(); err != nil {
+		Errorf("rebuild: %s", err)
+		return
+	}
+	Infof("rebuilt")
 }
 
-// splitMetadata splits the input buffer on FrontSeparator. It returns a byte-
-// slice suitable for unmarshaling into metadata, if it exists, and the
-// remainder of the input buffer.
-func splitMetadata(buf []byte) ([]byte, []byte) {
-	split := bytes.SplitN(buf, FrontSeparator, 2)
-	if len(split) == 2 {
-		return split[0], split[1]
+// GatherSite adds the metadata in the given JSON file, if it exists, as the
+// global metadata every page inherits, below that of any .json file.
+func GatherSite(s StackReadWriter, filename string) error {
+	if filename == "" {
+		return nil
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		Debugf("%s doesn't exist; no site metadata", filename)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	metadata := map[string]interface{}{}
+	if err := UnmarshalJSON(buf, &metadata); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
 	}
-	return []byte{}, buf
+	if metadata, err = Interpolate(metadata); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	s.Add("", metadata)
+	Debugf("%s gathered (%d element(s))", filename, len(metadata))
+	return nil
 }
 
 func GatherJSON(s StackReadWriter) filepath.WalkFunc {
 	Debugf("gathering JSON")
-	return func(path string, info os.FileInfo, _ error) error {
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			Debugf("%s: walk error: %s", path, err)
+			return err
+		}
+		if Ignored(path, info.IsDir()) {
+			return skipIgnored(path, info)
+		}
 		if info.IsDir() {
+			if path == filepath.Join(SourceDirOf(path), *dataDir) {
+				return filepath.SkipDir
+			}
 			return nil // descend
 		}
 		switch filepath.Ext(path) {
 		case ".json":
-			metadata := ParseJSON(Read(path))
+			if IsSidecar(path) {
+				Debugf("%s is a sidecar; gathered with its file", path)
+				return nil
+			}
+			metadata := map[string]interface{}{}
+			if err := UnmarshalJSON(Read(path), &metadata); err != nil {
+				return fmt.Errorf("%s: parse JSON: %s", path, err)
+			}
+			metadata, err := Interpolate(metadata)
+			if err != nil {
+				return fmt.Errorf("%s: %s", path, err)
+			}
 			s.Add(filepath.Dir(path), metadata)
 			Debugf("%s gathered (%d element(s))", path, len(metadata))
 		}
@@ -82,192 +430,695 @@ func GatherJSON(s StackReadWriter) filepath.WalkFunc {
 
 func GatherSource(s StackReadWriter, m map[string]interface{}) filepath.WalkFunc {
 	Debugf("gathering source")
-	return func(path string, info os.FileInfo, _ error) error {
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			Debugf("%s: walk error: %s", path, err)
+			return err
+		}
+		if Ignored(path, info.IsDir()) {
+			return skipIgnored(path, info)
+		}
 		if info.IsDir() {
+			if IsSiteDir(path) {
+				return filepath.SkipDir
+			}
 			return nil // descend
 		}
-		switch filepath.Ext(path) {
+		if _, ok := OverriddenBy(path); ok {
+			return nil // logged by TransformPaths
+		}
+		switch PageExt(path) {
 		case ".html":
+			if IsBinary(Read(path)) {
+				return nil // not a page; TransformFile copies it
+			}
 			defaultMetadata := map[string]interface{}{
 				"source":  path,
 				"target":  TargetFileFor(path, filepath.Ext(path)),
-				"url":     "/" + Relative(*targetDir, TargetFileFor(path, filepath.Ext(path))),
+				"url":     PageURL(TargetFileFor(path, filepath.Ext(path))),
 				"sortkey": filepath.Base(path),
+				"lastmod": LastMod(path).Format(time.RFC3339),
 			}
 			fileMetadata := map[string]interface{}{}
-			fileMetadataBuf, _ := splitMetadata(Read(path))
+			fileMetadataBuf, _, frontMatter := splitMetadata(Read(path))
 			if len(fileMetadataBuf) > 0 {
-				fileMetadata = ParseJSON(fileMetadataBuf)
+				if fileMetadata, err = frontMatter.Parse(fileMetadataBuf); err != nil {
+					return fmt.Errorf("%s: %s", path, err)
+				}
+			}
+			sidecarMetadata, err := SidecarMetadata(path)
+			if err != nil {
+				return err
+			}
+			fileMetadata = mergemap.Merge(sidecarMetadata, fileMetadata) // front matter wins
+			if fileMetadata, err = Interpolate(fileMetadata); err != nil {
+				return fmt.Errorf("%s: %s", path, err)
 			}
 			inheritedMetadata := s.Get(path)
 			metadata := mergemap.Merge(defaultMetadata, mergemap.Merge(inheritedMetadata, fileMetadata))
+			if lang, _ := PageLanguage(path, metadata); lang != "" {
+				metadata["lang"] = lang
+			}
+			if target := pageTarget(path, metadata); target != defaultMetadata["target"] {
+				metadata["target"], metadata["url"] = target, PageURL(target)
+			}
 			s.Add(path, metadata)
-			SplatInto(m, Relative(*sourceDir, path), metadata)
+			if Unpublished(metadata) {
+				Debugf("%s unpublished; not in %s", path, *globalKey)
+			} else {
+				SplatInto(m, SourceRelative(path), metadata)
+			}
 			Debugf("%s gathered (%d element(s))", path, len(metadata))
 
 		case ".md":
+			fileMetadata := map[string]interface{}{}
+			fileMetadataBuf, _, frontMatter := splitMetadata(Read(path))
+			if len(fileMetadataBuf) > 0 {
+				if fileMetadata, err = frontMatter.Parse(fileMetadataBuf); err != nil {
+					return fmt.Errorf("%s: %s", path, err)
+				}
+			}
+			sidecarMetadata, err := SidecarMetadata(path)
+			if err != nil {
+				return err
+			}
+			fileMetadata = mergemap.Merge(sidecarMetadata, fileMetadata) // front matter wins
+			if fileMetadata, err = Interpolate(fileMetadata); err != nil {
+				return fmt.Errorf("%s: %s", path, err)
+			}
+			inheritedMetadata := s.Get(path)
+
+			// a page in another language renders like the same page without
+			// the language suffix, in the language's directory
+			lang, page := PageLanguage(path, inheritedMetadata, fileMetadata)
+			slug := stringValue(fileMetadata["slug"])
+			target := PageFile(LanguagePath(TargetFileFor(SlugPath(page, slug), ".html"), lang))
 			defaultMetadata := map[string]interface{}{
 				"source":  path,
-				"target":  TargetFileFor(path, ".html"),
-				"url":     "/" + Relative(*targetDir, TargetFileFor(path, ".html")),
+				"target":  target,
+				"url":     PageURL(target),
 				"sortkey": filepath.Base(path),
+				"lastmod": LastMod(path).Format(time.RFC3339),
+			}
+			if lang != "" {
+				defaultMetadata["lang"] = lang
 			}
-			if blogTuple, ok := NewBlogTuple(path, ".html"); ok {
-				baseDir := filepath.Join(*targetDir, Relative(*sourceDir, filepath.Dir(path)))
+			if blogTuple, ok := NewBlogTuple(page, ".html"); ok {
+				if slug != "" {
+					blogTuple.Filename = slug + ".html"
+				}
+				baseDir := LanguagePath(filepath.Join(*targetDir, SourceRelative(filepath.Dir(page))), lang)
 				defaultMetadata["title"] = blogTuple.Title
 				defaultMetadata["date"] = blogTuple.DateString()
 				defaultMetadata["target"] = blogTuple.TargetFileFor(baseDir)
-				defaultMetadata["url"] = "/" + Relative(*targetDir, blogTuple.TargetFileFor(baseDir))
+				defaultMetadata["url"] = blogTuple.URLFor(baseDir)
 				defaultMetadata["redirects"] = blogTuple.RedirectFromURLs(baseDir)
 			}
-			fileMetadata := map[string]interface{}{}
-			fileMetadataBuf, _ := splitMetadata(Read(path))
-			if len(fileMetadataBuf) > 0 {
-				fileMetadata = ParseJSON(fileMetadataBuf)
-			}
-			inheritedMetadata := s.Get(path)
 			metadata := mergemap.Merge(defaultMetadata, mergemap.Merge(inheritedMetadata, fileMetadata))
 			s.Add(path, metadata)
-			SplatInto(m, Relative(*sourceDir, path), metadata)
+			if Unpublished(metadata) {
+				Debugf("%s unpublished; not in %s", path, *globalKey)
+			} else {
+				SplatInto(m, SourceRelative(path), metadata)
+			}
 			Debugf("%s gathered (%d element(s))", path, len(metadata))
 		}
 		return nil
 	}
 }
 
-func Transform(s StackReader) filepath.WalkFunc {
-	Debugf("transforming")
-	return func(path string, info os.FileInfo, _ error) error {
+// TransformPaths walks the source directories, and returns the path of every
+// file that Transform should render, in walk order. Files overridden by a
+// later source directory are left out.
+func TransformPaths(roots ...string) ([]string, error) {
+	paths := []string{}
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			Debugf("%s: walk error: %s", path, err)
+			return err
+		}
+		if Ignored(path, info.IsDir()) {
+			return skipIgnored(path, info)
+		}
 		if strings.HasPrefix(filepath.Base(path), ".") {
 			Debugf("skip hidden file %s", path)
 			return nil
 		}
 		if info.IsDir() {
+			if IsSiteDir(path) {
+				Debugf("skip template directory %s", path)
+				return filepath.SkipDir
+			}
 			Debugf("descending into %s", path)
 			return nil // descend
 		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(path); err == nil && target.IsDir() {
+				Warningf("%s: symlink to a directory; skipping", path)
+				return nil
+			}
+		}
+		if other, ok := OverriddenBy(path); ok {
+			Infof("%s overrides %s", other, path)
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	}
+	for _, root := range roots {
+		if err := filepath.Walk(root, walkFn); err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
 
-		Debugf("Transforming %s", path)
-		switch filepath.Ext(path) {
-		case ".json":
-			Debugf("%s ignored for transformation", path)
+// Transform renders every passed source file into the target directory,
+// spread over the given number of concurrent jobs. Files that fail to render
+// are skipped, and their errors are returned in the order of paths, so that
+// one broken file doesn't prevent the rest of the site from being built.
+//
+// The dependencies of every transformed file are recorded in the graph. In
+// incremental mode, files which the graph reports as up to date are skipped.
+//
+// Transform returns the final metadata of every rendered page, for the passes
+// that run after it.
+//
+// Markdown content is rendered first, once, for the summaries that Summarize
+// adds to s; the pages then reuse it.
+//
+// The workers share s, which is safe as long as Get never modifies it, as
+// Stack.Get doesn't.
+func Transform(s StackReadWriter, paths []string, jobs int, graph *DependencyGraph) (Pages, []error) {
+	Debugf("transforming")
+	Contents = NewContentCache()
+	defer func() { Contents = nil }()
+	summaries := Summarize(s, paths, jobs, graph)
 
-		case ".html":
-			// read
-			_, contentBuf := splitMetadata(Read(path))
+	results := make([]error, len(paths))
+	metadatas := make([]map[string]interface{}, len(paths))
+	Parallel(jobs, len(paths), func(index int) {
+		path := paths[index]
+		if *incremental && graph.UpToDate(path) {
+			Debugf("%s up to date", path)
+			return
+		}
+		deps := &Dependencies{}
+		if metadatas[index], results[index] = TransformFile(s, path, deps); results[index] != nil {
+			deps = nil
+		} else if IsListing(deps) {
+			for _, page := range paths {
+				if ext := PageExt(page); ext == ".html" || ext == ".md" {
+					deps.Read(page) // their metadata may be in it
+				}
+			}
+		}
+		if summary, ok := summaries[path]; ok {
+			deps.Summarized(summary)
+		}
+		graph.Set(path, deps)
+	})
 
-			// render
-			outputBuf := RenderTemplate(path, contentBuf, s.Get(path))
+	pages, errs := Pages{}, []error{}
+	for index, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if metadatas[index] != nil {
+			pages[paths[index]] = metadatas[index]
+		}
+	}
+	return pages, errs
+}
+
+// PageMetadata returns the metadata in s of the page at path, which a section
+// index gets its SectionPages with, under "pages".
+func PageMetadata(s StackReader, path string, deps *Dependencies) map[string]interface{} {
+	metadata := s.Get(path)
+	if IsSection(path) {
+		metadata["pages"] = SectionPages(path, metadata)
+		deps.ReadPages()
+	}
+	return metadata
+}
+
+// Parallel calls f with every index up to n, spread over the given number of
+// concurrent jobs, and returns when they're all done.
+func Parallel(jobs, n int, f func(index int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				f(index)
+			}
+		}()
+	}
+	for index := 0; index < n; index++ {
+		indices <- index
+	}
+	close(indices)
+	wg.Wait()
+}
 
-			// write
+// TransformFile renders a single source file into the target directory, and
+// records the files it reads and writes in deps. For pages, it returns the
+// metadata they were rendered with.
+func TransformFile(s StackReader, path string, deps *Dependencies) (map[string]interface{}, error) {
+	Debugf("Transforming %s", path)
+	deps.Read(path)
+	switch PageExt(path) {
+	case ".json":
+		Debugf("%s ignored for transformation", path)
+
+	case ".html", ".md":
+		if PageExt(path) == ".html" && IsBinary(Read(path)) {
 			dst := TargetFileFor(path, filepath.Ext(path))
-			Write(dst, outputBuf)
-			Debugf("%s transformed to %s", path, dst)
+			Warningf("%s: not a text template; copying it verbatim", path)
+			Copy(dst, path)
+			deps.Wrote(dst)
+			return nil, nil
+		}
+		metadata := s.Get(path)
+		if Unpublished(metadata) {
+			Debugf("%s unpublished; skipping", path)
+			return nil, nil
+		}
+		if size, ok := intValue(metadata["paginate"]); ok && size > 0 && PageExt(path) == ".html" {
+			for _, filename := range MetadataFiles(path) {
+				deps.Read(filename)
+			}
+			_, contentBuf, _ := splitMetadata(Read(path))
+			return metadata, TransformPaginated(path, contentBuf, metadata, size, deps)
+		}
 
-		case ".md":
-			// read
-			_, contentBuf := splitMetadata(Read(path))
-
-			// render
-			var htmlBits, extensionBits int
-			metadata := s.Get(path)
-			if v, ok := metadata["toc"]; ok && v.(bool) {
-				htmlBits |= blackfriday.HTML_TOC
-			}
-			md := RenderTemplate(path, contentBuf, metadata)
-			metadata = mergemap.Merge(metadata, map[string]interface{}{
-				"content": template.HTML(RenderMarkdown(md, htmlBits, extensionBits)),
-			})
-			templatePath, templateBuf := Template(s, path)
-			outputBuf := RenderTemplate(templatePath, templateBuf, metadata)
-
-			// write file
-			dst, _ := metadata["target"].(string)
-			Write(dst, outputBuf)
-
-			// write redirects
-			if redirectsInterface, ok := metadata["redirects"]; ok {
-				redirectToUrl, _ := metadata["url"].(string)
-				redirectFromUrls, _ := redirectsInterface.([]string)
-				for _, redirectFromUrl := range redirectFromUrls {
-					redirectFromFile := filepath.Join(*targetDir, redirectFromUrl)
-					Write(redirectFromFile, RedirectTo(redirectToUrl))
-				}
+		// render
+		outputBuf, metadata, err := RenderFile(s, path, deps)
+		if err != nil {
+			return nil, err
+		}
+
+		// write file
+		dst := pageTarget(path, metadata)
+		Write(dst, outputBuf)
+		deps.Wrote(dst)
+
+		// write redirects, unless WriteRedirects collects them
+		if redirectsInterface, ok := metadata["redirects"]; ok && *redirectFormat == "html" && isMarkdown(path) {
+			redirectToUrl, _ := metadata["url"].(string)
+			redirectFromUrls, _ := redirectsInterface.([]string)
+			for _, redirectFromUrl := range redirectFromUrls {
+				redirectFromFile := filepath.Join(*targetDir, redirectFromUrl)
+				Write(redirectFromFile, RedirectTo(redirectToUrl))
+				deps.Wrote(redirectFromFile)
 			}
+		}
 
-			// done
-			Debugf("%s transformed to %s", path, dst)
+		// done
+		Debugf("%s transformed to %s", path, dst)
+		return metadata, nil
 
-		case ".source", ".template":
-			Debugf("%s ignored for transformation", path)
+	case ".source", ".template":
+		Debugf("%s ignored for transformation", path)
 
-		default:
-			dst := TargetFileFor(path, filepath.Ext(path))
+	default:
+		dst := TargetFileFor(path, filepath.Ext(path))
+		if fingerprinted, ok := Fingerprints[path]; ok {
+			dst = fingerprinted
+		}
+		if Minifies(dst) {
+			Write(dst, Minify(dst, Read(path)))
+			Debugf("%s transformed to %s minified", path, dst)
+		} else {
 			Copy(dst, path)
 			Debugf("%s transformed to %s verbatim", path, dst)
 		}
-		return nil
+		deps.Wrote(dst)
 	}
+	return nil, nil
 }
 
-func RenderTemplate(path string, input []byte, metadata map[string]interface{}) []byte {
-	R := func(relativeFilename string) string {
-		filename := filepath.Join(filepath.Dir(path), relativeFilename)
-		return string(RenderTemplate(filename, Read(filename), metadata))
+// RenderFile renders the .html or .md page at path with its metadata in s,
+// and returns the output, as it would be written to the target directory, and
+// the metadata it was rendered with. A paginated listing renders its first
+// page, and a section index gets its SectionPages under "pages". Nothing is
+// written.
+func RenderFile(s StackReader, path string, deps *Dependencies) ([]byte, map[string]interface{}, error) {
+	metadata := PageMetadata(s, path, deps)
+	for _, filename := range MetadataFiles(path) {
+		deps.Read(filename)
 	}
-	importhtml := func(relativeFilename string) template.HTML {
-		return template.HTML(R(relativeFilename))
+	switch PageExt(path) {
+	case ".html":
+		_, contentBuf, _ := splitMetadata(Read(path))
+		if size, ok := intValue(metadata["paginate"]); ok && size > 0 {
+			metadata = Paginators(path, metadata, size, deps)[0].PageMetadata(metadata)
+		}
+		outputBuf, err := RenderPage(path, contentBuf, metadata, deps)
+		if err != nil {
+			return nil, nil, err
+		}
+		dst := pageTarget(path, metadata)
+		return Minify(dst, outputBuf), metadata, nil
+
+	case ".md":
+		content, err := Contents.Render(path, metadata, deps)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, footnotes := SplitFootnotes(content)
+		if SeparateFootnotes(metadata) {
+			content = body
+		}
+		words := WordCount(string(content))
+		_, rawContent, _ := splitMetadata(Read(path))
+		metadata = mergemap.Merge(metadata, map[string]interface{}{
+			"content":      content,
+			"rawcontent":   string(rawContent),
+			"plaincontent": PlainText(string(content)),
+			"footnotes":    footnotes,
+			"wordcount":    words,
+			"readingtime":  ReadingTime(words, *readingWPM),
+			"toc":          TOC([]byte(content)),
+		})
+		var templatePath string
+		var templateBuf []byte
+		if _, ok := metadata["template"]; !ok && stringValue(metadata["layout"]) != "" {
+			templatePath, templateBuf = path, []byte{} // the layout does it all
+		} else if templatePath, templateBuf, err = MaybeTemplate(s, path); err != nil {
+			return nil, nil, err // including a template that doesn't exist
+		} else {
+			deps.Read(templatePath)
+		}
+		outputBuf, err := RenderPage(templatePath, templateBuf, metadata, deps)
+		if err != nil {
+			return nil, nil, err
+		}
+		dst := pageTarget(path, metadata)
+		return Minify(dst, outputBuf), metadata, nil
+	}
+	return nil, nil, fmt.Errorf("%s: not a page", path)
+}
+
+// pageTarget returns the target file of the page at path. Pages other than
+// Markdown keep their extension, unless their metadata names another "ext",
+// are named for their "slug", if any, and go in the directory of their
+// language. HTML pages are written to their PageFile.
+func pageTarget(path string, metadata map[string]interface{}) string {
+	if isMarkdown(path) {
+		dst, _ := metadata["target"].(string)
+		return dst
+	}
+	ext := filepath.Ext(path)
+	if s := stringValue(metadata["ext"]); s != "" {
+		ext = "." + strings.TrimPrefix(s, ".")
+	}
+	lang, page := PageLanguage(path, metadata)
+	return PageFile(LanguagePath(TargetFileFor(SlugPath(page, stringValue(metadata["slug"])), ext), lang))
+}
+
+// MarkdownExts are the extensions of Markdown files.
+var MarkdownExts = []string{".md", ".markdown", ".mdown", ".mkdn", ".mkd"}
+
+// isMarkdown returns whether the file at path is Markdown.
+func isMarkdown(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, markdownExt := range MarkdownExts {
+		if ext == markdownExt {
+			return true
+		}
 	}
-	importcss := func(relativeFilename string) template.CSS {
-		return template.CSS(R(relativeFilename))
+	return false
+}
+
+// PageExt returns the extension of the file at path, ".md" for every one of
+// the MarkdownExts, or ".html" if it's a -template.ext file, which renders
+// like an .html page.
+func PageExt(path string) string {
+	if isMarkdown(path) {
+		return ".md"
 	}
-	importjs := func(relativeFilename string) template.JS {
-		return template.JS(R(relativeFilename))
+	ext := filepath.Ext(path)
+	for _, templateExt := range strings.Split(*templateExts, ",") {
+		if templateExt = strings.TrimSpace(templateExt); templateExt != "" && "."+strings.TrimPrefix(templateExt, ".") == ext {
+			return ".html"
+		}
+	}
+	return ext
+}
+
+// TransformPaginated renders an HTML source file with "paginate" metadata
+// once for every chunk of that many pages in its directory (and below), with
+// the chunk under the "paginator" key.
+func TransformPaginated(path string, contentBuf []byte, metadata map[string]interface{}, size int, deps *Dependencies) error {
+	for _, p := range Paginators(path, metadata, size, deps) {
+		outputBuf, err := RenderPage(path, contentBuf, p.PageMetadata(metadata), deps)
+		if err != nil {
+			return err
+		}
+		Write(p.Target, Minify(p.Target, outputBuf))
+		deps.Wrote(p.Target)
+		Debugf("%s page %d/%d transformed to %s", path, p.Number, p.Total, p.Target)
+	}
+	return nil
+}
+
+// Paginators splits the pages in the directory (and below) of the HTML source
+// file at path into chunks of size, for TransformPaginated, and records that
+// their metadata goes into the page in deps.
+func Paginators(path string, metadata map[string]interface{}, size int, deps *Dependencies) []Paginator {
+	deps.ReadPages()
+	url, _ := metadata["url"].(string)
+	return Paginate(SectionPages(path, metadata), size, url, pageTarget(path, metadata))
+}
+
+// RenderContent renders the content of the Markdown source file at path:
+// first as a template, and then as Markdown, with the -markdown.engine.
+// Shortcodes are rendered on their own, and put back into the result, as is
+// the SummaryMarker, which the template would strip as an HTML comment.
+func RenderContent(path string, metadata map[string]interface{}, deps *Dependencies) (template.HTML, error) {
+	_, contentBuf, _ := splitMetadata(Read(path))
+
+	contentBuf, shortcodes, err := ExtractShortcodes(path, contentBuf, metadata, deps)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Contains(contentBuf, []byte(SummaryMarker)) {
+		placeholder := "GRENDERSUMMARYMARKERX"
+		contentBuf = bytes.Replace(contentBuf, []byte(SummaryMarker), []byte(placeholder), -1)
+		shortcodes[placeholder] = []byte(SummaryMarker)
+	}
+	md, err := RenderTemplate(path, contentBuf, metadata, deps)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(shortcodes.Restore([]byte(Markdownify(md, metadata)))), nil
+}
+
+// RenderTemplate parses the input buffer as a template named for path, and
+// executes it against the metadata. A nil input is read from path. Parsed
+// templates are kept in the Templates cache. Imported files are recorded in
+// deps.
+func RenderTemplate(path string, input []byte, metadata map[string]interface{}, deps *Dependencies) ([]byte, error) {
+	return renderTemplate(path, input, "", metadata, deps)
+}
+
+// RenderPage renders the template of a whole page. If the metadata names a
+// layout, the layout is parsed before the page template and executed instead
+// of it, so that the page template can override the layout's blocks with
+// defines.
+func RenderPage(path string, input []byte, metadata map[string]interface{}, deps *Dependencies) ([]byte, error) {
+	return renderTemplate(path, input, stringValue(metadata["layout"]), metadata, deps)
+}
+
+func renderTemplate(path string, input []byte, layout string, metadata map[string]interface{}, deps *Dependencies) ([]byte, error) {
+	templateName := SourceRelative(path)
+	if IsBinary(input) {
+		return []byte{}, fmt.Errorf("%s: not a text template (binary or not UTF-8)", path)
+	}
+	funcMap := TemplateFuncs(path, metadata, deps)
+
+	cached, err := Templates.Lookup(path, templateName, input)
+	if err != nil {
+		return []byte{}, TemplateError(path, templateName, input, metadata, "Parse", err)
+	}
+	if cached.listing {
+		deps.ReadPages()
+	}
+
+	output := bytes.Buffer{}
+	if layout == "" {
+		if err := cached.Execute(&output, funcMap, metadata); err != nil {
+			return []byte{}, TemplateError(path, templateName, input, metadata, "Execute", err)
+		}
+		return output.Bytes(), nil
+	}
+
+	tmpl := template.New(templateName).Funcs(funcMap).Option(MissingKeyOption())
+	if err := ParseLayout(tmpl, layout, deps); err != nil {
+		return []byte{}, fmt.Errorf("Render Template %s: Layout: %s", path, err)
+	}
+	page, err := cached.Clone()
+	if err == nil {
+		err = addTemplates(tmpl, page)
+	}
+	if err != nil {
+		return []byte{}, TemplateError(path, templateName, input, metadata, "Parse", err)
+	}
+	if err := tmpl.ExecuteTemplate(&output, layout, metadata); err != nil {
+		return []byte{}, TemplateError(path, templateName, input, metadata, "Execute", err)
+	}
+	return output.Bytes(), nil
+}
+
+// MissingKeyOption returns the template option for keys missing from the
+// metadata: with -strict.keys they're an error, otherwise they render as
+// nothing.
+func MissingKeyOption() string {
+	if *strictKeys {
+		return "missingkey=error"
+	}
+	return "missingkey=default"
+}
+
+// TemplateFuncs returns the functions available to the template at path,
+// rendered with the given metadata.
+func TemplateFuncs(path string, metadata map[string]interface{}, deps *Dependencies) template.FuncMap {
+	R := func(relativeFilename string) (string, error) {
+		filename := SourceFileFor(path, relativeFilename) // a leading slash is the source root
+		deps.Read(filename)
+		buf, err := RenderTemplate(filename, nil, metadata, deps)
+		return string(buf), err
+	}
+	importhtml := func(relativeFilename string) (template.HTML, error) {
+		s, err := R(relativeFilename)
+		return template.HTML(s), err
+	}
+	importcss := func(relativeFilename string) (template.CSS, error) {
+		s, err := R(relativeFilename)
+		return template.CSS(s), err
+	}
+	importjs := func(relativeFilename string) (template.JS, error) {
+		s, err := R(relativeFilename)
+		return template.JS(s), err
 	}
 
-	templateName := Relative(*sourceDir, path)
 	funcMap := template.FuncMap{
 		"importhtml": importhtml,
 		"importcss":  importcss,
 		"importjs":   importjs,
-		"sorted":     SortedValues,
+		"partial": func(name string, context ...map[string]interface{}) (template.HTML, error) {
+			switch len(context) {
+			case 0:
+				return RenderPartial(name, metadata, deps)
+			case 1:
+				return RenderPartial(name, context[0], deps)
+			}
+			return "", fmt.Errorf("partial %s: more than one context", name)
+		},
+		"fingerprint": func(url string) string {
+			return FingerprintURL(url, stringValue(metadata["url"]), deps)
+		},
+		"bundle": func(name string, files ...string) (string, error) {
+			return Bundle(path, name, files, deps)
+		},
+		"imagesize": func(name string) (ImageSize, error) {
+			return ImageSizeOf(path, name, deps)
+		},
+		"resize": func(name string, width, height int, mode ...string) (string, error) {
+			if len(mode) > 1 {
+				return "", fmt.Errorf("resize %s: more than one mode", name)
+			}
+			return Resize(path, name, width, height, strings.Join(mode, ""), deps)
+		},
+		"sorted": SortedValues,
+		"robots": func() template.HTML {
+			return RobotsMeta(metadata)
+		},
 		"relative": func(s string) string {
-			return Relative(filepath.Dir(metadata["url"].(string)), s)
+			return Relative(filepath.Dir(SitePath(stringValue(metadata["url"]))), SitePath(s))
 		},
 	}
-
-	tmpl, err := template.New(templateName).Funcs(funcMap).Parse(string(input))
-	if err != nil {
-		Fatalf("Render Template %s: Parse: %s", path, err)
+	for name, f := range HelperFuncs {
+		funcMap[name] = f
 	}
+	AddScopedFuncs(funcMap, metadata)
+	return funcMap
+}
 
-	output := bytes.Buffer{}
-	if err = tmpl.Execute(&output, metadata); err != nil {
-		Fatalf("Render Template %s: Execute: %s", path, err)
+// MarkdownOption is a blackfriday option that pages can switch on or off with
+// a boolean metadata key.
+type MarkdownOption struct {
+	Key     string
+	Bit     int
+	Default bool
+}
+
+var (
+	MarkdownHTMLOptions = []MarkdownOption{
+		MarkdownOption{"inlinetoc", blackfriday.HTML_TOC, false},
+		MarkdownOption{"smartypants", blackfriday.HTML_USE_SMARTYPANTS, true},
+		MarkdownOption{"anchors", HTMLHeadingAnchors, true},
+		MarkdownOption{"emoji", HTMLEmoji, false}, // -emoji sets the default
+	}
+	MarkdownExtensions = []MarkdownOption{
+		MarkdownOption{"nointraemphasis", blackfriday.EXTENSION_NO_INTRA_EMPHASIS, true},
+		MarkdownOption{"tables", blackfriday.EXTENSION_TABLES, true},
+		MarkdownOption{"fencedcode", blackfriday.EXTENSION_FENCED_CODE, true},
+		MarkdownOption{"autolink", blackfriday.EXTENSION_AUTOLINK, true},
+		MarkdownOption{"strikethrough", blackfriday.EXTENSION_STRIKETHROUGH, true},
+		MarkdownOption{"spaceheaders", blackfriday.EXTENSION_SPACE_HEADERS, true},
+		MarkdownOption{"footnotes", blackfriday.EXTENSION_FOOTNOTES, true},
+		MarkdownOption{"laxhtmlblocks", blackfriday.EXTENSION_LAX_HTML_BLOCKS, true},
+		MarkdownOption{"headerids", blackfriday.EXTENSION_HEADER_IDS, true},
+		MarkdownOption{"autoheaderids", blackfriday.EXTENSION_AUTO_HEADER_IDS, true},
 	}
+)
 
-	return output.Bytes()
+// MarkdownBits returns the blackfriday HTML and extension bits for a page with
+// the passed metadata: the default options, adjusted by any boolean metadata
+// keys named in MarkdownHTMLOptions and MarkdownExtensions.
+func MarkdownBits(metadata map[string]interface{}) (int, int) {
+	bits := func(options []MarkdownOption) int {
+		b := 0
+		for _, option := range options {
+			on := option.Default
+			if v, ok := metadata[option.Key].(bool); ok {
+				on = v
+			}
+			if on {
+				b |= option.Bit
+			}
+		}
+		return b
+	}
+	return bits(MarkdownHTMLOptions), bits(MarkdownExtensions)
 }
 
+// RenderMarkdown renders the input buffer with exactly the passed blackfriday
+// HTML and extension bits. See MarkdownBits for the defaults. Fenced code
+// blocks are highlighted, unless -highlight.style is empty, and headings get
+// permalinks with HTMLHeadingAnchors, unless -anchor.symbol is empty. With
+// HTMLEmoji, emoji codes are replaced by EmojifyHTML.
 func RenderMarkdown(input []byte, htmlBits, extensionBits int) []byte {
 	Debugf("rendering %d byte(s) of Markdown", len(input))
 
-	htmlOptions := htmlBits // default
-	htmlOptions |= blackfriday.HTML_USE_SMARTYPANTS
 	title, css := "", ""
-	htmlRenderer := blackfriday.HtmlRenderer(htmlOptions, title, css)
-
-	extensions := extensionBits // default
-	extensions |= blackfriday.EXTENSION_NO_INTRA_EMPHASIS
-	extensions |= blackfriday.EXTENSION_TABLES
-	extensions |= blackfriday.EXTENSION_FENCED_CODE
-	extensions |= blackfriday.EXTENSION_AUTOLINK
-	extensions |= blackfriday.EXTENSION_STRIKETHROUGH
-	extensions |= blackfriday.EXTENSION_SPACE_HEADERS
-	extensions |= blackfriday.EXTENSION_FOOTNOTES
-	extensions |= blackfriday.EXTENSION_LAX_HTML_BLOCKS
-	extensions |= blackfriday.EXTENSION_HEADER_IDS
-	extensions |= blackfriday.EXTENSION_AUTO_HEADER_IDS
-
-	return blackfriday.Markdown(input, htmlRenderer, extensions)
+	renderer := blackfriday.HtmlRenderer(htmlBits&^(HTMLHeadingAnchors|HTMLEmoji), title, css)
+	if htmlBits&HTMLHeadingAnchors != 0 && *anchorSymbol != "" {
+		renderer = AnchorRenderer{renderer}
+	}
+	if *highlightStyle != "" {
+		renderer = HighlightRenderer{renderer}
+	}
+	output := blackfriday.Markdown(input, renderer, extensionBits)
+	if htmlBits&HTMLEmoji != 0 {
+		output = EmojifyHTML(output)
+	}
+	return output
 }
@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/russross/blackfriday"
+)
+
+// withSite writes the given files (relative path: contents) into a temporary
+// source directory, points the source and target flags at temporary
+// directories for the duration of f, and cleans up afterwards.
+func withSite(t testing.TB, files map[string]string, f func()) {
+	root, err := ioutil.TempDir(os.TempDir(), "grender-test-site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for relativePath, contents := range files {
+		Write(filepath.Join(root, "src", relativePath), []byte(contents))
+	}
+
+	defer func(src, tgt string) { *sourceDir, *targetDir = src, tgt }(*sourceDir, *targetDir)
+	*sourceDir, *targetDir = filepath.Join(root, "src"), filepath.Join(root, "tgt")
+	f()
+}
+
+// gather runs the gather passes over the source directory, and returns the
+// resulting stack.
+func gather(t testing.TB) *Stack {
+	m := map[string]interface{}{}
+	s := NewStack()
+	if err := GatherSite(s, *siteFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := filepath.Walk(*sourceDir, GatherJSON(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := filepath.Walk(*sourceDir, GatherSource(s, m)); err != nil {
+		t.Fatal(err)
+	}
+	s.Add("", GlobalMetadata(m))
+	return s
+}
+
+func BenchmarkTransform(b *testing.B) {
+	files := map[string]string{
+		"_.json":         `{"template":"entry.template"}`,
+		"entry.template": `<html><body><h1>{{ .title }}</h1>{{ .content }}</body></html>`,
+	}
+	paragraph := strings.Repeat("Some *emphasized* and **strong** text, with a [link](/x). ", 20)
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("page-%03d.md", i)] = fmt.Sprintf(
+			"{\"title\":\"Page %d\"}\n---\n# Heading\n\n%s\n\n* one\n* two\n\n%s\n",
+			i, paragraph, paragraph,
+		)
+	}
+
+	withSite(b, files, func() {
+		s := gather(b)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, jobs := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, errs := Transform(s, paths, jobs, NewDependencyGraph()); len(errs) > 0 {
+						b.Fatal(errs[0])
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestTransformErrors(t *testing.T) {
+	files := map[string]string{
+		"a.html": `{{ .title }}`,
+		"b.html": `{{ .broken `,
+		"c.html": `{{ .title }}`,
+		"d.html": `{{ template "missing" }}`,
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, errs := Transform(s, paths, 4, NewDependencyGraph())
+		if len(errs) != 2 {
+			t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+		}
+		for i, name := range []string{"b.html", "d.html"} {
+			if !strings.Contains(errs[i].Error(), name) {
+				t.Errorf("error %d: expected mention of %s, got %s", i, name, errs[i])
+			}
+		}
+		for _, name := range []string{"a.html", "c.html"} {
+			if _, err := os.Stat(filepath.Join(*targetDir, name)); err != nil {
+				t.Errorf("%s: %s", name, err)
+			}
+		}
+	})
+}
+
+// TestTransformConcurrent renders pages with nested metadata at several levels
+// over several jobs; run with -race, it catches workers writing to the stack.
+func TestTransformConcurrent(t *testing.T) {
+	files := map[string]string{
+		"_.json":             `{"template":"page.template","site":{"nav":{"home":"/"}}}`,
+		"page.template":      `{{ range $k, $v := .site.nav }}{{ $k }} {{ end }}`,
+		"blog/_.json":        `{"site":{"nav":{"blog":"/blog/"}}}`,
+		"blog/page.template": `{{ range $k, $v := .site.nav }}{{ $k }} {{ end }}`,
+	}
+	for i := 0; i < 32; i++ {
+		page := fmt.Sprintf("{\"site\":{\"nav\":{\"self\":\"%d\"}}}\n---\nPage.\n", i)
+		files[fmt.Sprintf("page%d.md", i)] = page
+		files[fmt.Sprintf("blog/page%d.md", i)] = page
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 8, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		for i := 0; i < 32; i++ {
+			for name, expected := range map[string]string{
+				fmt.Sprintf("page%d.html", i):      "home self",
+				fmt.Sprintf("blog/page%d.html", i): "blog home self",
+			} {
+				if got := strings.TrimSpace(string(Read(filepath.Join(*targetDir, name)))); got != expected {
+					t.Errorf("%s: expected %q, got %q", name, expected, got)
+				}
+			}
+		}
+		if nav := s.Get(filepath.Join(*sourceDir, "x.md"))["site"].(map[string]interface{})["nav"]; len(nav.(map[string]interface{})) != 1 {
+			t.Errorf("expected the root nav untouched by the pages, got %v", nav)
+		}
+	})
+}
+
+func TestStrictKeys(t *testing.T) {
+	files := map[string]string{
+		"a.html": "{\"title\":\"A\"}\n---\n{{ .title }}{{ with index . \"subtitle\" }}{{ . }}{{ end }}",
+		"b.html": "{\"title\":\"B\"}\n---\n{{ .titel }}",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		path := filepath.Join(*sourceDir, "b.html")
+		buf, _, err := RenderFile(s, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "", string(buf); got != expected {
+			t.Errorf("lenient: expected %q, got %q", expected, got)
+		}
+
+		defer func(s bool) { *strictKeys = s }(*strictKeys)
+		*strictKeys = true
+		if _, _, err := RenderFile(s, filepath.Join(*sourceDir, "a.html"), nil); err != nil {
+			t.Errorf("a.html: %s", err)
+		}
+		_, _, err = RenderFile(s, path, nil)
+		if err == nil {
+			t.Fatal("b.html: expected an error")
+		}
+		for _, fragment := range []string{path + ":3:", `"titel"`} {
+			if !strings.Contains(err.Error(), fragment) {
+				t.Errorf("b.html: expected %q in %s", fragment, err)
+			}
+		}
+	})
+}
+
+func TestSlug(t *testing.T) {
+	files := map[string]string{
+		"_.json":                 `{"template":"page.template"}`,
+		"page.template":          "{{ .content }}",
+		"about.md":               "{\"slug\":\"about-us\"}\n---\nAbout",
+		"Über Café.md":           "Café",
+		"2013-03-04-foo.md":      "{\"slug\":\"bar\"}\n---\nFoo",
+		"contact.html":           "{\"slug\":\"reach-us\"}\n---\n{{ .url }}",
+		"blog/page.template":     "{{ .content }}",
+		"blog/2013-03-05-baz.md": "Baz",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		for name, expected := range map[string]string{
+			"about.md":          "/about-us.html",
+			"Über Café.md":      "/Über Café.html",
+			"2013-03-04-foo.md": "/2013/03/04/bar.html",
+			"contact.html":      "/reach-us.html",
+		} {
+			metadata := s.Get(filepath.Join(*sourceDir, name))
+			if got := stringValue(metadata["url"]); got != expected {
+				t.Errorf("%s: expected url %q, got %q", name, expected, got)
+			}
+		}
+		if expected, got := "Foo", stringValue(s.Get(filepath.Join(*sourceDir, "2013-03-04-foo.md"))["title"]); got != expected {
+			t.Errorf("expected title %q, got %q", expected, got)
+		}
+
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if expected, got := "/reach-us.html", string(Read(filepath.Join(*targetDir, "reach-us.html"))); got != expected {
+			t.Errorf("contact.html: expected %q, got %q", expected, got)
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "blog", "2013", "03", "05", "baz.html")); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestPrettyURLSite(t *testing.T) {
+	defer func(p bool) { *prettyURLs = p }(*prettyURLs)
+	*prettyURLs = true
+	files := map[string]string{
+		"_.json":            `{"template":"page.template"}`,
+		"page.template":     "{{ .content }}",
+		"index.html":        "home",
+		"about.md":          "About",
+		"contact.html":      "{{ .url }}",
+		"2013-03-04-foo.md": "{\"date\":\"2013-03-04\"}\n---\nFoo",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		for name, expected := range map[string]string{
+			"index.html":        "/",
+			"about.md":          "/about/",
+			"contact.html":      "/contact/",
+			"2013-03-04-foo.md": "/2013/03/04/foo/",
+		} {
+			if got := stringValue(s.Get(filepath.Join(*sourceDir, name))["url"]); got != expected {
+				t.Errorf("%s: expected url %q, got %q", name, expected, got)
+			}
+		}
+
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages, errs := Transform(s, paths, 1, NewDependencyGraph())
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		for _, name := range []string{"about/index.html", "contact/index.html", "2013/03/04/foo/index.html"} {
+			if _, err := os.Stat(filepath.Join(*targetDir, name)); err != nil {
+				t.Error(err)
+			}
+		}
+		if expected, got := "/contact/", string(Read(filepath.Join(*targetDir, "contact", "index.html"))); got != expected {
+			t.Errorf("contact: expected %q, got %q", expected, got)
+		}
+
+		items, err := FeedItems(s, paths, pages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].URL != "/2013/03/04/foo/" {
+			t.Errorf("feed: expected one item at /2013/03/04/foo/, got %v", items)
+		}
+		redirects := fmt.Sprint(s.Get(filepath.Join(*sourceDir, "2013-03-04-foo.md"))["redirects"])
+		if !strings.Contains(redirects, "/2013/03/04/foo.html") {
+			t.Errorf("expected a redirect from /2013/03/04/foo.html, got %s", redirects)
+		}
+	})
+}
+
+func TestIndexPages(t *testing.T) {
+	defer func(n string, p bool) { *indexNames, *prettyURLs = n, p }(*indexNames, *prettyURLs)
+	*indexNames = "index,README"
+	files := map[string]string{
+		"_.json":         `{"template":"page.template"}`,
+		"page.template":  "{{ .content }}",
+		"index.md":       "Home",
+		"docs/README.md": "Docs",
+		"docs/setup.md":  "Setup",
+		"docs/faq.html":  "{{ .url }}",
+	}
+	withSite(t, files, func() {
+		for pretty, expected := range map[bool]map[string]string{
+			false: {"index.md": "/index.html", "docs/README.md": "/docs/index.html", "docs/setup.md": "/docs/setup.html", "docs/faq.html": "/docs/faq.html"},
+			true:  {"index.md": "/", "docs/README.md": "/docs/", "docs/setup.md": "/docs/setup/", "docs/faq.html": "/docs/faq/"},
+		} {
+			*prettyURLs = pretty
+			s := gather(t)
+			for name, url := range expected {
+				if got := stringValue(s.Get(filepath.Join(*sourceDir, name))["url"]); got != url {
+					t.Errorf("pretty %v: %s: expected url %q, got %q", pretty, name, url, got)
+				}
+			}
+		}
+	})
+}
+
+func TestTransformPathsSymlinks(t *testing.T) {
+	withSite(t, map[string]string{"dir/a.txt": "a"}, func() {
+		for link, target := range map[string]string{"b.txt": "dir/a.txt", "linked": "dir"} {
+			if err := os.Symlink(filepath.Join(*sourceDir, target), filepath.Join(*sourceDir, link)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{filepath.Join(*sourceDir, "b.txt"), filepath.Join(*sourceDir, "dir", "a.txt")}
+		if fmt.Sprint(expected) != fmt.Sprint(paths) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+	})
+}
+
+func TestDrafts(t *testing.T) {
+	files := map[string]string{
+		"_.json":         `{"template":"entry.template"}`,
+		"entry.template": `{{ .content }}`,
+		"index.html":     `{{ range $k, $v := .files }}{{ $k }} {{ end }}`,
+		"draft.md":       "{\"draft\":true}\n---\ndraft",
+		"draft.html":     "{\"draft\":true}\n---\ndraft",
+		"published.md":   "published",
+	}
+	for _, includeDrafts := range []bool{false, true} {
+		func() {
+			defer func(d bool) { *drafts = d }(*drafts)
+			*drafts = includeDrafts
+			withSite(t, files, func() {
+				s := gather(t)
+				paths, err := TransformPaths(*sourceDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+					t.Fatal(errs[0])
+				}
+
+				expected := "index.html published.md "
+				if includeDrafts {
+					expected = "draft.html draft.md index.html published.md "
+				}
+				buf, err := ioutil.ReadFile(filepath.Join(*targetDir, "index.html"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := string(buf); expected != got {
+					t.Errorf("drafts=%v: expected '%s', got '%s'", includeDrafts, expected, got)
+				}
+				for _, name := range []string{"draft.html", "published.html"} {
+					_, err := os.Stat(filepath.Join(*targetDir, name))
+					if exists := err == nil; exists != (includeDrafts || name == "published.html") {
+						t.Errorf("drafts=%v: %s exists: %v", includeDrafts, name, exists)
+					}
+				}
+			})
+		}()
+	}
+}
+
+func TestGlobalFlat(t *testing.T) {
+	files := map[string]string{
+		"_.json":                      `{"template":"entry.template"}`,
+		"entry.template":              `{{ .content }}`,
+		"blog/entry.template":         `{{ .content }}`,
+		"blog/old/entry.template":     `{{ .content }}`,
+		"index.html":                  `{{ range .pages }}{{ .url }} {{ end }}`,
+		"about.md":                    "about",
+		"blog/2013-01-02-first.md":    "first",
+		"blog/old/2012-05-06-last.md": "last",
+	}
+	defer func(f string) { *globalFlat = f }(*globalFlat)
+	*globalFlat = "pages"
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(*targetDir, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "/blog/2013/01/02/first.html /blog/old/2012/05/06/last.html /about.html /index.html "
+		if got := string(buf); expected != got {
+			t.Errorf("expected '%s', got '%s'", expected, got)
+		}
+	})
+}
+
+func TestTemplateExt(t *testing.T) {
+	files := map[string]string{
+		"_.json":     `{"title":"Site"}`,
+		"feed.xml":   "{\"ext\":\"rss\"}\n---\n<title>{{ .title }}</title>{{ range .files }}<url>{{ .url }}</url>{{ end }}",
+		"notes.txt":  `{{ .title }} notes`,
+		"data.csv":   `{{ .title }}`,
+		"index.html": `{{ .title }}`,
+	}
+	defer func(exts string) { *templateExts = exts }(*templateExts)
+	*templateExts = ".xml, txt"
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		for name, expected := range map[string]string{
+			"feed.rss":   "<title>Site</title><url>/feed.rss</url><url>/index.html</url><url>/notes.txt</url>",
+			"notes.txt":  "Site notes",
+			"data.csv":   "{{ .title }}",
+			"index.html": "Site",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected '%s', got '%s'", name, expected, got)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "feed.xml")); err == nil {
+			t.Errorf("feed.xml: expected it to be written as feed.rss")
+		}
+	})
+}
+
+func TestMarkdownExts(t *testing.T) {
+	files := map[string]string{
+		"_.json":                `{"template":"page.template"}`,
+		"page.template":         `{{ .title }}: {{ .content }}`,
+		"index.html":            `{{ range .files }}{{ .url }} {{ end }}`,
+		"a.md":                  "{\"title\":\"A\"}\n---\n*a*",
+		"b.markdown":            "{\"title\":\"B\"}\n---\n*b*",
+		"c.mdown":               "{\"title\":\"C\"}\n---\n*c*",
+		"d.mkdn":                "{\"title\":\"D\"}\n---\n*d*",
+		"e.MKD":                 "{\"title\":\"E\"}\n---\n*e*",
+		"2013-01-02-f.markdown": "*f*",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		for name, expected := range map[string]string{
+			"a.html":               "A: <p><em>a</em></p>\n",
+			"b.html":               "B: <p><em>b</em></p>\n",
+			"c.html":               "C: <p><em>c</em></p>\n",
+			"d.html":               "D: <p><em>d</em></p>\n",
+			"e.html":               "E: <p><em>e</em></p>\n",
+			"2013/01/02/f.html":    "F: <p><em>f</em></p>\n",
+			"2013/01/2/index.html": string(RedirectTo("/2013/01/02/f.html")),
+			"index.html":           "/2013/01/02/f.html /a.html /b.html /c.html /d.html /e.html /index.html ",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected '%s', got '%s'", name, expected, got)
+			}
+		}
+		for _, name := range []string{"b.markdown", "c.mdown", "d.mkdn", "e.MKD"} {
+			if _, err := os.Stat(filepath.Join(*targetDir, name)); err == nil {
+				t.Errorf("%s: expected it not to be copied", name)
+			}
+		}
+	})
+}
+
+func TestGatherSite(t *testing.T) {
+	files := map[string]string{
+		"a.html":      `{{ .author }} {{ .title }}`,
+		"blog/_.json": `{"author":"B"}`,
+		"blog/b.html": `{{ .author }} {{ .title }}`,
+		"blog/c.html": "{\"author\":\"C\"}\n---\n{{ .author }} {{ .title }}",
+	}
+	withSite(t, files, func() {
+		defer func(f string) { *siteFile = f }(*siteFile)
+		*siteFile = filepath.Join(filepath.Dir(*sourceDir), "site.json")
+		Write(*siteFile, []byte(`{"author":"Site","title":"T"}`))
+
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		for name, expected := range map[string]string{
+			"a.html":      "Site T",
+			"blog/b.html": "B T",
+			"blog/c.html": "C T",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected '%s', got '%s'", name, expected, got)
+			}
+		}
+
+		Write(*siteFile, []byte(`{"broken":`))
+		if err := GatherSite(NewStack(), *siteFile); err == nil {
+			t.Errorf("expected error for bad JSON")
+		}
+	})
+}
+
+func TestDeterministicBuild(t *testing.T) {
+	files := map[string]string{
+		"_.json":              `{"feed":{"title":"T","link":"http://example.com/"},"taxonomies":{"tags":"tag.template"}}`,
+		"tag.template":        `{{ range .pages }}{{ .url }} {{ end }}`,
+		"index.html":          `{{ jsonify .files }} {{ range sorted .files.blog }}{{ .url }} {{ end }}`,
+		"blog/_.json":         `{"template":"entry.template","sortkey":"same","tags":["a","b"]}`,
+		"blog/entry.template": `{{ .content }}`,
+	}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("blog/2013-01-02-entry-%02d.md", i)] = fmt.Sprintf("entry %d", i)
+	}
+	withSite(t, files, func() {
+		defer func(s string) { *siteFile = s }(*siteFile)
+		*siteFile = ""
+		outputs := []map[string]string{}
+		for i := 0; i < 2; i++ {
+			if err := Build(); err != nil {
+				t.Fatal(err)
+			}
+			output := map[string]string{}
+			filepath.Walk(*targetDir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					output[Relative(*targetDir, path)] = string(Read(path))
+				}
+				return err
+			})
+			outputs = append(outputs, output)
+			if err := Clean(*targetDir); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(outputs[0]) != len(outputs[1]) {
+			t.Fatalf("expected the same files, got %d and %d", len(outputs[0]), len(outputs[1]))
+		}
+		for name, buf := range outputs[0] {
+			if buf != outputs[1][name] {
+				t.Errorf("%s differs between builds", name)
+			}
+		}
+		for _, name := range []string{"index.html", "rss.xml", "tags/a/index.html"} {
+			if _, ok := outputs[0][name]; !ok {
+				t.Errorf("%s not written", name)
+			}
+		}
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	files := map[string]string{
+		"a.html": `{{ .title }}`,
+		"b.txt":  "b",
+	}
+	withSite(t, files, func() {
+		stale := filepath.Join(*targetDir, "stale.html")
+		Write(stale, []byte("stale"))
+		Write(filepath.Join(*targetDir, "a.html"), []byte("old"))
+
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stdout)
+		defer func(d, c bool, s string) { *dryRun, *clean, *siteFile = d, c, s }(*dryRun, *clean, *siteFile)
+		*dryRun, *clean, *siteFile = true, true, ""
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, line := range []string{
+			"dry run: delete " + stale,
+			"dry run: create " + filepath.Join(*targetDir, "a.html"),
+			"dry run: create " + filepath.Join(*targetDir, "b.txt"),
+		} {
+			if !strings.Contains(buf.String(), line) {
+				t.Errorf("expected '%s' in:\n%s", line, buf.String())
+			}
+		}
+		if got := string(Read(filepath.Join(*targetDir, "a.html"))); got != "old" {
+			t.Errorf("a.html: expected it untouched, got '%s'", got)
+		}
+		for _, name := range []string{"stale.html", "a.html"} {
+			if _, err := os.Stat(filepath.Join(*targetDir, name)); err != nil {
+				t.Errorf("%s: %s", name, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "b.txt")); err == nil {
+			t.Errorf("b.txt: expected it not to be written")
+		}
+
+		buf.Reset()
+		*clean = false
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		if line := "dry run: overwrite " + filepath.Join(*targetDir, "a.html"); !strings.Contains(buf.String(), line) {
+			t.Errorf("without -clean: expected '%s' in:\n%s", line, buf.String())
+		}
+	})
+}
+
+func TestMarkdownBits(t *testing.T) {
+	defaultHTML, defaultExtensions := MarkdownBits(map[string]interface{}{})
+	if defaultHTML&blackfriday.HTML_USE_SMARTYPANTS == 0 || defaultHTML&blackfriday.HTML_TOC != 0 {
+		t.Errorf("bad default HTML bits %b", defaultHTML)
+	}
+
+	htmlBits, extensionBits := MarkdownBits(map[string]interface{}{
+		"inlinetoc":   true,
+		"smartypants": false,
+		"footnotes":   false,
+		"tables":      "not a bool",
+	})
+	if expected := defaultHTML&^blackfriday.HTML_USE_SMARTYPANTS | blackfriday.HTML_TOC; expected != htmlBits {
+		t.Errorf("HTML bits: expected %b, got %b", expected, htmlBits)
+	}
+	if expected := defaultExtensions &^ blackfriday.EXTENSION_FOOTNOTES; expected != extensionBits {
+		t.Errorf("extension bits: expected %b, got %b", expected, extensionBits)
+	}
+
+	if got := string(RenderMarkdown([]byte(`"quoted"`), htmlBits&^blackfriday.HTML_TOC, extensionBits)); got != "<p>&quot;quoted&quot;</p>\n" {
+		t.Errorf("without smartypants: got %q", got)
+	}
+}
+
+func TestBinaryPage(t *testing.T) {
+	binary := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR{{"
+	files := map[string]string{
+		"logo.html": binary,
+		"page.html": "<p>{{ .source }}</p>",
+	}
+	withSite(t, files, func() {
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(Read(filepath.Join(*targetDir, "logo.html"))); got != binary {
+			t.Errorf("expected logo.html copied verbatim, got %q", got)
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "page.html")); err != nil {
+			t.Errorf("page.html: %s", err)
+		}
+
+		_, err := RenderTemplate(filepath.Join(*sourceDir, "logo.html"), []byte(binary), map[string]interface{}{}, nil)
+		if err == nil || !strings.Contains(err.Error(), "logo.html: not a text template") {
+			t.Errorf("expected a not a text template error, got %v", err)
+		}
+	})
+
+	for input, expected := range map[string]bool{
+		"plain text":   false,
+		"ünïcödé":      false,
+		"nul\x00byte":  true,
+		"latin-1 \xe9": true,
+	} {
+		if got := IsBinary([]byte(input)); got != expected {
+			t.Errorf("IsBinary(%q): expected %v, got %v", input, expected, got)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	files := map[string]string{
+		"shared/header.html.source": "<h1>{{ .title }}</h1>",
+		"blog/deep/page.html":       "{\"title\":\"T\"}\n---\n{{ importhtml \"/shared/header.html.source\" }}|{{ importhtml \"../../shared/header.html.source\" }}",
+	}
+	withSite(t, files, func() {
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		expected := "<h1>T</h1>|<h1>T</h1>"
+		if got := strings.TrimSpace(string(Read(filepath.Join(*targetDir, "blog", "deep", "page.html")))); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+}
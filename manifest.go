@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ManifestEntry describes one file of the target directory in the manifest.
+type ManifestEntry struct {
+	Path   string `json:"path"`             // relative to the target directory
+	Source string `json:"source,omitempty"` // relative to the source directory
+	URL    string `json:"url"`
+	Title  string `json:"title,omitempty"`
+	Date   string `json:"date,omitempty"` // RFC 3339
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest returns a ManifestEntry for every target file that graph knows
+// the source of, that was written by this build, or that was copied from the
+// -static directory, by path. Target files of the pages in s get their url,
+// title and date.
+func Manifest(s StackReader, graph *DependencyGraph) ([]ManifestEntry, error) {
+	targets := map[string]string{} // target file: source file
+	if err := staticTargets(*staticDir, targets); err != nil {
+		return []ManifestEntry{}, err
+	}
+	for _, target := range Written() {
+		targets[target] = ""
+	}
+	for target, source := range graph.SourceOf() {
+		targets[target] = source
+	}
+	delete(targets, filepath.Join(*targetDir, DependencyFile))
+	delete(targets, ManifestFile())
+
+	entries := []ManifestEntry{}
+	for target, source := range targets {
+		sum, err := HashFile(target)
+		if err != nil {
+			return []ManifestEntry{}, err
+		}
+		entry := ManifestEntry{
+			Path:   filepath.ToSlash(Relative(*targetDir, target)),
+			URL:    URLFor(target),
+			SHA256: fmt.Sprintf("%x", sum),
+		}
+		if filepath.Ext(target) == ".html" {
+			entry.URL = PageURL(target)
+		}
+		if source != "" {
+			entry.Source = filepath.ToSlash(SourceRelative(source))
+			if metadata := s.Get(source); stringValue(metadata["target"]) == target {
+				entry.URL = stringValue(metadata["url"])
+				entry.Title = stringValue(metadata["title"])
+				if date, ok := ParseDate(metadata["date"]); ok {
+					entry.Date = date.Format(time.RFC3339)
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.Sort(manifestEntries(entries))
+	return entries, nil
+}
+
+// staticTargets adds the target of every file in the static dir that's in
+// the target directory to targets, without a source.
+func staticTargets(dir string, targets map[string]string) error {
+	if dir == "" {
+		return nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil // no static files
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		dst := filepath.Join(*targetDir, Relative(dir, path))
+		if dstInfo, err := os.Stat(dst); err == nil && !dstInfo.IsDir() {
+			targets[dst] = ""
+		}
+		return nil
+	})
+}
+
+type manifestEntries []ManifestEntry
+
+func (a manifestEntries) Len() int           { return len(a) }
+func (a manifestEntries) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a manifestEntries) Less(i, j int) bool { return a[i].Path < a[j].Path }
+
+// ManifestFile returns the path of the -manifest in the target directory, or
+// "" without one.
+func ManifestFile() string {
+	if *manifestFile == "" {
+		return ""
+	}
+	return filepath.Join(*targetDir, *manifestFile)
+}
+
+// WriteManifest writes the Manifest to the ManifestFile, as JSON, if there is
+// one. With -dry-run, there's nothing to describe.
+func WriteManifest(s StackReader, graph *DependencyGraph) error {
+	if ManifestFile() == "" || *dryRun {
+		return nil
+	}
+	entries, err := Manifest(s, graph)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(map[string]interface{}{"files": entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	Write(ManifestFile(), append(buf, '\n'))
+	Debugf("%s written (%d file(s))", ManifestFile(), len(entries))
+	return nil
+}
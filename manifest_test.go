@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"page.template"}`,
+		"page.template": `{{ .content }}`,
+		"hello.md":      "{\"title\":\"Hello\",\"date\":\"2015-01-02\"}\n---\nHi.\n",
+		"style.css":     "p { color: red }\n",
+	}
+	withSite(t, files, func() {
+		defer func(m string) { *manifestFile = m }(*manifestFile)
+		*manifestFile = "manifest.json"
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+
+		var manifest struct{ Files []ManifestEntry }
+		if err := json.Unmarshal(Read(filepath.Join(*targetDir, "manifest.json")), &manifest); err != nil {
+			t.Fatal(err)
+		}
+		entries := map[string]ManifestEntry{}
+		for _, entry := range manifest.Files {
+			entries[entry.Path] = entry
+		}
+		if _, ok := entries["manifest.json"]; ok {
+			t.Errorf("expected the manifest not to list itself")
+		}
+
+		hello, ok := entries["hello.html"]
+		if !ok {
+			t.Fatalf("expected hello.html in %v", manifest.Files)
+		}
+		expected := ManifestEntry{
+			Path:   "hello.html",
+			Source: "hello.md",
+			URL:    "/hello.html",
+			Title:  "Hello",
+			Date:   "2015-01-02T00:00:00Z",
+			SHA256: fmt.Sprintf("%x", sha256.Sum256(Read(filepath.Join(*targetDir, "hello.html")))),
+		}
+		if hello != expected {
+			t.Errorf("expected %+v, got %+v", expected, hello)
+		}
+		if css := entries["style.css"]; css.Source != "style.css" || css.URL != "/style.css" || css.Title != "" {
+			t.Errorf("style.css: got %+v", css)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"html/template"
+)
+
+// MarkdownRenderer renders Markdown to HTML. The page metadata is passed so
+// that an engine can read its own per-page options, like the keys in
+// MarkdownHTMLOptions and MarkdownExtensions for Blackfriday.
+type MarkdownRenderer interface {
+	Render(input []byte, metadata map[string]interface{}) []byte
+}
+
+var (
+	// MarkdownEngines are the -markdown.engine values. Other engines join by
+	// adding themselves here.
+	MarkdownEngines = map[string]MarkdownRenderer{
+		"blackfriday": Blackfriday{},
+	}
+)
+
+// Blackfriday is the default MarkdownRenderer. It renders with RenderMarkdown,
+// so with syntax highlighting and heading anchors.
+type Blackfriday struct{}
+
+func (Blackfriday) Render(input []byte, metadata map[string]interface{}) []byte {
+	htmlBits, extensionBits := MarkdownBits(metadata)
+	return RenderMarkdown(input, htmlBits, extensionBits)
+}
+
+// Markdownify renders the input as Markdown with the -markdown.engine, and
+// the passed page metadata. If the page Sanitizes, the output is sanitized.
+func Markdownify(input []byte, metadata map[string]interface{}) template.HTML {
+	engine, ok := MarkdownEngines[*markdownEngine]
+	if !ok {
+		Warningf("unknown markdown engine '%s'; using blackfriday", *markdownEngine)
+		engine = Blackfriday{}
+	}
+	output := engine.Render(input, metadata)
+	if Sanitizes(metadata) {
+		output = Sanitize(output)
+	}
+	return template.HTML(output)
+}
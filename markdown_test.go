@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+type upperRenderer struct{}
+
+func (upperRenderer) Render(input []byte, metadata map[string]interface{}) []byte {
+	return []byte(fmt.Sprintf("<pre>%s %v</pre>", bytes.ToUpper(input), metadata["shout"]))
+}
+
+func TestMarkdownEngine(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"page.template"}`,
+		"page.template": `{{ .content }}|{{ markdownify "*hi*" }}`,
+		"page.md":       "{\"shout\":true}\n---\n*{{ .template }}*\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		buf, _, err := RenderFile(s, *sourceDir+"/page.md", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "<p><em>page.template</em></p>\n|<p><em>hi</em></p>\n", string(buf); expected != got {
+			t.Errorf("blackfriday: expected %q, got %q", expected, got)
+		}
+
+		MarkdownEngines["upper"] = upperRenderer{}
+		defer delete(MarkdownEngines, "upper")
+		defer func(engine string) { *markdownEngine = engine }(*markdownEngine)
+		*markdownEngine = "upper"
+
+		buf, _, err = RenderFile(s, *sourceDir+"/page.md", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "<pre>*PAGE.TEMPLATE*\n true</pre>|<pre>*HI* <nil></pre>", string(buf); expected != got {
+			t.Errorf("upper: expected %q, got %q", expected, got)
+		}
+	})
+}
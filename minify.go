@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+var (
+	// MinifyTypes maps the extensions of the target files that -minify
+	// minifies to their media types.
+	MinifyTypes = map[string]string{
+		".html": "text/html",
+		".htm":  "text/html",
+		".css":  "text/css",
+		".js":   "application/javascript",
+	}
+
+	minifier = newMinifier()
+)
+
+func newMinifier() *minify.M {
+	m := minify.New()
+	// Whitespace in <pre> and <textarea> is always kept. Keeping optional tags
+	// too makes the output easier to follow.
+	m.Add("text/html", &html.Minifier{KeepDocumentTags: true, KeepEndTags: true})
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("application/javascript", js.Minify)
+	return m
+}
+
+// Minifies returns true if -minify is set, and filename is of a type it
+// minifies.
+func Minifies(filename string) bool {
+	_, ok := MinifyTypes[strings.ToLower(filepath.Ext(filename))]
+	return *minifyOutput && ok
+}
+
+// Minify returns buf, the contents of the target file filename, minified if
+// Minifies(filename). If it can't be minified, it's returned as it is.
+func Minify(filename string, buf []byte) []byte {
+	if !Minifies(filename) {
+		return buf
+	}
+	minified, err := minifier.Bytes(MinifyTypes[strings.ToLower(filepath.Ext(filename))], buf)
+	if err != nil {
+		Warningf("%s: not minified: %s", filename, err)
+		return buf
+	}
+	return minified
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMinify(t *testing.T) {
+	defer func(m bool) { *minifyOutput = m }(*minifyOutput)
+	for _, c := range []struct {
+		minify          bool
+		filename        string
+		input, expected string
+	}{
+		{false, "a.html", "<p>  a  </p>\n", "<p>  a  </p>\n"},
+		{true, "a.html", "<html><body>\n  <p>  a  </p>\n</body></html>\n", "<html><body><p>a</p></body></html>"},
+		{true, "a.html", "<pre>  x\n    y</pre>", "<pre>  x\n    y</pre>"},
+		{true, "a.html", "<textarea>  x\n    y</textarea>", "<textarea>  x\n    y</textarea>"},
+		{true, "a.CSS", "a {\n  color: #ff0000;\n}\n", "a{color:red}"},
+		{true, "a.js", "var x = 1 ;\n", "var x=1"},
+		{true, "a.txt", "  text  \n", "  text  \n"},
+	} {
+		*minifyOutput = c.minify
+		if got := string(Minify(c.filename, []byte(c.input))); c.expected != got {
+			t.Errorf("%s %q: expected %q, got %q", c.filename, c.input, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// LinkNeighbors adds "prev" and "next" metadata to every dated page among
+// paths, pointing to the url and title of the next older and next newer page
+// in the same directory. The oldest page has no prev, and the newest no next.
+// Pages in different directories, or languages, form separate sequences.
+func LinkNeighbors(s StackReadWriter, paths []string) {
+	sequences := map[string][]map[string]interface{}{} // dir: pages
+	for _, path := range paths {
+		switch PageExt(path) {
+		case ".html", ".md":
+		default:
+			continue
+		}
+		metadata := s.Get(path)
+		if _, ok := ParseDate(metadata["date"]); !ok || Unpublished(metadata) {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if lang := stringValue(metadata["lang"]); lang != "" {
+			dir += " (" + lang + ")"
+		}
+		sequences[dir] = append(sequences[dir], metadata)
+	}
+
+	for dir, pages := range sequences {
+		sort.Sort(byDate(pages))
+		for i, page := range pages {
+			neighbors := map[string]interface{}{}
+			if i > 0 {
+				neighbors["next"] = neighbor(pages[i-1])
+			}
+			if i < len(pages)-1 {
+				neighbors["prev"] = neighbor(pages[i+1])
+			}
+			s.Add(stringValue(page["source"]), neighbors)
+		}
+		Debugf("%s: linked %d dated page(s)", dir, len(pages))
+	}
+}
+
+func neighbor(metadata map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"url":   metadata["url"],
+		"title": metadata["title"],
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkNeighbors(t *testing.T) {
+	files := map[string]string{
+		"blog/2013-01-01-one.md":   "{}\n---\nOne\n",
+		"blog/2013-01-02-two.md":   "{}\n---\nTwo\n",
+		"blog/2013-01-03-three.md": "{}\n---\nThree\n",
+		"news/2013-01-04-four.md":  "{}\n---\nFour\n",
+		"about.md":                 "{}\n---\nAbout\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		LinkNeighbors(s, paths)
+
+		titleOf := func(i interface{}) interface{} {
+			if m, ok := i.(map[string]interface{}); ok {
+				return m["title"]
+			}
+			return nil
+		}
+		for name, expected := range map[string][2]interface{}{
+			"blog/2013-01-01-one.md":   {nil, "Two"},
+			"blog/2013-01-02-two.md":   {"One", "Three"},
+			"blog/2013-01-03-three.md": {"Two", nil},
+			"news/2013-01-04-four.md":  {nil, nil},
+			"about.md":                 {nil, nil},
+		} {
+			metadata := s.Get(filepath.Join(*sourceDir, name))
+			if got := [2]interface{}{titleOf(metadata["prev"]), titleOf(metadata["next"])}; got != expected {
+				t.Errorf("%s: expected prev, next %v, got %v", name, expected, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// OpenGraph returns the Open Graph and Twitter card meta tags for a page, for
+// its template or layout to put in the head: {{ opengraph . }}. They're taken
+// from the page's "title", "description" (or its summary), "image" and "url",
+// falling back to the keys of the same names under "opengraph", which is
+// where site-wide defaults go, with "site_name" and "twitter" (the site's
+// @handle). Relative URLs are made absolute with the -baseurl, and og:url is
+// the CanonicalURL.
+func OpenGraph(metadata map[string]interface{}) template.HTML {
+	defaults, _ := metadata["opengraph"].(map[string]interface{})
+	value := func(key string) string {
+		if s := strings.TrimSpace(stringValue(metadata[key])); s != "" {
+			return s
+		}
+		return strings.TrimSpace(stringValue(defaults[key]))
+	}
+
+	pageURL := stringValue(metadata["url"])
+	canonicalURL := CanonicalURL(metadata)
+	description := stringValue(metadata["description"])
+	if description == "" {
+		description = strings.Join(strings.Fields(StripHTML(stringValue(metadata["summary"]))), " ")
+	}
+	if description == "" {
+		description = stringValue(defaults["description"])
+	}
+	image := value("image")
+	if image != "" {
+		image = AbsoluteURL(image, pageURL)
+	}
+	ogType := "website"
+	if _, ok := ParseDate(metadata["date"]); ok {
+		ogType = "article"
+	}
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+
+	var b strings.Builder
+	tag := func(attr, name, content string) {
+		if content != "" {
+			fmt.Fprintf(&b, "<meta %s=\"%s\" content=\"%s\">\n", attr, name, html.EscapeString(content))
+		}
+	}
+	tag("property", "og:type", ogType)
+	tag("property", "og:title", value("title"))
+	tag("property", "og:description", description)
+	tag("property", "og:url", canonicalURL)
+	tag("property", "og:image", image)
+	tag("property", "og:site_name", stringValue(defaults["site_name"]))
+	tag("name", "twitter:card", card)
+	tag("name", "twitter:site", stringValue(defaults["twitter"]))
+	tag("name", "twitter:title", value("title"))
+	tag("name", "twitter:description", description)
+	tag("name", "twitter:image", image)
+	return template.HTML(b.String())
+}
+
+// CanonicalURL returns the URL a page is known by: its "canonical" metadata,
+// for a page that's a copy of one elsewhere, or its own "url" otherwise, made
+// absolute with the -baseurl. It's empty for a page with neither.
+func CanonicalURL(metadata map[string]interface{}) string {
+	pageURL := stringValue(metadata["url"])
+	u := strings.TrimSpace(stringValue(metadata["canonical"]))
+	if u == "" {
+		u = pageURL
+	}
+	if u == "" {
+		return ""
+	}
+	return AbsoluteURL(u, pageURL)
+}
+
+// Canonical returns the canonical link tag for a page, for its template or
+// layout to put in the head: {{ canonical . }}. See CanonicalURL.
+func Canonical(metadata map[string]interface{}) template.HTML {
+	u := CanonicalURL(metadata)
+	if u == "" {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf("<link rel=\"canonical\" href=\"%s\">", html.EscapeString(u)))
+}
+
+// AbsoluteURL returns u, which is absolute, or relative to the page at
+// pageURL, with the scheme and host of the -baseurl. Without them, u is
+// returned as an absolute path.
+func AbsoluteURL(u, pageURL string) string {
+	if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return u
+	}
+	if !strings.HasPrefix(u, "/") {
+		u = path.Join(path.Dir(pageURL), u)
+	}
+	base, err := url.Parse(*baseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return u
+	}
+	return base.Scheme + "://" + base.Host + u
+}
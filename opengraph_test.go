@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOpenGraph(t *testing.T) {
+	defer func(b string) { *baseURL = b }(*baseURL)
+	*baseURL = "https://example.com/blog/"
+
+	defaults := map[string]interface{}{
+		"site_name":   "Site",
+		"twitter":     "@site",
+		"description": "Default description",
+		"image":       "/blog/card.png",
+	}
+	got := string(OpenGraph(map[string]interface{}{
+		"opengraph": defaults,
+		"title":     `Tom & "Jerry"`,
+		"url":       "/blog/2013/01/02/entry.html",
+		"date":      "2013 01 02",
+		"summary":   "<p>The  first\nwords</p>",
+		"image":     "img/photo.jpg",
+	}))
+	for _, expected := range []string{
+		`<meta property="og:type" content="article">`,
+		`<meta property="og:title" content="Tom &amp; &#34;Jerry&#34;">`,
+		`<meta property="og:description" content="The first words">`,
+		`<meta property="og:url" content="https://example.com/blog/2013/01/02/entry.html">`,
+		`<meta property="og:image" content="https://example.com/blog/2013/01/02/img/photo.jpg">`,
+		`<meta property="og:site_name" content="Site">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+		`<meta name="twitter:site" content="@site">`,
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("expected %s in:\n%s", expected, got)
+		}
+	}
+
+	got = string(OpenGraph(map[string]interface{}{"opengraph": defaults, "url": "/blog/about.html"}))
+	for _, expected := range []string{
+		`<meta property="og:type" content="website">`,
+		`<meta property="og:description" content="Default description">`,
+		`<meta property="og:image" content="https://example.com/blog/card.png">`,
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("defaults: expected %s in:\n%s", expected, got)
+		}
+	}
+	if strings.Contains(got, "og:title") {
+		t.Errorf("expected no og:title without a title, got:\n%s", got)
+	}
+
+	got = string(OpenGraph(map[string]interface{}{"title": "T"}))
+	if !strings.Contains(got, `<meta name="twitter:card" content="summary">`) || strings.Contains(got, "og:url") {
+		t.Errorf("without image or url: got:\n%s", got)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	defer func(b string) { *baseURL = b }(*baseURL)
+	*baseURL = "https://example.com/blog/"
+
+	for _, tu := range []struct {
+		metadata map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{}, ``},
+		{map[string]interface{}{"url": "/blog/about.html"}, `<link rel="canonical" href="https://example.com/blog/about.html">`},
+		{map[string]interface{}{"url": "/blog/about.html", "canonical": "https://elsewhere.com/a?b=1&c=2"}, `<link rel="canonical" href="https://elsewhere.com/a?b=1&amp;c=2">`},
+		{map[string]interface{}{"url": "/blog/2013/entry.html", "canonical": "original.html"}, `<link rel="canonical" href="https://example.com/blog/2013/original.html">`},
+	} {
+		if got := string(Canonical(tu.metadata)); got != tu.expected {
+			t.Errorf("%v: expected %s, got %s", tu.metadata, tu.expected, got)
+		}
+	}
+
+	got := string(OpenGraph(map[string]interface{}{"url": "/blog/copy.html", "canonical": "https://elsewhere.com/original"}))
+	if expected := `<meta property="og:url" content="https://elsewhere.com/original">`; !strings.Contains(got, expected) {
+		t.Errorf("expected %s in:\n%s", expected, got)
+	}
+}
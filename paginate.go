@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/peterbourgon/mergemap"
+)
+
+// PagesIn returns the metadata of every page in the Global Key map m that
+// lives in dir (relative to the source directory) or any of its
+// subdirectories, newest first.
+func PagesIn(m map[string]interface{}, dir string) []map[string]interface{} {
+	for _, level := range SplitPath(dir) {
+		m0, ok := m[level].(map[string]interface{})
+		if !ok {
+			return []map[string]interface{}{}
+		}
+		m = m0
+	}
+
+	pages := []map[string]interface{}{}
+	var collect func(map[string]interface{})
+	collect = func(m map[string]interface{}) {
+		if _, ok := m["source"].(string); ok {
+			pages = append(pages, m)
+			return
+		}
+		for _, v := range m {
+			if m0, ok := v.(map[string]interface{}); ok {
+				collect(m0)
+			}
+		}
+	}
+	collect(m)
+	sort.Sort(byDate(pages))
+	return pages
+}
+
+// Paginator is one page of a paginated listing, as exposed to templates
+// under the "paginator" key.
+type Paginator struct {
+	URL    string // of this page
+	Target string // file this page is written to
+	Number int    // starting from 1
+	Total  int    // number of pages
+	Pages  []map[string]interface{}
+	Prev   string // URL; empty for the first page
+	Next   string // URL; empty for the last page
+}
+
+// Metadata returns the Paginator as a map, omitting Prev and Next when
+// there's no such page, so templates can test for them with "if".
+func (p Paginator) Metadata() map[string]interface{} {
+	m := map[string]interface{}{
+		"url":    p.URL,
+		"number": p.Number,
+		"total":  p.Total,
+		"pages":  p.Pages,
+	}
+	if p.Prev != "" {
+		m["prev"] = p.Prev
+	}
+	if p.Next != "" {
+		m["next"] = p.Next
+	}
+	return m
+}
+
+// PageMetadata returns a copy of the metadata of the listing page, with the
+// URL and paginator of this chunk.
+func (p Paginator) PageMetadata(metadata map[string]interface{}) map[string]interface{} {
+	m := mergemap.Merge(map[string]interface{}{}, metadata)
+	m["url"] = p.URL
+	m["paginator"] = p.Metadata()
+	return m
+}
+
+// Paginate splits pages into chunks of size. The first chunk keeps the URL and
+// target of the listing page itself; chunk N is placed at page/N/ beside it.
+// A listing with only one chunk gets no prev or next links.
+func Paginate(pages []map[string]interface{}, size int, url, target string) []Paginator {
+	if size < 1 {
+		size = 1
+	}
+	total := (len(pages) + size - 1) / size
+	if total < 1 {
+		total = 1
+	}
+
+	dir := url
+	if !strings.HasSuffix(url, "/") {
+		dir = path.Dir(url)
+	}
+	dir = strings.TrimSuffix(dir, "/")
+	urlFor := func(number int) string {
+		if number == 1 {
+			return url
+		}
+		return fmt.Sprintf("%s/page/%d/", dir, number)
+	}
+	targetFor := func(number int) string {
+		if number == 1 {
+			return target
+		}
+		return filepath.Join(filepath.Dir(target), "page", fmt.Sprint(number), "index.html")
+	}
+
+	paginators := []Paginator{}
+	for number := 1; number <= total; number++ {
+		lo, hi := (number-1)*size, number*size
+		if hi > len(pages) {
+			hi = len(pages)
+		}
+		p := Paginator{
+			URL:    urlFor(number),
+			Target: targetFor(number),
+			Number: number,
+			Total:  total,
+			Pages:  pages[lo:hi],
+		}
+		if number > 1 {
+			p.Prev = urlFor(number - 1)
+		}
+		if number < total {
+			p.Next = urlFor(number + 1)
+		}
+		paginators = append(paginators, p)
+	}
+	return paginators
+}
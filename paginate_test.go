@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	pages := []map[string]interface{}{}
+	for i := 0; i < 5; i++ {
+		pages = append(pages, map[string]interface{}{"title": fmt.Sprint(i)})
+	}
+
+	single := Paginate(pages, 10, "/blog/index.html", "/tgt/blog/index.html")
+	if len(single) != 1 {
+		t.Fatalf("expected 1 page, got %d", len(single))
+	}
+	if m := single[0].Metadata(); m["prev"] != nil || m["next"] != nil {
+		t.Errorf("expected no prev or next for a single page, got %v", m)
+	}
+
+	paginators := Paginate(pages, 2, "/blog/index.html", "/tgt/blog/index.html")
+	type tuple struct{ url, target, prev, next string }
+	for i, expected := range []tuple{
+		tuple{"/blog/index.html", "/tgt/blog/index.html", "", "/blog/page/2/"},
+		tuple{"/blog/page/2/", "/tgt/blog/page/2/index.html", "/blog/index.html", "/blog/page/3/"},
+		tuple{"/blog/page/3/", "/tgt/blog/page/3/index.html", "/blog/page/2/", ""},
+	} {
+		p := paginators[i]
+		if got := (tuple{p.URL, p.Target, p.Prev, p.Next}); expected != got {
+			t.Errorf("page %d: expected %v, got %v", i+1, expected, got)
+		}
+	}
+	if n := len(paginators[2].Pages); n != 1 {
+		t.Errorf("last page: expected 1 page, got %d", n)
+	}
+}
+
+func TestTransformPaginated(t *testing.T) {
+	files := map[string]string{
+		"blog/index.html": "{\"paginate\":2}\n---\n{{ range .paginator.pages }}{{ .title }} {{ end }}{{ if .paginator.next }}{{ .paginator.next }}{{ end }}",
+	}
+	for i := 1; i <= 3; i++ {
+		files[fmt.Sprintf("blog/2013-01-0%d-post.html", i)] = fmt.Sprintf("{\"title\":\"%d\",\"date\":\"2013-01-0%d\"}\n---\n", i, i)
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		if _, err := TransformFile(s, filepath.Join(*sourceDir, "blog", "index.html"), nil); err != nil {
+			t.Fatal(err)
+		}
+		for relativePath, expected := range map[string]string{
+			"blog/index.html":        "3 2 /blog/page/2/",
+			"blog/page/2/index.html": "1 ",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, relativePath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected '%s', got '%s'", relativePath, expected, got)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "blog", "page", "1")); !os.IsNotExist(err) {
+			t.Errorf("expected no page/1/")
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+)
+
+// PartialsDir returns the absolute path of the partials directory. Its files
+// are never transformed themselves.
+func PartialsDir() string {
+	return filepath.Join(*sourceDir, *partialsDir)
+}
+
+// PartialFile returns the file of the named partial: the file at that path
+// in the partials directory, or, if there's none, the first one with that
+// name plus an extension.
+func PartialFile(name string) (string, error) {
+	filename := filepath.Join(PartialsDir(), filepath.FromSlash(name))
+	if _, err := os.Stat(filename); err == nil {
+		return filename, nil
+	}
+	if matches, _ := filepath.Glob(filename + ".*"); len(matches) > 0 {
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("no partial '%s' in %s", name, PartialsDir())
+}
+
+// RenderPartial renders the named partial with the passed metadata.
+func RenderPartial(name string, metadata map[string]interface{}, deps *Dependencies) (template.HTML, error) {
+	filename, err := PartialFile(name)
+	if err != nil {
+		return "", err
+	}
+	deps.Read(filename)
+
+	buf, err := RenderTemplate(filename, nil, metadata, deps)
+	if err != nil {
+		return "", fmt.Errorf("partial %s: %s", name, err)
+	}
+	return template.HTML(buf), nil
+}
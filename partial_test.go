@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPartials(t *testing.T) {
+	files := map[string]string{
+		"_partials/header.html": `<h1>{{ .title }}</h1>`,
+		"deep/a/b/page.html":    "{\"title\":\"Deep\"}\n---\n{{ partial \"header\" }}body",
+		"top.html":              "{\"title\":\"Top\"}\n---\n{{ partial \"header.html\" }}",
+		"missing.html":          "{}\n---\n{{ partial \"footer\" }}",
+		"card.html":             "{\"title\":\"Page\"}\n---\n{{ partial \"header\" (dict \"title\" \"Card\") }}",
+	}
+	withSite(t, files, func() {
+		render := func() {
+			s := gather(t)
+			paths, err := TransformPaths(*sourceDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, got := 4, len(paths); expected != got {
+				t.Fatalf("expected %d path(s), got %d: %v", expected, got, paths)
+			}
+			if _, errs := Transform(s, paths, 2, NewDependencyGraph()); len(errs) != 1 {
+				t.Errorf("expected 1 error (missing partial), got %v", errs)
+			}
+		}
+		check := func(name, expected string) {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+
+		render()
+		check("deep/a/b/page.html", "<h1>Deep</h1>body")
+		check("top.html", "<h1>Top</h1>")
+		check("card.html", "<h1>Card</h1>")
+
+		// Changing the partial invalidates the cached parse.
+		header := filepath.Join(*sourceDir, "_partials", "header.html")
+		Write(header, []byte(`<h2>{{ .title }}</h2>`))
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(header, later, later); err != nil {
+			t.Fatal(err)
+		}
+		render()
+		check("top.html", "<h2>Top</h2>")
+	})
+}
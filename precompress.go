@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+var (
+	// PrecompressTypes are the extensions of the target files that
+	// -precompress compresses.
+	PrecompressTypes = map[string]bool{".html": true, ".css": true, ".js": true, ".xml": true}
+
+	// Precompressors are the -precompress formats, by the extension of the
+	// compressed files they write.
+	Precompressors = map[string]func(io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser {
+			zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+			return zw
+		},
+		"br": func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriterLevel(w, brotli.BestCompression)
+		},
+	}
+
+	precompressExt = map[string]string{"gzip": ".gz", "br": ".br"}
+)
+
+// Precompress writes compressed copies of every text file in the target
+// directory, in every -precompress format, next to the original: index.html
+// gets index.html.gz for gzip, and index.html.br for br. Files smaller than
+// -precompress.min bytes aren't worth it; copies that are already newer than
+// their original are left alone.
+func Precompress(dir string) error {
+	formats := []string{}
+	for _, format := range strings.Split(*precompress, ",") {
+		switch format = strings.TrimSpace(format); {
+		case format == "":
+		case Precompressors[format] != nil:
+			formats = append(formats, format)
+		default:
+			return fmt.Errorf("unknown precompress format '%s'", format)
+		}
+	}
+	if len(formats) <= 0 {
+		return nil
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !PrecompressTypes[strings.ToLower(filepath.Ext(path))] || info.Size() < *precompressMin {
+			return nil
+		}
+		for _, format := range formats {
+			dst := path + precompressExt[format]
+			if c, err := os.Stat(dst); err == nil && c.ModTime().After(info.ModTime()) {
+				continue
+			}
+			var buf bytes.Buffer
+			w := Precompressors[format](&buf)
+			if _, err := w.Write(Read(path)); err != nil {
+				return fmt.Errorf("%s: %s", dst, err)
+			}
+			if err := w.Close(); err != nil {
+				return fmt.Errorf("%s: %s", dst, err)
+			}
+			Write(dst, buf.Bytes())
+			Debugf("%s precompressed (%d to %d byte(s))", dst, info.Size(), buf.Len())
+		}
+		return nil
+	})
+}
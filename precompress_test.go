@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestPrecompress(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-precompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	big := strings.Repeat("<p>Some text</p>\n", 100)
+	Write(filepath.Join(dir, "index.html"), []byte(big))
+	Write(filepath.Join(dir, "small.html"), []byte("<p>hi</p>"))
+	Write(filepath.Join(dir, "image.png"), []byte(big))
+
+	defer func(p string, min int64) { *precompress, *precompressMin = p, min }(*precompress, *precompressMin)
+	*precompress, *precompressMin = "gzip,br", 1024
+	if err := Precompress(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(Read(filepath.Join(dir, "index.html.gz"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadAll(zr); err != nil || string(buf) != big {
+		t.Errorf("index.html.gz: bad contents (%v)", err)
+	}
+	br := brotli.NewReader(bytes.NewReader(Read(filepath.Join(dir, "index.html.br"))))
+	if buf, err := ioutil.ReadAll(br); err != nil || string(buf) != big {
+		t.Errorf("index.html.br: bad contents (%v)", err)
+	}
+	for _, name := range []string{"small.html.gz", "image.png.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s written", name)
+		}
+	}
+
+	*precompress = "zip"
+	if err := Precompress(dir); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Redirect is a permanent redirect between two URLs.
+type Redirect struct {
+	From string
+	To   string
+}
+
+// RedirectFormat serializes every Redirect of a site into a single file at
+// the root of the target directory, for a particular web server.
+type RedirectFormat struct {
+	Filename string
+	Render   func([]Redirect) []byte
+}
+
+var (
+	// RedirectFormats are the -redirect.format values besides "html", which
+	// writes a meta-refresh page for every redirect instead.
+	RedirectFormats = map[string]RedirectFormat{
+		"netlify": {"_redirects", redirectLines("%s %s 301\n")},
+		"nginx":   {"redirects.conf", redirectLines("location = %s { return 301 %s; }\n")},
+		"apache":  {".htaccess", redirectLines("Redirect 301 %s %s\n")},
+	}
+)
+
+func redirectLines(format string) func([]Redirect) []byte {
+	return func(redirects []Redirect) []byte {
+		var buf bytes.Buffer
+		for _, r := range redirects {
+			fmt.Fprintf(&buf, format, r.From, r.To)
+		}
+		return buf.Bytes()
+	}
+}
+
+// Redirects returns the redirects of every published Markdown page among paths,
+// sorted by the URL they redirect from.
+func Redirects(s StackReader, paths []string) []Redirect {
+	redirects := []Redirect{}
+	for _, path := range paths {
+		if !isMarkdown(path) {
+			continue
+		}
+		metadata := s.Get(path)
+		if Unpublished(metadata) {
+			continue
+		}
+		from, _ := metadata["redirects"].([]string)
+		for _, url := range from {
+			redirects = append(redirects, Redirect{From: BasePath() + url, To: stringValue(metadata["url"])})
+		}
+	}
+	sort.Slice(redirects, func(i, j int) bool {
+		if redirects[i].From != redirects[j].From {
+			return redirects[i].From < redirects[j].From
+		}
+		return redirects[i].To < redirects[j].To
+	})
+	return redirects
+}
+
+// WriteRedirects writes the redirects of the site in the -redirect.format, if
+// it's anything but "html".
+func WriteRedirects(s StackReader, paths []string) error {
+	if *redirectFormat == "html" {
+		return nil // written by TransformFile
+	}
+	format, ok := RedirectFormats[*redirectFormat]
+	if !ok {
+		return fmt.Errorf("unknown redirect format '%s'", *redirectFormat)
+	}
+	redirects := Redirects(s, paths)
+	dst := filepath.Join(*targetDir, format.Filename)
+	Write(dst, format.Render(redirects))
+	Debugf("%s written (%d redirect(s))", dst, len(redirects))
+	return nil
+}
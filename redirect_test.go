@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRedirects(t *testing.T) {
+	files := map[string]string{
+		"blog/_.json":            `{"template":"entry.template"}`,
+		"blog/entry.template":    `{{ .content }}`,
+		"blog/2013-01-02-one.md": "{}\n---\nOne\n",
+	}
+	withSite(t, files, func() {
+		defer func(f string) { *redirectFormat = f }(*redirectFormat)
+		*redirectFormat = "netlify"
+
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		if err := WriteRedirects(s, paths); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(filepath.Join(*targetDir, "blog", "2013", "1", "2", "index.html")); err == nil {
+			t.Errorf("meta refresh redirect written")
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(*targetDir, "_redirects"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+		if expected, got := 7, len(lines); expected != got {
+			t.Errorf("expected %d redirect(s), got %d: %q", expected, got, lines)
+		}
+		if expected, got := "/blog/2013/01/02/index.html /blog/2013/01/02/one.html 301", lines[0]; expected != got {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+}
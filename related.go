@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sort"
+)
+
+// LinkRelated adds "related" metadata to every page among paths: the url and
+// title of up to -related.count other pages in the same language, ranked by
+// how many "tags" they share with it, and then newest first. Pages that share
+// no tags aren't related, so a page without tags gets an empty list.
+func LinkRelated(s StackReadWriter, paths []string) {
+	pages := []map[string]interface{}{}
+	for _, path := range paths {
+		switch PageExt(path) {
+		case ".html", ".md":
+		default:
+			continue
+		}
+		if metadata := s.Get(path); !Unpublished(metadata) {
+			pages = append(pages, metadata)
+		}
+	}
+
+	for _, page := range pages {
+		tags := map[string]bool{}
+		for _, tag := range Terms(page["tags"]) {
+			tags[tag] = true
+		}
+		candidates := relatedPages{}
+		for _, other := range pages {
+			if stringValue(other["source"]) == stringValue(page["source"]) || stringValue(other["lang"]) != stringValue(page["lang"]) {
+				continue
+			}
+			shared := 0
+			for _, tag := range Terms(other["tags"]) {
+				if tags[tag] {
+					shared++
+				}
+			}
+			if shared > 0 {
+				candidates.pages = append(candidates.pages, other)
+				candidates.shared = append(candidates.shared, shared)
+			}
+		}
+		sort.Sort(candidates)
+
+		related := []map[string]interface{}{}
+		for i := 0; i < len(candidates.pages) && i < *relatedCount; i++ {
+			related = append(related, neighbor(candidates.pages[i]))
+		}
+		s.Add(stringValue(page["source"]), map[string]interface{}{"related": related})
+	}
+	Debugf("related %d page(s) by tags", len(pages))
+}
+
+// relatedPages sorts pages by the number of tags they share with some other
+// page, most first, and then by date.
+type relatedPages struct {
+	pages  []map[string]interface{}
+	shared []int
+}
+
+func (a relatedPages) Len() int { return len(a.pages) }
+func (a relatedPages) Swap(i, j int) {
+	a.pages[i], a.pages[j] = a.pages[j], a.pages[i]
+	a.shared[i], a.shared[j] = a.shared[j], a.shared[i]
+}
+func (a relatedPages) Less(i, j int) bool {
+	if a.shared[i] != a.shared[j] {
+		return a.shared[i] > a.shared[j]
+	}
+	return byDate(a.pages).Less(i, j)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLinkRelated(t *testing.T) {
+	defer func(n int) { *relatedCount = n }(*relatedCount)
+	*relatedCount = 2
+	files := map[string]string{
+		"2013-01-01-one.md":   "{\"tags\":[\"go\",\"web\",\"sites\"]}\n---\nOne\n",
+		"2013-01-02-two.md":   "{\"tags\":[\"go\"]}\n---\nTwo\n",
+		"2013-01-03-three.md": "{\"tags\":[\"go\",\"web\"]}\n---\nThree\n",
+		"2013-01-04-four.md":  "{\"tags\":[\"go\"]}\n---\nFour\n",
+		"2013-01-05-five.md":  "{\"tags\":[\"cooking\"]}\n---\nFive\n",
+		"about.md":            "{}\n---\nAbout\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		LinkRelated(s, paths)
+
+		for name, expected := range map[string][]string{
+			"2013-01-01-one.md":   {"Three", "Four"}, // two shared, then newest
+			"2013-01-02-two.md":   {"Four", "Three"},
+			"2013-01-03-three.md": {"One", "Four"},
+			"2013-01-05-five.md":  {},
+			"about.md":            {},
+		} {
+			related, ok := s.Get(filepath.Join(*sourceDir, name))["related"].([]map[string]interface{})
+			if !ok {
+				t.Errorf("%s: no related list", name)
+				continue
+			}
+			got := []string{}
+			for _, page := range related {
+				got = append(got, stringValue(page["title"]))
+			}
+			if !reflect.DeepEqual(expected, got) {
+				t.Errorf("%s: expected related %v, got %v", name, expected, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ResizeModes are the ways Resize can fit an image to a size: "fit"
+	// scales it to fit inside, and "fill" scales it to cover the size, and
+	// crops the rest from its center.
+	ResizeModes = map[string]bool{"fit": true, "fill": true}
+
+	resizeMtx sync.Mutex // one resize at a time
+)
+
+// Resize writes a copy of the image that name refers to from the template at
+// path (as found by ImageFile) resized to width by height, in the mode ("fit"
+// by default), and returns its URL. A zero width or height follows from the
+// other and the aspect ratio. The copy is named for the image and the size,
+// like img/photo_300x200_fit.jpg, and is only written again when the image is
+// newer than it.
+func Resize(path, name string, width, height int, mode string, deps *Dependencies) (string, error) {
+	if mode == "" {
+		mode = "fit"
+	}
+	if !ResizeModes[mode] {
+		return "", fmt.Errorf("resize %s: unknown mode '%s'", name, mode)
+	}
+	if width < 0 || height < 0 || (width == 0 && height == 0) {
+		return "", fmt.Errorf("resize %s: bad size %dx%d", name, width, height)
+	}
+	filename, relative := ImageFile(path, name)
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", fmt.Errorf("resize %s: %s", name, err)
+	}
+	deps.Read(filename)
+
+	ext := filepath.Ext(relative)
+	dst := filepath.Join(*targetDir, fmt.Sprintf("%s_%dx%d_%s%s", strings.TrimSuffix(relative, ext), width, height, mode, ext))
+	deps.Wrote(dst)
+	url := URLFor(dst)
+
+	resizeMtx.Lock()
+	defer resizeMtx.Unlock()
+	if dstInfo, err := os.Stat(dst); err == nil && !dstInfo.ModTime().Before(info.ModTime()) {
+		Debugf("%s up to date", dst)
+		return url, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("resize %s: %s", name, err)
+	}
+	defer f.Close()
+	img, format, err := image.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("resize %s: %s", name, err)
+	}
+	buf := bytes.Buffer{}
+	resized := ResizeImage(img, width, height, mode)
+	switch format {
+	case "png":
+		err = png.Encode(&buf, resized)
+	case "jpeg":
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+	case "gif":
+		err = gif.Encode(&buf, resized, nil)
+	default:
+		err = fmt.Errorf("can't encode %s", format)
+	}
+	if err != nil {
+		return "", fmt.Errorf("resize %s: %s", name, err)
+	}
+	Write(dst, buf.Bytes())
+	Debugf("%s written (%dx%d %s)", dst, width, height, mode)
+	return url, nil
+}
+
+// ResizeImage returns img resized to width by height, as for Resize. Every
+// pixel is the average of the pixels it covers in img.
+func ResizeImage(img image.Image, width, height int, mode string) *image.RGBA {
+	b := img.Bounds()
+	sw, sh := float64(b.Dx()), float64(b.Dy())
+	switch {
+	case width == 0:
+		width = int(math.Max(1, math.Round(sw*float64(height)/sh)))
+	case height == 0:
+		height = int(math.Max(1, math.Round(sh*float64(width)/sw)))
+	}
+
+	src := b
+	scaleX, scaleY := float64(width)/sw, float64(height)/sh
+	if mode == "fill" {
+		// crop the source to the aspect ratio of the size
+		scale := math.Max(scaleX, scaleY)
+		cw, ch := int(math.Round(float64(width)/scale)), int(math.Round(float64(height)/scale))
+		x0, y0 := b.Min.X+(b.Dx()-cw)/2, b.Min.Y+(b.Dy()-ch)/2
+		src = image.Rect(x0, y0, x0+cw, y0+ch)
+	} else {
+		scale := math.Min(scaleX, scaleY)
+		width = int(math.Max(1, math.Round(sw*scale)))
+		height = int(math.Max(1, math.Round(sh*scale)))
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := span(src.Min.Y, src.Dy(), y, height)
+		for x := 0; x < width; x++ {
+			x0, x1 := span(src.Min.X, src.Dx(), x, width)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// span returns the pixels of a source dimension, starting at min and n long,
+// that pixel i of m covers: at least one.
+func span(min, n, i, m int) (int, int) {
+	lo, hi := min+i*n/m, min+(i+1)*n/m
+	if hi <= lo {
+		hi = lo + 1
+	}
+	return lo, hi
+}
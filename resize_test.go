@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResizeImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			if x >= 20 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	for _, tc := range []struct {
+		width, height int
+		mode          string
+		expected      image.Point
+	}{
+		{10, 10, "fit", image.Pt(10, 5)},
+		{10, 10, "fill", image.Pt(10, 10)},
+		{20, 0, "fit", image.Pt(20, 10)},
+		{0, 5, "fill", image.Pt(10, 5)},
+		{80, 80, "fit", image.Pt(80, 40)},
+	} {
+		resized := ResizeImage(img, tc.width, tc.height, tc.mode)
+		if got := resized.Bounds().Size(); got != tc.expected {
+			t.Errorf("%dx%d %s: expected %v, got %v", tc.width, tc.height, tc.mode, tc.expected, got)
+		}
+	}
+
+	// filling a square crops the sides, keeping the middle: half and half
+	resized := ResizeImage(img, 2, 2, "fill")
+	if r, _, _, _ := resized.At(0, 0).RGBA(); r != 0 {
+		t.Errorf("expected black on the left, got %v", resized.At(0, 0))
+	}
+	if r, _, _, _ := resized.At(1, 0).RGBA(); r != 0xffff {
+		t.Errorf("expected white on the right, got %v", resized.At(1, 0))
+	}
+}
+
+func TestResize(t *testing.T) {
+	files := map[string]string{
+		"index.html": `{{ resize "img/photo.png" 30 0 }} {{ resize "/img/photo.png" 10 10 "fill" }}`,
+	}
+	withSite(t, files, func() {
+		buf := bytes.Buffer{}
+		if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 60, 40))); err != nil {
+			t.Fatal(err)
+		}
+		source := filepath.Join(*sourceDir, "img", "photo.png")
+		Write(source, buf.Bytes())
+
+		s := gather(t)
+		output, _, err := RenderFile(s, filepath.Join(*sourceDir, "index.html"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "/img/photo_30x0_fit.png /img/photo_10x10_fill.png", string(output); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+		for name, expected := range map[string]ImageSize{
+			"photo_30x0_fit.png":   {30, 20},
+			"photo_10x10_fill.png": {10, 10},
+		} {
+			size, err := ImageSizes.Lookup(filepath.Join(*targetDir, "img", name))
+			if err != nil {
+				t.Errorf("%s: %s", name, err)
+			} else if size != expected {
+				t.Errorf("%s: expected %v, got %v", name, expected, size)
+			}
+		}
+
+		// up to date copies aren't written again
+		dst := filepath.Join(*targetDir, "img", "photo_30x0_fit.png")
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(source, old, old)
+		Write(dst, []byte("stale"))
+		if _, err := Resize(filepath.Join(*sourceDir, "index.html"), "img/photo.png", 30, 0, "", nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(Read(dst)); got != "stale" {
+			t.Errorf("expected an up to date copy to be kept")
+		}
+
+		for _, args := range []struct {
+			width, height int
+			mode          string
+		}{{0, 0, "fit"}, {-1, 10, "fit"}, {10, 10, "stretch"}} {
+			if _, err := Resize(filepath.Join(*sourceDir, "index.html"), "img/photo.png", args.width, args.height, args.mode, nil); err == nil {
+				t.Errorf("%v: expected an error", args)
+			}
+		}
+		if _, err := Resize(filepath.Join(*sourceDir, "index.html"), "missing.png", 10, 10, "", nil); err == nil {
+			t.Errorf("missing.png: expected an error")
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+)
+
+const (
+	// RobotsFile is written at the root of the target directory by -robots.
+	RobotsFile = "robots.txt"
+
+	// RobotsTemplate, at the root of the source directory, is rendered into
+	// RobotsFile with the site-level metadata, if it exists.
+	RobotsTemplate = "robots.txt.template"
+
+	// DefaultRobots is the RobotsFile without a RobotsTemplate: crawl
+	// everything.
+	DefaultRobots = "User-agent: *\nDisallow:\n"
+)
+
+// WriteRobots writes RobotsFile to the target directory, from RobotsTemplate
+// or DefaultRobots, unless the source directory has its own, which is copied
+// as it is.
+func WriteRobots(s StackReader) error {
+	if !*robots {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(*sourceDir, RobotsFile)); err == nil {
+		Debugf("%s in source; not generating it", RobotsFile)
+		return nil
+	}
+
+	buf := []byte(DefaultRobots)
+	templatePath := filepath.Join(*sourceDir, RobotsTemplate)
+	if _, err := os.Stat(templatePath); err == nil {
+		tmpl, err := texttemplate.New(RobotsTemplate).Funcs(texttemplate.FuncMap(HelperFuncs)).Parse(string(Read(templatePath)))
+		if err != nil {
+			return err
+		}
+		var output bytes.Buffer
+		if err := tmpl.Execute(&output, s.Get(*sourceDir)); err != nil {
+			return err
+		}
+		buf = output.Bytes()
+	}
+
+	dst := filepath.Join(*targetDir, RobotsFile)
+	Write(dst, buf)
+	Debugf("%s written", dst)
+	return nil
+}
+
+// RobotsMeta returns the robots meta tag for a page whose metadata sets
+// "noindex", for its template or layout to put in the head. It's empty for
+// every other page.
+func RobotsMeta(metadata map[string]interface{}) template.HTML {
+	if noindex, _ := metadata["noindex"].(bool); noindex {
+		return `<meta name="robots" content="noindex">`
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRobots(t *testing.T) {
+	defer func(r bool) { *robots = r }(*robots)
+	*robots = true
+
+	for _, tu := range []struct {
+		files    map[string]string
+		expected string
+	}{
+		{map[string]string{"index.html": "home"}, DefaultRobots},
+		{map[string]string{
+			"_.json":       `{"host":"https://example.com"}`,
+			RobotsTemplate: "User-agent: *\nDisallow: /drafts/\nSitemap: {{ .host }}/sitemap.xml?a&b\n",
+		}, "User-agent: *\nDisallow: /drafts/\nSitemap: https://example.com/sitemap.xml?a&b\n"},
+	} {
+		withSite(t, tu.files, func() {
+			if err := WriteRobots(gather(t)); err != nil {
+				t.Fatal(err)
+			}
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, RobotsFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); tu.expected != got {
+				t.Errorf("expected %q, got %q", tu.expected, got)
+			}
+		})
+	}
+
+	withSite(t, map[string]string{RobotsFile: "own"}, func() {
+		if err := WriteRobots(gather(t)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadFile(filepath.Join(*targetDir, RobotsFile)); err == nil {
+			t.Errorf("expected the source %s to be left to Transform", RobotsFile)
+		}
+	})
+}
+
+func TestRobotsMeta(t *testing.T) {
+	files := map[string]string{
+		"hidden.html": "{\"noindex\":true}\n---\n<head>{{ robots }}</head>",
+		"shown.html":  "<head>{{ robots }}</head>",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := Transform(s, paths, 1, NewDependencyGraph()); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		for name, expected := range map[string]string{
+			"hidden.html": `<head><meta name="robots" content="noindex"></head>`,
+			"shown.html":  `<head></head>`,
+		} {
+			if got := string(Read(filepath.Join(*targetDir, name))); expected != got {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+	})
+}
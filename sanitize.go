@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+var (
+	// SanitizeAllowlist maps the elements Sanitize keeps to the attributes it
+	// keeps on them. Attributes under "*" are kept on every element.
+	// -sanitize.allow adds to it.
+	SanitizeAllowlist = map[string][]string{
+		"*":          {"class", "title"},
+		"a":          {"href"},
+		"abbr":       {},
+		"b":          {},
+		"blockquote": {"cite"},
+		"br":         {},
+		"code":       {},
+		"dd":         {},
+		"del":        {},
+		"details":    {},
+		"div":        {},
+		"dl":         {},
+		"dt":         {},
+		"em":         {},
+		"figcaption": {},
+		"figure":     {},
+		"h1":         {"id"},
+		"h2":         {"id"},
+		"h3":         {"id"},
+		"h4":         {"id"},
+		"h5":         {"id"},
+		"h6":         {"id"},
+		"hr":         {},
+		"i":          {},
+		"img":        {"src", "alt", "width", "height"},
+		"ins":        {},
+		"kbd":        {},
+		"li":         {"id"},
+		"mark":       {},
+		"ol":         {"start"},
+		"p":          {},
+		"pre":        {},
+		"q":          {"cite"},
+		"s":          {},
+		"small":      {},
+		"span":       {},
+		"strong":     {},
+		"sub":        {},
+		"summary":    {},
+		"sup":        {"id"},
+		"table":      {},
+		"tbody":      {},
+		"td":         {"align", "colspan", "rowspan"},
+		"tfoot":      {},
+		"th":         {"align", "colspan", "rowspan"},
+		"thead":      {},
+		"tr":         {},
+		"u":          {},
+		"ul":         {},
+	}
+
+	// SanitizeURLSchemes are the schemes of the URLs Sanitize keeps in
+	// href, src and cite attributes. Relative URLs are always kept.
+	SanitizeURLSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+	// sanitizeDropped are the elements whose content Sanitize drops along
+	// with them, unless they're allowed: it's not meant to be read as text.
+	sanitizeDropped = map[string]bool{
+		"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+		"noscript": true, "noembed": true, "template": true, "textarea": true, "title": true, "xmp": true,
+	}
+)
+
+// SanitizeAllow adds the comma-separated elements, like video, or elements
+// with attributes, like iframe[src width], to the SanitizeAllowlist.
+func SanitizeAllow(s string) {
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, attrs := entry, ""
+		if i := strings.Index(entry, "["); i >= 0 && strings.HasSuffix(entry, "]") {
+			name, attrs = entry[:i], entry[i+1:len(entry)-1]
+		}
+		name = strings.ToLower(name)
+		SanitizeAllowlist[name] = append(SanitizeAllowlist[name], strings.Fields(strings.ToLower(attrs))...)
+	}
+}
+
+// Sanitizes returns true if a page with the passed metadata has its rendered
+// Markdown sanitized: with -sanitize, unless it sets "sanitize" false, or
+// without it, if it sets "sanitize" true.
+func Sanitizes(metadata map[string]interface{}) bool {
+	if v, ok := metadata["sanitize"].(bool); ok {
+		return v
+	}
+	return *sanitize
+}
+
+// Sanitize returns the HTML input with only the elements and attributes in
+// the SanitizeAllowlist. Other elements are removed, keeping their content,
+// except for scripts, styles and the like, which go entirely. URLs with a
+// scheme not in SanitizeURLSchemes, like javascript:, are removed, as are
+// comments.
+func Sanitize(input []byte) []byte {
+	output := bytes.Buffer{}
+	z := xhtml.NewTokenizer(bytes.NewReader(input))
+	dropped := 0 // depth of elements whose content is dropped
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			return output.Bytes()
+		case xhtml.TextToken:
+			if dropped == 0 {
+				output.WriteString(html.EscapeString(string(z.Text())))
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			t := z.Token()
+			if _, ok := SanitizeAllowlist[t.Data]; !ok {
+				if sanitizeDropped[t.Data] && tt == xhtml.StartTagToken {
+					dropped++
+				}
+				continue
+			}
+			if dropped > 0 {
+				continue
+			}
+			output.WriteString("<" + t.Data)
+			for _, attr := range t.Attr {
+				if sanitizeAttr(t.Data, attr) {
+					output.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+				}
+			}
+			if tt == xhtml.SelfClosingTagToken {
+				output.WriteString(" /")
+			}
+			output.WriteString(">")
+		case xhtml.EndTagToken:
+			name, _ := z.TagName()
+			if _, ok := SanitizeAllowlist[string(name)]; !ok {
+				if sanitizeDropped[string(name)] && dropped > 0 {
+					dropped--
+				}
+				continue
+			}
+			if dropped == 0 {
+				output.WriteString("</" + string(name) + ">")
+			}
+		}
+	}
+}
+
+// sanitizeAttr returns true if Sanitize keeps the attribute on the element.
+func sanitizeAttr(element string, attr xhtml.Attribute) bool {
+	if attr.Namespace != "" {
+		return false
+	}
+	allowed := false
+	for _, key := range append(SanitizeAllowlist["*"], SanitizeAllowlist[element]...) {
+		allowed = allowed || key == attr.Key
+	}
+	if !allowed {
+		return false
+	}
+	switch attr.Key {
+	case "href", "src", "cite":
+		u, err := url.Parse(strings.TrimSpace(attr.Val))
+		return err == nil && (u.Scheme == "" || SanitizeURLSchemes[strings.ToLower(u.Scheme)])
+	}
+	return true
+}
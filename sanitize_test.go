@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	for input, expected := range map[string]string{
+		`<p>Hello <b>world</b></p>`:                                  `<p>Hello <b>world</b></p>`,
+		`<p onclick="evil()" class="x">Hi</p>`:                       `<p class="x">Hi</p>`,
+		`<script>alert(1)</script><p>after</p>`:                      `<p>after</p>`,
+		`<a href="javascript:alert(1)">x</a>`:                        `<a>x</a>`,
+		`<a href=" JavaScript:alert(1)">x</a>`:                       `<a>x</a>`,
+		`<a href="/about.html" title="About">x</a>`:                  `<a href="/about.html" title="About">x</a>`,
+		`<a href="mailto:me@example.com">me</a>`:                     `<a href="mailto:me@example.com">me</a>`,
+		`<blink>old</blink> <!-- hidden -->`:                         `old `,
+		`<img src="a.png" onerror="evil()" alt="A &amp; B">`:         `<img src="a.png" alt="A &amp; B">`,
+		`<iframe src="https://example.com">fallback</iframe>text`:    `text`,
+		`<pre><code>if a &lt; b { &lt;script&gt; }</code></pre>`:     `<pre><code>if a &lt; b { &lt;script&gt; }</code></pre>`,
+		`<style>p { color: red }</style><h2 id="x" style="a">T</h2>`: `<h2 id="x">T</h2>`,
+	} {
+		if got := string(Sanitize([]byte(input))); got != expected {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+func TestSanitizeAllow(t *testing.T) {
+	defer func(m map[string][]string) { SanitizeAllowlist = m }(SanitizeAllowlist)
+	SanitizeAllowlist = map[string][]string{"p": {}}
+	SanitizeAllow("video, iframe[src width], P[data-x]")
+	input := `<p data-x="1"><video>v</video><iframe src="https://example.com" width="5" height="5"></iframe></p>`
+	expected := `<p data-x="1"><video>v</video><iframe src="https://example.com" width="5"></iframe></p>`
+	if got := string(Sanitize([]byte(input))); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestSanitizes(t *testing.T) {
+	defer func(s bool) { *sanitize = s }(*sanitize)
+	input := []byte("Hi <script>alert(1)</script>")
+	for _, c := range []struct {
+		flag     bool
+		metadata map[string]interface{}
+		expected bool // sanitized
+	}{
+		{false, map[string]interface{}{}, false},
+		{true, map[string]interface{}{}, true},
+		{true, map[string]interface{}{"sanitize": false}, false},
+		{false, map[string]interface{}{"sanitize": true}, true},
+	} {
+		*sanitize = c.flag
+		got := string(Markdownify(input, c.metadata))
+		if sanitized := !strings.Contains(got, "<script>"); sanitized != c.expected {
+			t.Errorf("-sanitize=%v %v: expected sanitized %v, got %q", c.flag, c.metadata, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SearchDocuments returns a document for every published page among paths,
+// for client-side search libraries like lunr.js or Fuse.js, ordered by URL.
+// Each document has the -search.fields of its page: "content" and "summary"
+// are plain text, with the HTML stripped, and other fields are the page's
+// metadata as it is. Pages that set "nosearch" are left out. Like FeedItems,
+// content is taken from pages, or rendered afresh; HTML pages, whose content
+// is their template, have none.
+func SearchDocuments(s StackReader, paths []string, pages Pages) ([]map[string]interface{}, error) {
+	fields := []string{}
+	for _, field := range strings.Split(*searchFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	docs := []map[string]interface{}{}
+	for _, path := range paths {
+		ext := PageExt(path)
+		if ext != ".html" && ext != ".md" {
+			continue
+		}
+		metadata, ok := pages[path]
+		if !ok {
+			metadata = s.Get(path)
+		}
+		if nosearch, _ := metadata["nosearch"].(bool); nosearch || Unpublished(metadata) {
+			continue
+		}
+
+		doc := map[string]interface{}{}
+		for _, field := range fields {
+			switch field {
+			case "content":
+				if plain, ok := metadata["plaincontent"]; ok {
+					doc[field] = plain
+					continue
+				}
+				content, ok := metadata["content"]
+				if !ok && ext == ".md" {
+					buf, err := RenderContent(path, metadata, nil)
+					if err != nil {
+						return []map[string]interface{}{}, err
+					}
+					content = string(buf)
+				}
+				doc[field] = PlainText(stringValue(content))
+			case "summary":
+				doc[field] = PlainText(stringValue(metadata[field]))
+			default:
+				if v, ok := metadata[field]; ok {
+					doc[field] = v
+				}
+			}
+		}
+		docs = append(docs, doc)
+	}
+
+	sort.Sort(searchDocuments(docs))
+	return docs, nil
+}
+
+type searchDocuments []map[string]interface{}
+
+func (a searchDocuments) Len() int      { return len(a) }
+func (a searchDocuments) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a searchDocuments) Less(i, j int) bool {
+	return stringValue(a[i]["url"]) < stringValue(a[j]["url"])
+}
+
+// WriteSearchIndex writes the SearchDocuments, as a JSON array, to the
+// -search.index path in the target directory, if there is one.
+func WriteSearchIndex(s StackReader, paths []string, pages Pages) error {
+	if *searchIndex == "" {
+		return nil
+	}
+	docs, err := SearchDocuments(s, paths, pages)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(*targetDir, *searchIndex)
+	Write(dst, append(buf, '\n'))
+	Debugf("%s written (%d page(s))", dst, len(docs))
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearchIndex(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"page.template"}`,
+		"page.template": `{{ .content }}`,
+		"hello.md":      "{\"title\":\"Hello\",\"tags\":[\"go\"]}\n---\nHi.\n\nSome *emphasis* &amp; more.\n",
+		"secret.md":     "{\"title\":\"Secret\",\"nosearch\":true}\n---\nHidden.\n",
+		"about.html":    "{\"title\":\"About\",\"summary\":\"<p>About   us</p>\"}\n---\n<p>About us</p>\n",
+	}
+	withSite(t, files, func() {
+		defer func(i, f string) { *searchIndex, *searchFields = i, f }(*searchIndex, *searchFields)
+		*searchIndex = "search-index.json"
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+
+		docs := []map[string]interface{}{}
+		if err := json.Unmarshal(Read(filepath.Join(*targetDir, "search-index.json")), &docs); err != nil {
+			t.Fatal(err)
+		}
+		expected := []map[string]interface{}{
+			{"title": "About", "url": "/about.html", "content": ""},
+			{"title": "Hello", "url": "/hello.html", "tags": []interface{}{"go"}, "content": "Hi. Some emphasis & more."},
+		}
+		if !reflect.DeepEqual(expected, docs) {
+			t.Errorf("expected %v, got %v", expected, docs)
+		}
+
+		*searchFields = "url,summary"
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		docs = []map[string]interface{}{}
+		if err := json.Unmarshal(Read(filepath.Join(*targetDir, "search-index.json")), &docs); err != nil {
+			t.Fatal(err)
+		}
+		if expected := []map[string]interface{}{{"url": "/about.html", "summary": "About us"}, {"url": "/hello.html", "summary": "Hi. Some emphasis & more."}}; !reflect.DeepEqual(expected, docs) {
+			t.Errorf("-search.fields url,summary: expected %v, got %v", expected, docs)
+		}
+	})
+}
+
+func TestPlainText(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":                                "",
+		"<p>Hi</p>":                       "Hi",
+		"<h1>One</h1>\n<p>two  three</p>": "One two three",
+		"<p>a &lt;b&gt;</p>":              "a <b>",
+	} {
+		if got := PlainText(input); got != expected {
+			t.Errorf("PlainText(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
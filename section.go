@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SectionName is the name, less its extension, of the page that's its
+// directory's section index: its landing page, which lists the pages in it.
+const SectionName = "_index"
+
+// IsSection returns true if the file at path is a section index page.
+func IsSection(path string) bool {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) == SectionName
+}
+
+// SectionPages returns the metadata of every page in the directory of the
+// section index page at path, and below, from the Global Key map in its
+// metadata, newest first. The section page itself isn't one of them.
+func SectionPages(path string, metadata map[string]interface{}) []map[string]interface{} {
+	files, _ := metadata[*globalKey].(map[string]interface{})
+	pages := []map[string]interface{}{}
+	for _, page := range PagesIn(files, SourceRelative(filepath.Dir(path))) {
+		if page["source"] != path {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSection(t *testing.T) {
+	files := map[string]string{
+		"_.json":              `{"template":"page.template"}`,
+		"blog/page.template":  `{{ .content }}`,
+		"blog/_index.md":      "{\"title\":\"Blog\"}\n---\n{{ range .pages }}[{{ .title }}]{{ end }}\n",
+		"blog/first.md":       "{\"title\":\"First\",\"date\":\"2015-01-01\"}\n---\nOne.\n",
+		"blog/second.md":      "{\"title\":\"Second\",\"date\":\"2015-01-02\"}\n---\nTwo.\n",
+		"blog/old/third.html": "{\"title\":\"Third\",\"date\":\"2014-01-01\"}\n---\nThree.\n",
+		"other.html":          "{\"title\":\"Other\"}\n---\nElsewhere.\n",
+	}
+	withSite(t, files, func() {
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		buf := string(Read(filepath.Join(*targetDir, "blog", "index.html")))
+		if expected := "[Second][First][Third]"; !strings.Contains(buf, expected) {
+			t.Errorf("expected %s in the section index, got %q", expected, buf)
+		}
+		if strings.Contains(buf, "[Blog]") || strings.Contains(buf, "[Other]") {
+			t.Errorf("expected only the section's pages, got %q", buf)
+		}
+
+		s := gather(t)
+		if url := s.Get(filepath.Join(*sourceDir, "blog", "_index.md"))["url"]; url != "/blog/index.html" {
+			t.Errorf("expected the section index at /blog/index.html, got %v", url)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ContentEncodings are the encodings of precompressed files that
+	// ServePrecompressed serves, in order of preference, with the extensions
+	// of the files.
+	ContentEncodings = []struct{ Encoding, Ext string }{
+		{"br", ".br"},
+		{"gzip", ".gz"},
+	}
+)
+
+// ServePrecompressed wraps the passed handler, which serves the files in dir.
+// When a precompressed copy of the requested file exists (index.html.gz next
+// to index.html, say), and the client accepts its encoding, it's served
+// instead, with the type of the original and an ETag of its own. Other
+// requests go to the wrapped handler.
+func ServePrecompressed(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		urlPath := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			urlPath = path.Join(urlPath, "index.html")
+		}
+		filename := filepath.Join(dir, filepath.FromSlash(urlPath))
+
+		for _, ce := range ContentEncodings {
+			if !acceptsEncoding(r, ce.Encoding) {
+				continue
+			}
+			f, err := os.Open(filename + ce.Ext)
+			if err != nil {
+				continue
+			}
+			defer f.Close()
+			if info, err := f.Stat(); err == nil && !info.IsDir() {
+				contentType := mime.TypeByExtension(filepath.Ext(filename))
+				if contentType == "" {
+					contentType = "application/octet-stream"
+				}
+				w.Header().Set("Content-Type", contentType)
+				w.Header().Set("Content-Encoding", ce.Encoding)
+				if etag, err := ETags.Lookup(filename+ce.Ext, info); err == nil {
+					w.Header().Set("ETag", etag)
+				}
+				http.ServeContent(w, r, filename, info.ModTime(), f)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ETagCache holds the ETags of served files, keyed by file, so that each is
+// only hashed once. A file is hashed again whenever its modification time
+// changes. It's safe for concurrent use.
+type ETagCache struct {
+	mtx sync.Mutex
+	m   map[string]cachedETag // filename: ETag
+}
+
+type cachedETag struct {
+	modTime time.Time
+	etag    string
+}
+
+var (
+	ETags = NewETagCache()
+)
+
+func NewETagCache() *ETagCache {
+	return &ETagCache{
+		m: map[string]cachedETag{},
+	}
+}
+
+// Lookup returns the strong ETag of filename, whose FileInfo is passed: a hash
+// of its contents.
+func (c *ETagCache) Lookup(filename string, info os.FileInfo) (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if cached, ok := c.m[filename]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.etag, nil
+	}
+	sum, err := HashFile(filename)
+	if err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%x"`, sum[:8])
+	c.m[filename] = cachedETag{modTime: info.ModTime(), etag: etag}
+	return etag, nil
+}
+
+// ServeETags wraps the passed handler, which serves the files in dir, adding
+// the ETag of the requested file to the response. An http.FileServer answers
+// requests whose If-None-Match has it with 304 Not Modified.
+func ServeETags(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			urlPath = path.Join(urlPath, "index.html")
+		}
+		filename := filepath.Join(dir, filepath.FromSlash(urlPath))
+		if info, err := os.Stat(filename); err == nil && info.Mode().IsRegular() {
+			if etag, err := ETags.Lookup(filename, info); err == nil {
+				w.Header().Set("ETag", etag)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsEncoding returns true if the request's Accept-Encoding header lists
+// the encoding, without a zero quality.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, field := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(field, ";")
+		if strings.TrimSpace(params[0]) != encoding {
+			continue
+		}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if q, err := strconv.ParseFloat(kv[len(kv)-1], 64); kv[0] == "q" && err == nil && q <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+var (
+	NotFoundPage = "404.html"
+)
+
+// ServeNotFound wraps the passed handler, which serves the files in dir. When
+// the requested file doesn't exist, and dir has a NotFoundPage, that's served
+// with a 404 status. Otherwise, the wrapped handler deals with it.
+func ServeNotFound(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if _, err := os.Stat(filename); !os.IsNotExist(err) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		serveNotFound(w, r, dir, next)
+	})
+}
+
+// serveNotFound serves the NotFoundPage of dir with a 404 status, or, if
+// there's none, lets the fallback handler deal with the request.
+func serveNotFound(w http.ResponseWriter, r *http.Request, dir string, fallback http.Handler) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, NotFoundPage))
+	if err != nil {
+		fallback.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(buf)
+}
+
+// HideListings wraps the passed handler, which serves the files in dir, so
+// that requests for directories without an index.html are answered as if
+// they didn't exist, rather than with a listing of the directory.
+func HideListings(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if info, err := os.Stat(filename); err == nil && info.IsDir() {
+			if _, err := os.Stat(filepath.Join(filename, "index.html")); os.IsNotExist(err) {
+				serveNotFound(w, r, dir, http.NotFoundHandler())
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServePrecompressed(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Write(filepath.Join(dir, "index.html"), []byte("plain html"))
+	Write(filepath.Join(dir, "index.html.gz"), []byte("gzipped html"))
+	Write(filepath.Join(dir, "style.css"), []byte("plain css"))
+
+	h := ServePrecompressed(dir, http.FileServer(http.Dir(dir)))
+	for _, c := range []struct {
+		path, acceptEncoding                         string
+		expectedBody, expectedEncoding, expectedType string
+	}{
+		{"/", "gzip, deflate", "gzipped html", "gzip", "text/html; charset=utf-8"},
+		{"/index.html", "deflate, gzip;q=0.5", "gzipped html", "gzip", "text/html; charset=utf-8"},
+		{"/", "gzip;q=0", "plain html", "", "text/html; charset=utf-8"},
+		{"/", "", "plain html", "", "text/html; charset=utf-8"},
+		{"/style.css", "gzip", "plain css", "", "text/css; charset=utf-8"},
+	} {
+		r := httptest.NewRequest("GET", c.path, nil)
+		if c.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", c.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Body.String(); got != c.expectedBody {
+			t.Errorf("%s (%s): expected body %q, got %q", c.path, c.acceptEncoding, c.expectedBody, got)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != c.expectedEncoding {
+			t.Errorf("%s (%s): expected encoding %q, got %q", c.path, c.acceptEncoding, c.expectedEncoding, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != c.expectedType {
+			t.Errorf("%s (%s): expected type %q, got %q", c.path, c.acceptEncoding, c.expectedType, got)
+		}
+	}
+}
+
+func TestServeNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Write(filepath.Join(dir, "a.html"), []byte("a"))
+
+	h := ServeNotFound(dir, http.FileServer(http.Dir(dir)))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/missing"); w.Code != http.StatusNotFound || w.Body.String() != "404 page not found\n" {
+		t.Errorf("without %s: got %d %q", NotFoundPage, w.Code, w.Body.String())
+	}
+	Write(filepath.Join(dir, NotFoundPage), []byte("<p>Nothing here</p>"))
+	if w := get("/missing/page.html"); w.Code != http.StatusNotFound || w.Body.String() != "<p>Nothing here</p>" {
+		t.Errorf("with %s: got %d %q", NotFoundPage, w.Code, w.Body.String())
+	}
+	if w := get("/a.html"); w.Code != http.StatusOK || w.Body.String() != "a" {
+		t.Errorf("existing file: got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHideListings(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Write(filepath.Join(dir, "listed", "a.html"), []byte("a"))
+	Write(filepath.Join(dir, "indexed", "index.html"), []byte("index"))
+
+	h := HideListings(dir, http.FileServer(http.Dir(dir)))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/listed/"); w.Code != http.StatusNotFound {
+		t.Errorf("directory without index: got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/indexed/"); w.Code != http.StatusOK || w.Body.String() != "index" {
+		t.Errorf("directory with index: got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/listed/a.html"); w.Code != http.StatusOK || w.Body.String() != "a" {
+		t.Errorf("file: got %d %q", w.Code, w.Body.String())
+	}
+	Write(filepath.Join(dir, NotFoundPage), []byte("<p>Nothing here</p>"))
+	if w := get("/listed"); w.Code != http.StatusNotFound || w.Body.String() != "<p>Nothing here</p>" {
+		t.Errorf("directory with %s: got %d %q", NotFoundPage, w.Code, w.Body.String())
+	}
+}
+
+func TestServeETags(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "grender-test-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "style.css")
+	Write(filename, []byte("a { color: red }"))
+	Write(filepath.Join(dir, "style.css.gz"), []byte("gzipped css"))
+
+	h := ServePrecompressed(dir, ServeETags(dir, http.FileServer(http.Dir(dir))))
+	get := func(ifNoneMatch, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/style.css", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("expected 200 with a strong ETag, got %d with %q", w.Code, etag)
+	}
+	if w := get(etag, ""); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match %s: expected 304, got %d", etag, w.Code)
+	}
+	if w := get(`"other"`, ""); w.Code != http.StatusOK {
+		t.Errorf("If-None-Match of another ETag: expected 200, got %d", w.Code)
+	}
+	gzipped := get("", "gzip").Header().Get("ETag")
+	if gzipped == "" || gzipped == etag {
+		t.Errorf("expected a different ETag for the gzipped file, got %q", gzipped)
+	}
+
+	// a change to the contents changes the ETag
+	later := time.Now().Add(time.Hour)
+	Write(filename, []byte("a { color: blue }"))
+	os.Chtimes(filename, later, later)
+	if w := get(etag, ""); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("after a change: expected 200 with a new ETag, got %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+}
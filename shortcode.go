@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	shortcodeRegexp    = regexp.MustCompile(`\{\{<\s*(/)?\s*([\w.\-]+(?:/[\w.\-]+)*)(.*?)(\s/)?\s*>\}\}`)
+	shortcodeArgRegexp = regexp.MustCompile(`(?:(\w+)=)?("(?:[^"\\]|\\.)*"|\S+)`)
+)
+
+// ShortcodesDir returns the absolute path of the shortcodes directory. Its
+// files are never transformed themselves.
+func ShortcodesDir() string {
+	return filepath.Join(*sourceDir, *shortcodesDir)
+}
+
+// ShortcodeFile returns the template file of the named shortcode, looked up
+// like a partial's.
+func ShortcodeFile(name string) (string, error) {
+	filename := filepath.Join(ShortcodesDir(), filepath.FromSlash(name))
+	if _, err := os.Stat(filename); err == nil {
+		return filename, nil
+	}
+	if matches, _ := filepath.Glob(filename + ".*"); len(matches) > 0 {
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("unknown shortcode '%s' (no template in %s)", name, ShortcodesDir())
+}
+
+// Shortcodes are the rendered shortcodes of a page, by the placeholders that
+// stand in for them while the page is rendered.
+type Shortcodes map[string][]byte
+
+// ExtractShortcodes renders every {{< name args >}} shortcode in the content,
+// or {{< name args >}}inner{{< /name >}} pair, with its template from the
+// shortcodes directory, and replaces it with a placeholder. The template gets
+// the page metadata, plus the positional "args", the name=value "params", and
+// the raw "inner" content of a pair. Shortcodes inside a pair aren't expanded.
+//
+// Shortcodes are extracted before the content is rendered as a template and
+// as Markdown, and their output is put back afterwards, with Restore.
+func ExtractShortcodes(path string, content []byte, metadata map[string]interface{}, deps *Dependencies) ([]byte, Shortcodes, error) {
+	shortcodes := Shortcodes{}
+	matches := shortcodeRegexp.FindAllSubmatchIndex(content, -1)
+	if len(matches) <= 0 {
+		return content, shortcodes, nil
+	}
+
+	output := bytes.Buffer{}
+	last := 0
+	for i := 0; i < len(matches); i++ {
+		m := matches[i]
+		line := 1 + bytes.Count(content[:m[0]], []byte("\n"))
+		name := string(content[m[4]:m[5]])
+		if m[2] >= 0 {
+			return []byte{}, Shortcodes{}, fmt.Errorf("%s:%d: closing shortcode '%s' without an opening one", path, line, name)
+		}
+
+		ctx := map[string]interface{}{}
+		for k, v := range metadata {
+			ctx[k] = v
+		}
+		ctx["args"], ctx["params"] = shortcodeArgs(string(content[m[6]:m[7]]))
+		end := m[1]
+		if m[8] < 0 { // not self-closing; look for the closing shortcode
+			for j := i + 1; j < len(matches); j++ {
+				if c := matches[j]; c[2] >= 0 && string(content[c[4]:c[5]]) == name {
+					ctx["inner"] = string(content[m[1]:c[0]])
+					end = c[1]
+					i = j
+					break
+				}
+			}
+		}
+
+		filename, err := ShortcodeFile(name)
+		if err != nil {
+			return []byte{}, Shortcodes{}, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		deps.Read(filename)
+		buf, err := RenderTemplate(filename, nil, ctx, deps)
+		if err != nil {
+			return []byte{}, Shortcodes{}, fmt.Errorf("%s:%d: shortcode %s: %s", path, line, name, err)
+		}
+
+		placeholder := fmt.Sprintf("GRENDERSHORTCODE%dX", len(shortcodes))
+		shortcodes[placeholder] = buf
+		output.Write(content[last:m[0]])
+		output.WriteString(placeholder)
+		last = end
+	}
+	output.Write(content[last:])
+	return output.Bytes(), shortcodes, nil
+}
+
+// Restore replaces the placeholders in the rendered content with the
+// shortcodes' output. A placeholder Markdown wrapped in a paragraph of its
+// own loses the paragraph.
+func (shortcodes Shortcodes) Restore(content []byte) []byte {
+	for placeholder, buf := range shortcodes {
+		content = bytes.Replace(content, []byte("<p>"+placeholder+"</p>"), buf, -1)
+		content = bytes.Replace(content, []byte(placeholder), buf, -1)
+	}
+	return content
+}
+
+// shortcodeArgs splits shortcode arguments on whitespace, into positional
+// args and name=value params. Values may be double-quoted Go strings.
+func shortcodeArgs(s string) ([]string, map[string]string) {
+	args, params := []string{}, map[string]string{}
+	for _, m := range shortcodeArgRegexp.FindAllStringSubmatch(strings.TrimSpace(s), -1) {
+		value := m[2]
+		if strings.HasPrefix(value, `"`) {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		}
+		if m[1] != "" {
+			params[m[1]] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+	return args, params
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestShortcodeArgs(t *testing.T) {
+	args, params := shortcodeArgs(` abc123 "two words" width=640 title="a \"b\"" `)
+	if expected, got := `[abc123 two words]`, fmt.Sprint(args); expected != got {
+		t.Errorf("args: expected %s, got %s", expected, got)
+	}
+	if expected, got := `map[title:a "b" width:640]`, fmt.Sprint(params); expected != got {
+		t.Errorf("params: expected %s, got %s", expected, got)
+	}
+}
+
+func TestShortcodes(t *testing.T) {
+	files := map[string]string{
+		"_.json":                     `{"template":"page.template","title":"Page"}`,
+		"page.template":              `{{ .content }}`,
+		"_shortcodes/youtube.html":   `<iframe src="https://www.youtube.com/embed/{{ index .args 0 }}" width="{{ .params.width }}"></iframe>`,
+		"_shortcodes/note.html":      `<aside title="{{ .title }}">{{ markdownify .inner }}</aside>`,
+		"_shortcodes/sub/inline.tpl": `<b>{{ len .args }}</b>`,
+		"page.md": "# {{ .title }}\n\n{{< youtube abc123 width=640 >}}\n\n" +
+			"{{< note >}}Some *inner* text{{< /note >}}\n\nan {{< sub/inline a b />}} one\n",
+		"unknown.md":  "text\n\n{{< nope >}}\n",
+		"unopened.md": "text\n{{< /note >}}\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		buf, _, err := RenderFile(s, *sourceDir+"/page.md", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `<h1 id="page">Page <a class="heading-anchor" href="#page">#</a></h1>` + "\n\n" +
+			`<iframe src="https://www.youtube.com/embed/abc123" width="640"></iframe>` + "\n\n" +
+			`<aside title="Page"><p>Some <em>inner</em> text</p>` + "\n" + `</aside>` + "\n\n" +
+			`<p>an <b>2</b> one</p>` + "\n"
+		if got := string(buf); expected != got {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+
+		for file, message := range map[string]string{
+			"unknown.md":  "unknown.md:3: unknown shortcode 'nope'",
+			"unopened.md": "unopened.md:2: closing shortcode 'note' without an opening one",
+		} {
+			_, _, err := RenderFile(s, *sourceDir+"/"+file, nil)
+			if err == nil || !strings.Contains(err.Error(), message) {
+				t.Errorf("%s: expected error containing '%s', got %v", file, message, err)
+			}
+		}
+	})
+}
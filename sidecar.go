@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SidecarExt is appended to the path of a source file to give its sidecar:
+// a file of metadata next to it, like post.md.json for post.md, for pipelines
+// that leave the source file itself alone.
+const SidecarExt = ".json"
+
+// IsSidecar returns true if the file at path is the sidecar of another file,
+// rather than metadata for its whole directory.
+func IsSidecar(path string) bool {
+	if !strings.HasSuffix(path, SidecarExt) {
+		return false
+	}
+	info, err := os.Stat(strings.TrimSuffix(path, SidecarExt))
+	return err == nil && !info.IsDir()
+}
+
+// SidecarMetadata returns the metadata in the sidecar of the source file at
+// path, which is empty if it has none.
+func SidecarMetadata(path string) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	filename := path + SidecarExt
+	if _, err := os.Stat(filename); err != nil {
+		return m, nil
+	}
+	if err := UnmarshalJSON(Read(filename), &m); err != nil {
+		return map[string]interface{}{}, fmt.Errorf("%s: parse JSON: %s", filename, err)
+	}
+	return m, nil
+}
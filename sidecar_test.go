@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSidecar(t *testing.T) {
+	files := map[string]string{
+		"_.json":         `{"author":"dir","title":"dir"}`,
+		"post.md":        "{\"title\":\"Inline\"}\n---\nPost.\n",
+		"post.md.json":   `{"title":"Sidecar","author":"sidecar","tags":["a"]}`,
+		"page.html":      "Page.\n",
+		"page.html.json": `{"title":"Page"}`,
+		"plain.md":       "Plain.\n",
+		"data/feed.json": `{"not":"a sidecar"}`,
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		for name, expected := range map[string]map[string]string{
+			"post.md":   {"title": "Inline", "author": "sidecar"},
+			"page.html": {"title": "Page", "author": "dir"},
+			"plain.md":  {"title": "dir", "author": "dir"},
+			"data/x.md": {"not": "a sidecar"},
+		} {
+			metadata := s.Get(filepath.Join(*sourceDir, name))
+			for key, value := range expected {
+				if got := metadata[key]; got != value {
+					t.Errorf("%s: expected %s %q, got %v", name, key, value, got)
+				}
+			}
+		}
+		if s.Get(filepath.Join(*sourceDir, "plain.md"))["tags"] != nil {
+			t.Errorf("expected a sidecar to apply only to its own file")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StdoutTarget is the -target that writes single files to standard output.
+const StdoutTarget = "-"
+
+// SourceFiles returns the files named by a -source that isn't a directory:
+// a single file, or a glob of them. ok is false for a directory, which is
+// built as a whole.
+func SourceFiles(source string) (files []string, ok bool, err error) {
+	if strings.ContainsAny(source, "*?[") {
+		if files, err = filepath.Glob(source); err != nil {
+			return nil, true, err
+		}
+		if len(files) <= 0 {
+			return nil, true, fmt.Errorf("%s: no such files", source)
+		}
+		return files, true, nil
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, false, err
+	}
+	if info.IsDir() {
+		return nil, false, nil
+	}
+	return []string{source}, true, nil
+}
+
+// SourceRoot returns the source directory the files are rendered in: the
+// topmost directory above all of them below the working directory, so that
+// they inherit the metadata of the .json files between it and them, or their
+// common directory, outside of it.
+func SourceRoot(files []string) (string, error) {
+	root := ""
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if root == "" {
+			root = dir
+		}
+		for !within(root, dir) && filepath.Dir(root) != root {
+			root = filepath.Dir(root)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if rel, _ := filepath.Rel(wd, root); within(wd, root) && rel != "." {
+		root = filepath.Join(wd, strings.Split(filepath.ToSlash(rel), "/")[0])
+	}
+	return root, nil
+}
+
+// copyTo streams the contents of the file at path to w.
+func copyTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// within returns true if dir is root, or below it.
+func within(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RenderFiles gathers the metadata of the SourceRoot of the files, and
+// renders just them: into the target directory, as a build would, or, with a
+// -target of StdoutTarget, one after another to w, with the log on stderr.
+func RenderFiles(files []string, w io.Writer) error {
+	removed, written, bundles = nil, map[string]bool{}, map[string][]string{}
+	root, err := SourceRoot(files)
+	if err != nil {
+		return err
+	}
+	*sourceDir = root
+	toStdout := *targetDir == StdoutTarget
+	if toStdout {
+		log.SetOutput(os.Stderr)
+		defer log.SetOutput(os.Stdout)
+		if *targetDir, err = filepath.Abs("."); err != nil { // for urls and targets
+			return err
+		}
+		defer func() { *targetDir = StdoutTarget }()
+	}
+
+	s, paths, err := Gather()
+	if err != nil {
+		return err
+	}
+	Summarize(s, paths, *jobs, NewDependencyGraph())
+	for _, path := range files {
+		if !toStdout {
+			if _, err := TransformFile(s, path, nil); err != nil {
+				return fmt.Errorf("%s: %s", path, err)
+			}
+			continue
+		}
+		switch PageExt(path) {
+		case ".html", ".md":
+			if Unpublished(s.Get(path)) {
+				Debugf("%s unpublished; skipping", path)
+				continue
+			}
+			buf, _, err := RenderFile(s, path, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %s", path, err)
+			}
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		default:
+			if err := copyTo(w, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
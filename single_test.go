@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSourceFiles(t *testing.T) {
+	files := map[string]string{
+		"a.md":     "A.\n",
+		"b.md":     "B.\n",
+		"c.html":   "C.\n",
+		"sub/d.md": "D.\n",
+	}
+	withSite(t, files, func() {
+		src := func(name string) string { return filepath.Join(*sourceDir, name) }
+		for source, expected := range map[string][]string{
+			*sourceDir:     nil,
+			src("a.md"):    {src("a.md")},
+			src("*.md"):    {src("a.md"), src("b.md")},
+			src("sub/*.*"): {src("sub/d.md")},
+		} {
+			got, ok, err := SourceFiles(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (expected != nil) || strings.Join(got, ",") != strings.Join(expected, ",") {
+				t.Errorf("%s: expected %v, got %v (%v)", source, expected, got, ok)
+			}
+		}
+		if _, ok, err := SourceFiles(src("*.txt")); !ok || err == nil {
+			t.Errorf("expected an error for a glob without matches")
+		}
+	})
+}
+
+func TestSourceRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tu := range []struct {
+		files    []string
+		expected string
+	}{
+		{[]string{filepath.Join(wd, "post.md")}, wd},
+		{[]string{filepath.Join(wd, "src", "blog", "post.md")}, filepath.Join(wd, "src")},
+		{[]string{"/elsewhere/blog/a.md", "/elsewhere/blog/b.md"}, "/elsewhere/blog"},
+		{[]string{"/elsewhere/blog/a.md", "/elsewhere/about/b.md"}, "/elsewhere"},
+	} {
+		got, err := SourceRoot(tu.files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tu.expected {
+			t.Errorf("%v: expected %s, got %s", tu.files, tu.expected, got)
+		}
+	}
+}
+
+func TestRenderFiles(t *testing.T) {
+	files := map[string]string{
+		"_.json":           `{"template":"page.template","site":"S"}`,
+		"page.template":    `{{ .site }}:{{ .content }}`,
+		"blog/_.json":      `{"template":"../page.template"}`,
+		"blog/post.md":     "Post.\n",
+		"blog/other.md":    "Other.\n",
+		"blog/ignored.txt": "Ignored.\n",
+	}
+	withSite(t, files, func() {
+		root := filepath.Dir(*sourceDir)
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(root); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chdir(wd)
+
+		defer func(tgt string) { *targetDir = tgt }(*targetDir)
+		*targetDir = StdoutTarget
+		var buf bytes.Buffer
+		if err := RenderFiles([]string{filepath.Join(root, "src", "blog", "post.md")}, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); !strings.HasPrefix(got, "S:") || !strings.Contains(got, "Post.") || strings.Contains(got, "Other.") {
+			t.Errorf("expected the post, with the inherited metadata, got %q", got)
+		}
+		if *targetDir != StdoutTarget {
+			t.Errorf("expected -target to be restored, got %s", *targetDir)
+		}
+
+		*targetDir = filepath.Join(root, "tgt")
+		if err := RenderFiles([]string{filepath.Join(root, "src", "blog", "post.md")}, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "tgt", "blog", "post.html")); err != nil {
+			t.Errorf("expected the post in the target directory: %s", err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "tgt", "blog", "other.html")); err == nil {
+			t.Errorf("expected only the post in the target directory")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// baseSources are the source directories listed before the last one in a
+// comma-separated -source, in order. The last one becomes the sourceDir.
+var baseSources = []string{}
+
+// SplitSources splits a comma-separated -source into the base sources and the
+// sourceDir, making every directory absolute.
+func SplitSources() error {
+	dirs := strings.Split(*sourceDir, ",")
+	baseSources = []string{}
+	for _, dir := range dirs[:len(dirs)-1] {
+		if dir = strings.TrimSpace(dir); dir == "" {
+			continue
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		baseSources = append(baseSources, abs)
+	}
+	*sourceDir = strings.TrimSpace(dirs[len(dirs)-1])
+	return nil
+}
+
+// SourceDirs returns every source directory, in the order they're walked:
+// the base sources, then the sourceDir.
+func SourceDirs() []string {
+	return append(append([]string{}, baseSources...), *sourceDir)
+}
+
+// SourceDirOf returns the source directory that path is in, preferring the
+// deepest one if they're nested, and the sourceDir if it's in none of them.
+func SourceDirOf(path string) string {
+	found := ""
+	for _, dir := range SourceDirs() {
+		if within(dir, path) && len(dir) > len(found) {
+			found = dir
+		}
+	}
+	if found == "" {
+		return *sourceDir
+	}
+	return found
+}
+
+// SourceRelative returns path relative to the source directory it's in.
+func SourceRelative(path string) string {
+	return Relative(SourceDirOf(path), path)
+}
+
+// SourceFile returns the file at the same path as the source file at path,
+// relative to its source directory, in the last source directory that has
+// one, and path itself if none does, or if path isn't in a source directory.
+func SourceFile(path string) string {
+	if !within(SourceDirOf(path), path) {
+		return path
+	}
+	dirs, relative := SourceDirs(), SourceRelative(path)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		filename := filepath.Join(dirs[i], relative)
+		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
+			return filename
+		}
+	}
+	return path
+}
+
+// OverriddenBy returns the file in a later source directory that overrides
+// the source file at path, as found by SourceFile. JSON files never override
+// each other, as they only apply to the pages of their own tree.
+func OverriddenBy(path string) (string, bool) {
+	if filepath.Ext(path) == ".json" {
+		return "", false
+	}
+	if other := SourceFile(path); other != path {
+		return other, true
+	}
+	return "", false
+}
+
+// IsSiteDir returns true if path is the layouts, partials, shortcodes or
+// data directory of one of the source directories, or the -static directory.
+// None of them hold pages.
+func IsSiteDir(path string) bool {
+	if path == *staticDir {
+		return true
+	}
+	dir := SourceDirOf(path)
+	for _, name := range []string{*layoutsDir, *partialsDir, *shortcodesDir, *dataDir} {
+		if path == filepath.Join(dir, name) {
+			return true
+		}
+	}
+	return false
+}
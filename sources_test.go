@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSources(t *testing.T) {
+	defer func(src string) { *sourceDir, baseSources = src, []string{} }(*sourceDir)
+	*sourceDir = "/theme, /shared,/site"
+	if err := SplitSources(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"/theme", "/shared", "/site"}; !reflect.DeepEqual(SourceDirs(), expected) {
+		t.Errorf("expected %v, got %v", expected, SourceDirs())
+	}
+	if *sourceDir != "/site" {
+		t.Errorf("expected the last directory as the source directory, got %s", *sourceDir)
+	}
+}
+
+func TestSourceDirs(t *testing.T) {
+	files := map[string]string{
+		"blog/_.json":        `{"template":"page.template","author":"site"}`,
+		"blog/page.template": `site: {{ .author }} {{ .content }}`,
+		"blog/b.md":          "Site B.\n",
+		"style.css":          "site\n",
+	}
+	withSite(t, files, func() {
+		theme := filepath.Join(filepath.Dir(*sourceDir), "theme")
+		for name, contents := range map[string]string{
+			"blog/_.json":        `{"template":"page.template","author":"theme"}`,
+			"blog/page.template": `theme: {{ .author }} {{ .content }}`,
+			"blog/a.md":          "Theme A.\n",
+			"blog/b.md":          "Theme B.\n",
+			"style.css":          "theme\n",
+			"_layouts/x.html":    "not a page",
+		} {
+			Write(filepath.Join(theme, name), []byte(contents))
+		}
+		defer func() { baseSources = []string{} }()
+		baseSources = []string{theme}
+
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range map[string]string{
+			"blog/a.html": "site: theme <p>Theme A.</p>", // the site's template
+			"blog/b.html": "site: site <p>Site B.</p>",
+			"style.css":   "site",
+		} {
+			if got := strings.TrimSpace(string(Read(filepath.Join(*targetDir, name)))); got != expected {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "_layouts", "x.html")); err == nil {
+			t.Errorf("expected the theme's layouts not to be rendered")
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"path/filepath"
+	"reflect"
+	"sync"
 
 	"github.com/peterbourgon/mergemap"
 )
@@ -30,8 +33,14 @@ type StackReadWriter interface {
 // As an example, Get("/foo/bar/baz") returns merged metadata for "", "/foo",
 // "/foo/bar", and "/foo/bar/baz", preferring keys from more explicit (deeper)
 // paths. In this way, Stack enables the 'stackable' Grender context behavior.
+//
+// Stack is safe for concurrent use, and Get never modifies it. Get returns a
+// fresh map, which the caller may modify. Nested values are shared with the
+// Stack, except for maps merged from more than one path, so neither the caller
+// of Get nor of Add may modify those.
 type Stack struct {
-	m map[string]map[string]interface{} // path: partial-metadata
+	mtx sync.RWMutex
+	m   map[string]map[string]interface{} // path: partial-metadata
 }
 
 func NewStack() *Stack {
@@ -45,6 +54,8 @@ func NewStack() *Stack {
 func (s *Stack) Add(path string, m map[string]interface{}) {
 	key := filepath.Join(SplitPath(path)...)
 
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 	existing, ok := s.m[key]
 	if !ok {
 		existing = map[string]interface{}{}
@@ -64,12 +75,45 @@ func (s *Stack) Get(path string) map[string]interface{} {
 	// string) under the expectation that Get will return them for every input
 	// path. So, we prepend "" to every lookup request. That means 'i' is off-
 	// by-one, so we can use it directly against the list slice.
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
 	m := map[string]interface{}{}
 	for i, _ := range append([]string{""}, list...) {
 		key := filepath.Join(list[:i]...)
 		if m0, ok := s.m[key]; ok {
-			m = mergemap.Merge(m, m0)
+			m = mergeInto(m, m0)
 		}
 	}
 	return m
 }
+
+// mergeInto merges src into dst, as mergemap.Merge does, preferring src. A
+// map in both is merged into a fresh copy of the one in dst, so only dst
+// itself is written; the maps in src are shared.
+func mergeInto(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		if existing, ok := dst[key]; ok {
+			srcMap, srcOk := copyMap(value)
+			dstMap, dstOk := copyMap(existing)
+			if srcOk && dstOk {
+				value = mergeInto(dstMap, srcMap)
+			}
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// copyMap returns a shallow copy of i, if it's any kind of map, with its keys
+// as strings.
+func copyMap(i interface{}) (map[string]interface{}, bool) {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Map {
+		return nil, false
+	}
+	m := make(map[string]interface{}, v.Len())
+	for _, k := range v.MapKeys() {
+		m[fmt.Sprint(k.Interface())] = v.MapIndex(k).Interface()
+	}
+	return m, true
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
-	"github.com/peterbourgon/mergemap"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
+
+	"github.com/peterbourgon/mergemap"
 )
 
 func TestAddGet(t *testing.T) {
@@ -101,3 +105,62 @@ func TestMergeInto(t *testing.T) {
 		t.Fatal("m3[b] != d")
 	}
 }
+
+func TestConcurrentAddGet(t *testing.T) {
+	s := NewStack()
+	s.Add("", map[string]interface{}{"site": map[string]interface{}{"title": "T", "nav": map[string]interface{}{"home": "/"}}})
+	s.Add("/dir0", map[string]interface{}{"site": map[string]interface{}{"nav": map[string]interface{}{"dir": "/dir0/"}}})
+
+	const goroutines, n = 8, 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				path := fmt.Sprintf("/dir%d/page%d.md", g%2, i)
+				s.Add(path, map[string]interface{}{
+					"n":    i,
+					"site": map[string]interface{}{fmt.Sprint("g", g): i, "nav": map[string]interface{}{"page": path}},
+				})
+				m := s.Get(path)
+				m["mutated"] = true // the result is the caller's
+				if m["n"] != i {
+					t.Errorf("%s: expected n=%d, got %v", path, i, m["n"])
+				}
+				s.Get("/dir0/page0.md")
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	m := s.Get(fmt.Sprintf("/dir1/page%d.md", n-1))
+	site, _ := m["site"].(map[string]interface{})
+	if site["title"] != "T" {
+		t.Errorf("global metadata lost: %v", site)
+	}
+	global, _ := s.Get("/elsewhere.md")["site"].(map[string]interface{})
+	if nav, _ := global["nav"].(map[string]interface{}); len(global) != 2 || len(nav) != 1 {
+		t.Errorf("nested metadata of a deeper path leaked into the global metadata: %v", global)
+	}
+	if _, ok := s.Get("/dir0/page0.md")["mutated"]; ok {
+		t.Errorf("Get result shared with the stack")
+	}
+}
+
+func TestGetSharesUnmergedMaps(t *testing.T) {
+	files := map[string]interface{}{"a.md": map[string]interface{}{"title": "A"}}
+	s := NewStack()
+	s.Add("", map[string]interface{}{"files": files, "site": map[string]interface{}{"title": "T"}})
+	s.Add("/dir", map[string]interface{}{"site": map[string]interface{}{"nav": "N"}})
+
+	m := s.Get("/dir/page.md")
+	if got, _ := m["files"].(map[string]interface{}); reflect.ValueOf(got).Pointer() != reflect.ValueOf(files).Pointer() {
+		t.Errorf("expected the global files to be shared, not copied")
+	}
+	site, _ := m["site"].(map[string]interface{})
+	site["mutated"] = true // merged from two paths, so a fresh map
+	if global, _ := s.Get("/page.md")["site"].(map[string]interface{}); len(global) != 1 {
+		t.Errorf("merged map shared with the stack: %v", global)
+	}
+}
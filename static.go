@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// CopyStatic copies every file in dir to the same path in the target
+// directory, verbatim. It runs after the rest of the build, and never
+// overwrites what the build generated: a static file whose target was written
+// by this build, or by an earlier one that graph remembers, is skipped with a
+// warning. Static files that are already up to date aren't copied again.
+func CopyStatic(dir string, graph *DependencyGraph) error {
+	if dir == "" {
+		return nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	generated := graph.Targets()
+	n := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil // descend
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(path); err != nil {
+				return err
+			} else if info.IsDir() {
+				Warningf("%s: symlink to a directory; skipping", path)
+				return nil
+			}
+		}
+
+		dst := filepath.Join(*targetDir, Relative(dir, path))
+		if generated[dst] || wasWritten(dst) {
+			Warningf("%s: %s is generated; not overwriting it", path, dst)
+			return nil
+		}
+		if dstInfo, err := os.Stat(dst); err == nil && !dstInfo.ModTime().Before(info.ModTime()) && !wasRemoved(dst) {
+			Debugf("%s up to date", dst)
+			return nil
+		}
+		Copy(dst, path)
+		n++
+		return nil
+	})
+	Debugf("%d static file(s) copied from %s", n, dir)
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyStatic(t *testing.T) {
+	files := map[string]string{
+		"index.html": "generated",
+	}
+	withSite(t, files, func() {
+		defer func(dir string) { *staticDir = dir }(*staticDir)
+		*staticDir = filepath.Join(filepath.Dir(*sourceDir), "static")
+		for name, contents := range map[string]string{
+			"index.html":     "static",
+			"img/logo.png":   "\x89PNG{{ not a template }}",
+			"fonts/a/b.woff": "font",
+			".htaccess":      "Options -Indexes",
+			"downloads/x.md": "# not rendered",
+		} {
+			Write(filepath.Join(*staticDir, name), []byte(contents))
+		}
+
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range map[string]string{
+			"index.html":     "generated",
+			"img/logo.png":   "\x89PNG{{ not a template }}",
+			"fonts/a/b.woff": "font",
+			".htaccess":      "Options -Indexes",
+			"downloads/x.md": "# not rendered",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected '%s', got '%s'", name, expected, got)
+			}
+		}
+
+		// a rebuild leaves up to date files alone, and copies changed ones
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(filepath.Join(*staticDir, "img", "logo.png"), old, old)
+		Write(filepath.Join(*targetDir, "img", "logo.png"), []byte("untouched"))
+		Write(filepath.Join(*staticDir, "fonts", "a", "b.woff"), []byte("new font"))
+		os.Chtimes(filepath.Join(*targetDir, "fonts", "a", "b.woff"), old, old)
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range map[string]string{
+			"img/logo.png":   "untouched",
+			"fonts/a/b.woff": "new font",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("rebuild: %s: expected '%s', got '%s'", name, expected, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+)
+
+var (
+	SummaryMarker = "<!--more-->"
+)
+
+// Summarize adds a "summary" of its rendered content to the metadata of every
+// Markdown page among paths, both in the Stack and under the global key, so
+// that listing pages can show teasers, and returns the summaries by source
+// file. Pages which set their own summary keep it. In incremental mode, pages
+// which the graph reports as up to date keep the summary it recorded, rather
+// than being rendered again. Pages that fail to render are skipped here;
+// Transform reports their errors.
+func Summarize(s StackReadWriter, paths []string, jobs int, graph *DependencyGraph) map[string]interface{} {
+	found := make([]interface{}, len(paths))
+	Parallel(jobs, len(paths), func(index int) {
+		path := paths[index]
+		if !isMarkdown(path) {
+			return
+		}
+		metadata := PageMetadata(s, path, nil)
+		if _, ok := metadata["summary"]; ok || Unpublished(metadata) {
+			return
+		}
+		if summary, ok := graph.Summary(path); ok && *incremental && graph.UpToDate(path) {
+			found[index] = summary
+			return
+		}
+		content, err := Contents.Render(path, metadata, nil)
+		if err != nil {
+			Debugf("%s: not summarized: %s", path, err)
+			return
+		}
+		found[index] = Summary(string(content), *summaryWords)
+	})
+
+	summaries, m := map[string]interface{}{}, map[string]interface{}{}
+	for index, summary := range found {
+		if summary == nil {
+			continue
+		}
+		metadata := map[string]interface{}{"summary": summary}
+		s.Add(paths[index], metadata)
+		SplatInto(m, SourceRelative(paths[index]), metadata)
+		summaries[paths[index]] = summary
+	}
+	s.Add("", map[string]interface{}{*globalKey: m})
+	if *globalFlat != "" {
+		files, _ := s.Get(*sourceDir)[*globalKey].(map[string]interface{})
+		s.Add("", map[string]interface{}{*globalFlat: PagesIn(files, "")})
+	}
+	Debugf("summarized %d page(s)", len(summaries))
+	return summaries
+}
+
+// Summary returns a teaser for the passed rendered content. If the content
+// contains the SummaryMarker, the teaser is the HTML before it. Otherwise,
+// it's the first n words of the content's text.
+func Summary(content string, n int) interface{} {
+	if i := strings.Index(content, SummaryMarker); i >= 0 {
+		return template.HTML(strings.TrimSpace(content[:i]))
+	}
+	words := strings.Fields(StripHTML(content))
+	if len(words) > n {
+		return strings.Join(words[:n], " ") + "…"
+	}
+	return strings.Join(words, " ")
+}
+
+// WordCount returns the number of words in the text of the passed rendered
+// content.
+func WordCount(content string) int {
+	return len(strings.Fields(StripHTML(content)))
+}
+
+// ReadingTime returns the minutes it takes to read the given number of words
+// at wpm words per minute, rounded up. Anything at all takes at least a minute.
+func ReadingTime(words, wpm int) int {
+	return (words + wpm - 1) / wpm
+}
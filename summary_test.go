@@ -0,0 +1,127 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummary(t *testing.T) {
+	for content, expected := range map[string]interface{}{
+		"<p>One two three.</p>":                          "One two three.",
+		"<p>One <em>two</em> three four five.</p>":       "One two three…",
+		"<p>Fish &amp; chips</p>":                        "Fish & chips",
+		"<p>Intro.</p>\n<!--more-->\n<p>The rest.</p>\n": template.HTML("<p>Intro.</p>"),
+	} {
+		if got := Summary(content, 3); got != expected {
+			t.Errorf("%q: expected %q, got %q", content, expected, got)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	files := map[string]string{
+		"a.md":                   "{}\n---\nOne *two* three four.\n",
+		"b.md":                   "{\"summary\":\"Mine.\"}\n---\nOne two three four.\n",
+		"blog/2020-01-01-old.md": "Old {{ .next.url }}.\n",
+		"blog/2020-02-01-new.md": "New.\n",
+	}
+	withSite(t, files, func() {
+		defer func(n int) { *summaryWords = n }(*summaryWords)
+		*summaryWords = 2
+
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		LinkNeighbors(s, paths)
+		summaries := Summarize(s, paths, 2, NewDependencyGraph())
+
+		m := s.Get(*sourceDir)[*globalKey].(map[string]interface{})
+		for name, expected := range map[string]string{"a.md": "One two…", "b.md": "Mine.", "blog/2020-01-01-old.md": "Old /blog/2020/02/01/new.html."} {
+			path := filepath.Join(*sourceDir, name)
+			if got := s.Get(path)["summary"]; got != expected {
+				t.Errorf("%s: expected summary %q, got %q", name, expected, got)
+			}
+			page := m
+			for _, level := range SplitPath(name) {
+				page, _ = page[level].(map[string]interface{})
+			}
+			if got := page["summary"]; got != expected {
+				t.Errorf("%s: expected global summary %q, got %q", name, expected, got)
+			}
+		}
+		if _, ok := summaries[filepath.Join(*sourceDir, "b.md")]; ok {
+			t.Errorf("expected no summary for a page with its own")
+		}
+	})
+}
+
+func TestIncrementalSummaries(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"page.template"}`,
+		"page.template": `{{ .content }}`,
+		"index.html":    `{{ range .files }}{{ with .summary }}{{ . }};{{ end }}{{ end }}`,
+		"a.md":          "Intro.\n\n<!--more-->\n\nThe rest.\n",
+		"b.md":          "Bee.\n",
+	}
+	withSite(t, files, func() {
+		defer func(b bool) { *incremental = b }(*incremental)
+		*incremental = true
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		graph := LoadDependencyGraph(filepath.Join(*targetDir, DependencyFile))
+		if summary, ok := graph.Summary(filepath.Join(*sourceDir, "a.md")); !ok || summary != template.HTML("<p>Intro.</p>") {
+			t.Errorf("expected the summary of a.md recorded as HTML, got %#v", summary)
+		}
+
+		// a.md is up to date, so its summary comes from the graph
+		Write(filepath.Join(*sourceDir, "a.md"), []byte("{{ broken\n"))
+		future := time.Now().Add(-time.Hour)
+		os.Chtimes(filepath.Join(*sourceDir, "a.md"), future, future)
+		Write(filepath.Join(*sourceDir, "b.md"), []byte("Bumble.\n"))
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "<p>Intro.</p>;Bumble.;", string(Read(filepath.Join(*targetDir, "index.html"))); expected != got {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestReadingTime(t *testing.T) {
+	if expected, got := 4, WordCount("<p>One <em>two</em> three.</p><p>Four</p>"); got != expected {
+		t.Errorf("WordCount: expected %d, got %d", expected, got)
+	}
+	for words, expected := range map[int]int{0: 0, 1: 1, 200: 1, 201: 2, 1000: 5} {
+		if got := ReadingTime(words, 200); got != expected {
+			t.Errorf("ReadingTime(%d, 200): expected %d, got %d", words, expected, got)
+		}
+	}
+}
+
+func TestRawContent(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"page.template","who":"World"}`,
+		"page.template": `{{ .content }}`,
+		"hello.md":      "{\"title\":\"Hello\"}\n---\n# Hello, {{ .who }}\n\nSome *emphasis* &amp; more.\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		_, metadata, err := RenderFile(s, filepath.Join(*sourceDir, "hello.md"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "# Hello, {{ .who }}\n\nSome *emphasis* &amp; more.\n", metadata["rawcontent"]; got != expected {
+			t.Errorf("rawcontent: expected %q, got %q", expected, got)
+		}
+		if plain := stringValue(metadata["plaincontent"]); !strings.Contains(plain, "Hello, World") || !strings.HasSuffix(plain, "Some emphasis & more.") || strings.Contains(plain, "<") {
+			t.Errorf("plaincontent: got %q", plain)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TargetOf returns the file TransformFile writes the source file at path to,
+// or "" if it writes nothing: for .json files and templates, and unpublished
+// pages. Paginated listings write more than that one.
+func TargetOf(s StackReader, path string) string {
+	switch ext := PageExt(path); ext {
+	case ".json", ".source", ".template":
+		return ""
+	case ".html", ".md":
+		metadata := s.Get(path)
+		if Unpublished(metadata) {
+			return ""
+		}
+		return pageTarget(path, metadata)
+	}
+	if fingerprinted, ok := Fingerprints[path]; ok {
+		return fingerprinted
+	}
+	return TargetFileFor(path, filepath.Ext(path))
+}
+
+// DuplicateTargets returns the target files that more than one of the source
+// files among paths is written to, with those source files, in order.
+func DuplicateTargets(s StackReader, paths []string) map[string][]string {
+	sources := map[string][]string{}
+	for _, path := range paths {
+		if target := TargetOf(s, path); target != "" {
+			sources[target] = append(sources[target], path)
+		}
+	}
+	duplicates := map[string][]string{}
+	for target, paths := range sources {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			duplicates[target] = paths
+		}
+	}
+	return duplicates
+}
+
+// CheckTargets warns about every one of the DuplicateTargets, since only the
+// last source file written to it survives. With -targets.strict, they're an
+// error.
+func CheckTargets(s StackReader, paths []string) error {
+	duplicates := DuplicateTargets(s, paths)
+	targets := []string{}
+	for target := range duplicates {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		Warningf("%s: written by both %s", target, strings.Join(duplicates[target], " and "))
+	}
+	if *strictTargets && len(targets) > 0 {
+		return fmt.Errorf("%d target file(s) written by more than one source file", len(targets))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDuplicateTargets(t *testing.T) {
+	files := map[string]string{
+		"_.json":        `{"template":"page.template"}`,
+		"page.template": `{{ .content }}`,
+		"post.md":       "Markdown.\n",
+		"post.html":     "HTML.\n",
+		"about.md":      "{\"slug\":\"team\"}\n---\nAbout.\n",
+		"team.html":     "Team.\n",
+		"draft.md":      "{\"draft\":true,\"slug\":\"other\"}\n---\nDraft.\n",
+		"other.html":    "Other.\n",
+		"style.css":     "p {}\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := func(name string) string { return filepath.Join(*sourceDir, name) }
+		tgt := func(name string) string { return filepath.Join(*targetDir, name) }
+		expected := map[string][]string{
+			tgt("post.html"): {src("post.html"), src("post.md")},
+			tgt("team.html"): {src("about.md"), src("team.html")},
+		}
+		if got := DuplicateTargets(s, paths); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+
+		defer func(b bool) { *strictTargets = b }(*strictTargets)
+		*strictTargets = false
+		if err := CheckTargets(s, paths); err != nil {
+			t.Errorf("expected only warnings, got %s", err)
+		}
+		*strictTargets = true
+		if err := CheckTargets(s, paths); err == nil {
+			t.Errorf("-targets.strict: expected an error")
+		}
+	})
+}
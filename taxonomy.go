@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Taxonomy groups pages by the values (terms) of a single metadata key, like
+// "tags" or "categories". Each term maps to the metadata of its pages, ordered
+// newest first, and then by URL.
+type Taxonomy map[string][]map[string]interface{}
+
+// NewTaxonomy groups the pages among paths by the terms under key. The key's
+// value may be a single string, or a list of them.
+func NewTaxonomy(s StackReader, paths []string, key string) Taxonomy {
+	t := Taxonomy{}
+	for _, path := range paths {
+		if ext := PageExt(path); ext != ".html" && ext != ".md" {
+			continue
+		}
+		metadata := s.Get(path)
+		if Unpublished(metadata) {
+			continue
+		}
+		for _, term := range Terms(metadata[key]) {
+			t[term] = append(t[term], metadata)
+		}
+	}
+	for _, pages := range t {
+		sort.Sort(byDate(pages))
+	}
+	return t
+}
+
+// Terms returns the string or strings in a taxonomy metadata value.
+func Terms(i interface{}) []string {
+	terms := []string{}
+	switch v := i.(type) {
+	case string:
+		terms = append(terms, v)
+	case []interface{}:
+		for _, vi := range v {
+			if term, ok := vi.(string); ok {
+				terms = append(terms, term)
+			}
+		}
+	case []string:
+		terms = append(terms, v...)
+	}
+	return terms
+}
+
+// TermCountKey is the key of the TermCounts in the site-level metadata.
+const TermCountKey = "termcount"
+
+// TermCounts returns the number of pages with every term of every taxonomy
+// key: those in -termcount.keys, and those listed under "taxonomies" in the
+// site-level metadata. Templates range over the terms in lexical order, like
+// any map: {{ range $tag, $n := .termcount.tags }}.
+func TermCounts(s StackReader, paths []string) map[string]interface{} {
+	keys := map[string]bool{}
+	for _, key := range strings.Split(*termCountKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	taxonomies, _ := s.Get(*sourceDir)["taxonomies"].(map[string]interface{})
+	for key := range taxonomies {
+		keys[key] = true
+	}
+
+	counts := map[string]interface{}{}
+	for key := range keys {
+		terms := map[string]interface{}{}
+		for term, pages := range NewTaxonomy(s, paths, key) {
+			terms[term] = len(pages)
+		}
+		counts[key] = terms
+	}
+	return counts
+}
+
+// SortedTerms returns the terms of the taxonomy in lexical order.
+func (t Taxonomy) SortedTerms() []string {
+	terms := []string{}
+	for term := range t {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// WriteTaxonomies renders an index page for every term of every taxonomy
+// listed under the "taxonomies" key of the site-level metadata, which maps
+// the taxonomy key to the template for its pages (relative to the source
+// directory). For example,
+//
+//	{ "taxonomies": { "tags": "tag.template" } }
+//
+// renders tag.template into /tags/<term>/index.html for every tag. The
+// template receives the site-level metadata, plus "taxonomy" (the key), "term",
+// "url", and "pages" (the metadata of every page with that term).
+//
+// Terms whose slugs are the same, like "Go" and "go", are an error, as they'd
+// overwrite each other's page. Terms without a slug are skipped.
+func WriteTaxonomies(s StackReader, paths []string) error {
+	taxonomies, _ := s.Get(*sourceDir)["taxonomies"].(map[string]interface{})
+	keys := []string{}
+	for key := range taxonomies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		templateName, ok := taxonomies[key].(string)
+		if !ok || templateName == "" {
+			Debugf("taxonomy %s: no template; skipping", key)
+			continue
+		}
+		templatePath := filepath.Join(*sourceDir, templateName)
+		if _, err := os.Stat(templatePath); err != nil {
+			Warningf("taxonomy %s: %s; skipping", key, err)
+			continue
+		}
+		templateBuf := Read(templatePath)
+
+		t := NewTaxonomy(s, paths, key)
+		slugs := map[string]string{} // slug: term
+		for _, term := range t.SortedTerms() {
+			slug := Slugify(term)
+			if slug == "" {
+				Warningf("taxonomy %s: term %q has no slug; skipping", key, term)
+				continue
+			}
+			if other, ok := slugs[slug]; ok {
+				return fmt.Errorf("taxonomy %s: terms %q and %q both have the page /%s/%s/", key, other, term, key, slug)
+			}
+			slugs[slug] = term
+			sitePath := "/" + key + "/" + slug + "/"
+			url := BasePath() + sitePath
+			metadata := s.Get(*sourceDir)
+			metadata["taxonomy"] = key
+			metadata["term"] = term
+			metadata["url"] = url
+			metadata["pages"] = t[term]
+
+			outputBuf, err := RenderPage(templatePath, templateBuf, metadata, nil) // written by every build
+			if err != nil {
+				return fmt.Errorf("taxonomy %s: %s", key, err)
+			}
+			dst := filepath.Join(*targetDir, filepath.FromSlash(sitePath), "index.html")
+			Write(dst, Minify(dst, outputBuf))
+			Debugf("taxonomy %s: %s written (%d page(s))", key, dst, len(t[term]))
+		}
+	}
+	return nil
+}
+
+// byDate sorts page metadata newest first, breaking ties (and pages without
+// dates) by URL, then source file.
+type byDate []map[string]interface{}
+
+func (a byDate) Len() int      { return len(a) }
+func (a byDate) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byDate) Less(i, j int) bool {
+	di, _ := ParseDate(a[i]["date"])
+	dj, _ := ParseDate(a[j]["date"])
+	if !di.Equal(dj) {
+		return di.After(dj)
+	}
+	if ui, uj := stringValue(a[i]["url"]), stringValue(a[j]["url"]); ui != uj {
+		return ui < uj
+	}
+	return stringValue(a[i]["source"]) < stringValue(a[j]["source"])
+}
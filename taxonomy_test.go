@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteTaxonomies(t *testing.T) {
+	files := map[string]string{
+		"_.json":       `{"taxonomies":{"tags":"tag.template","categories":""}}`,
+		"tag.template": `{{ .term }}:{{ range .pages }} {{ .title }}{{ end }}`,
+		"a.html":       "{\"title\":\"A\",\"date\":\"2013-01-01\",\"tags\":[\"go\",\"Static Sites\"],\"categories\":\"x\"}\n---\na",
+		"b.html":       "{\"title\":\"B\",\"date\":\"2013-02-01\",\"tags\":[\"go\"]}\n---\nb",
+		"c.html":       "{\"title\":\"C\"}\n---\nc",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteTaxonomies(s, paths); err != nil {
+			t.Fatal(err)
+		}
+
+		for relativePath, expected := range map[string]string{
+			"tags/go/index.html":           "go: B A",
+			"tags/static-sites/index.html": "Static Sites: A",
+		} {
+			buf, err := ioutil.ReadFile(filepath.Join(*targetDir, relativePath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); expected != got {
+				t.Errorf("%s: expected '%s', got '%s'", relativePath, expected, got)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "categories")); !os.IsNotExist(err) {
+			t.Errorf("expected no pages for a taxonomy without a template")
+		}
+	})
+}
+
+func TestTaxonomySlugs(t *testing.T) {
+	files := map[string]string{
+		"_.json":       `{"taxonomies":{"tags":"tag.template"}}`,
+		"tag.template": `{{ .term }}`,
+		"a.html":       "{\"tags\":[\"C++\",\"++\"]}\n---\na",
+		"b.html":       "{\"tags\":[\"C\"]}\n---\nb",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = WriteTaxonomies(s, paths)
+		if expected := `terms "C" and "C++" both have the page /tags/c/`; err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in the error, got %v", expected, err)
+		}
+		if _, err := os.Stat(filepath.Join(*targetDir, "tags", "index.html")); err == nil {
+			t.Errorf("expected no page for a term without a slug")
+		}
+	})
+}
+
+func TestTermCounts(t *testing.T) {
+	files := map[string]string{
+		"_.json":     `{"taxonomies":{"categories":""}}`,
+		"a.html":     "{\"tags\":[\"go\",\"web\"],\"categories\":\"x\",\"series\":\"s\"}\n---\na",
+		"b.html":     "{\"tags\":[\"go\"]}\n---\nb",
+		"draft.html": "{\"tags\":[\"go\"],\"draft\":true}\n---\nd",
+		"cloud.html": "---\n{{ range $tag, $n := .termcount.tags }}{{ $tag }}={{ $n }} {{ end }}|{{ .termcount.categories.x }}",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		paths, err := TransformPaths(*sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{
+			"tags":       map[string]interface{}{"go": 2, "web": 1},
+			"categories": map[string]interface{}{"x": 1},
+		}
+		if got := TermCounts(s, paths); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+
+		defer func(k string) { *termCountKeys = k }(*termCountKeys)
+		*termCountKeys = "tags, series"
+		if got := TermCounts(s, paths)["series"]; !reflect.DeepEqual(map[string]interface{}{"s": 1}, got) {
+			t.Errorf("-termcount.keys: expected series counted, got %v", got)
+		}
+
+		*termCountKeys = "tags"
+		if err := Build(); err != nil {
+			t.Fatal(err)
+		}
+		if got, expected := string(Read(filepath.Join(*targetDir, "cloud.html"))), "go=2 web=1 |1"; got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+}
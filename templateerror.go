@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	templateErrorRegexp  = regexp.MustCompile(`template: ([^:\s]+):(\d+)(?::(\d+))?:`)
+	templateActionRegexp = regexp.MustCompile(`at <([^>]*)>`)
+	fieldChainRegexp     = regexp.MustCompile(`(?:^|[\s(])((?:\.\w+)+)`)
+)
+
+// TemplateError describes an error parsing or executing the template named
+// name, parsed from input (or the whole file at path, if input is nil), with
+// the metadata. When the error has a position in that template, or in a
+// layout, the description leads with the file and line, and ends with the
+// lines around it. When the failed action uses a key the metadata doesn't
+// have, it names the key.
+func TemplateError(path, name string, input []byte, metadata map[string]interface{}, stage string, err error) error {
+	msg := err.Error()
+	if m := templateActionRegexp.FindStringSubmatch(msg); m != nil {
+		if key := missingKey(m[1], metadata); key != "" {
+			msg += fmt.Sprintf(" (no %s in the page's metadata)", key)
+		}
+	}
+
+	m := templateErrorRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		return fmt.Errorf("Render Template %s: %s: %s", path, stage, msg)
+	}
+	filename, offset := path, 0
+	if m[1] != name {
+		filename, input = filepath.Join(LayoutsDir(), filepath.FromSlash(m[1])), nil
+		if _, err := os.Stat(filename); err != nil {
+			return fmt.Errorf("Render Template %s: %s: %s", path, stage, msg)
+		}
+	}
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Render Template %s: %s: %s", path, stage, msg)
+	}
+	if input != nil {
+		if i := bytes.Index(file, input); i >= 0 {
+			offset = bytes.Count(file[:i], []byte("\n")) // after the front matter
+		}
+	}
+	line, _ := strconv.Atoi(m[2])
+	line += offset
+	return fmt.Errorf("Render Template %s:%d: %s: %s\n%s", filename, line, stage, msg, excerpt(file, line, 2))
+}
+
+// missingKey returns the first field chain in the template action, like
+// .author.name, that leads to a key the metadata doesn't have, up to that key.
+func missingKey(action string, metadata map[string]interface{}) string {
+	for _, m := range fieldChainRegexp.FindAllStringSubmatch(action, -1) {
+		fields := strings.Split(m[1], ".")[1:]
+		value := interface{}(metadata)
+		for i, field := range fields {
+			mv, ok := value.(map[string]interface{})
+			if !ok {
+				break
+			}
+			if value, ok = mv[field]; !ok {
+				return "." + strings.Join(fields[:i+1], ".")
+			}
+		}
+	}
+	return ""
+}
+
+// excerpt returns the lines of buf around line (counting from 1), numbered,
+// with the line itself marked.
+func excerpt(buf []byte, line, context int) string {
+	lines := strings.Split(string(buf), "\n")
+	out := strings.Builder{}
+	for i := line - context; i <= line+context; i++ {
+		if i < 1 || i > len(lines) {
+			continue
+		}
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&out, "%s %4d | %s\n", marker, i, lines[i-1])
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
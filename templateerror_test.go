@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateError(t *testing.T) {
+	files := map[string]string{
+		"missing.html":       "{\"title\":\"T\"}\n---\n<h1>{{ .title }}</h1>\n<p>\n{{ len .author.name }}\n</p>\n",
+		"parse.html":         "line 1\n{{ if .title }}\nunclosed\n",
+		"layout.html":        "{\"layout\":\"base.html\"}\n---\n{{ define \"body\" }}body{{ end }}",
+		"_layouts/base.html": "<html>\n{{ block \"body\" . }}{{ end }}\n{{ call .nothing }}\n</html>",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		for name, expected := range map[string][]string{
+			"missing.html": {
+				filepath.Join(*sourceDir, "missing.html") + ":5: Execute:",
+				"(no .author in the page's metadata)",
+				"     4 | <p>\n>    5 | {{ len .author.name }}\n     6 | </p>",
+			},
+			"parse.html": {
+				filepath.Join(*sourceDir, "parse.html") + ":",
+				": Parse: template: parse.html:",
+			},
+			"layout.html": {
+				filepath.Join(LayoutsDir(), "base.html") + ":3: Execute:",
+				">    3 | {{ call .nothing }}",
+			},
+		} {
+			_, _, err := RenderFile(s, filepath.Join(*sourceDir, name), nil)
+			if err == nil {
+				t.Errorf("%s: expected an error", name)
+				continue
+			}
+			for _, fragment := range expected {
+				if !strings.Contains(err.Error(), fragment) {
+					t.Errorf("%s: expected %q in:\n%s", name, fragment, err)
+				}
+			}
+		}
+	})
+
+	if expected, got := "     1 | a\n>    2 | b\n     3 | c", excerpt([]byte("a\nb\nc\nd"), 2, 1); got != expected {
+		t.Errorf("excerpt: expected %q, got %q", expected, got)
+	}
+}
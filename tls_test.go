@@ -0,0 +1,22 @@
+package main
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := SelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		if err := parsed.VerifyHostname(host); err != nil {
+			t.Errorf("%s: %s", host, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	headingLevels = map[atom.Atom]int{
+		atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+	}
+)
+
+// TOC returns the table of contents of the rendered content: the "level" (1
+// to 6), "text" and anchor "id" of every heading with an id, in order. Pages
+// get it under the "toc" key, to build their own markup from.
+func TOC(content []byte) []map[string]interface{} {
+	entries := []map[string]interface{}{}
+	z := html.NewTokenizer(bytes.NewReader(content))
+	var current map[string]interface{}
+	var text strings.Builder
+	anchor := false // inside a heading's AnchorRenderer permalink
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return entries
+		case html.StartTagToken:
+			t := z.Token()
+			if current != nil && t.DataAtom == atom.A && isAnchor(t) {
+				anchor = true
+				continue
+			}
+			level, ok := headingLevels[t.DataAtom]
+			if !ok || current != nil {
+				continue
+			}
+			for _, attr := range t.Attr {
+				if attr.Key == "id" && attr.Val != "" {
+					current = map[string]interface{}{"level": level, "id": attr.Val}
+					text.Reset()
+				}
+			}
+		case html.TextToken:
+			if current != nil && !anchor {
+				text.Write(z.Text())
+			}
+		case html.EndTagToken:
+			t := z.Token()
+			if t.DataAtom == atom.A {
+				anchor = false
+			}
+			if current != nil && headingLevels[t.DataAtom] == current["level"] {
+				current["text"] = strings.Join(strings.Fields(text.String()), " ")
+				entries = append(entries, current)
+				current = nil
+			}
+		}
+	}
+}
+
+// isAnchor returns whether the token is a permalink added by AnchorRenderer.
+func isAnchor(t html.Token) bool {
+	for _, attr := range t.Attr {
+		if attr.Key == "class" && attr.Val == *anchorClass {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTOC(t *testing.T) {
+	htmlBits, extensionBits := MarkdownBits(map[string]interface{}{})
+	content := RenderMarkdown([]byte("# Title\n\nIntro\n\n## The *second* part\n\ntext\n\n### Deep {#custom}\n\n#### Not `this` one\n"), htmlBits, extensionBits)
+	expected := "[map[id:title level:1 text:Title] map[id:the-second-part level:2 text:The second part] " +
+		"map[id:custom level:3 text:Deep] map[id:not-this-one level:4 text:Not this one]]"
+	if got := fmt.Sprint(TOC(content)); expected != got {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if got := TOC([]byte("<h2>no id</h2><p>text</p>")); len(got) != 0 {
+		t.Errorf("expected no entries for headings without ids, got %v", got)
+	}
+
+	files := map[string]string{
+		"_.json":        `{"template":"page.template"}`,
+		"page.template": `<nav>{{ range .toc }}{{ .level }}:<a href="#{{ .id }}">{{ .text }}</a> {{ end }}</nav>{{ .content }}`,
+		"page.md":       "# One\n\n## Two\n",
+		"inline.md":     "{\"inlinetoc\":true}\n---\n# One\n",
+	}
+	withSite(t, files, func() {
+		s := gather(t)
+		buf, _, err := RenderFile(s, *sourceDir+"/page.md", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `<nav>1:<a href="#one">One</a> 2:<a href="#two">Two</a> </nav><h1 id="one">One <a class="heading-anchor" href="#one">#</a></h1>` + "\n\n" +
+			`<h2 id="two">Two <a class="heading-anchor" href="#two">#</a></h2>` + "\n"
+		if got := string(buf); expected != got {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+		buf, _, err = RenderFile(s, *sourceDir+"/inline.md", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf); !strings.Contains(got, "<nav>\n<ul>\n<li><a href=\"#one\">One</a></li>") {
+			t.Errorf("inlinetoc: expected the inline table of contents, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch watches the roots and every directory beneath them for changes. Once
+// changes have settled for the debounce duration, Watch calls f with the
+// sorted names of every file that changed, one call at a time. Watch blocks
+// until the watcher fails.
+func Watch(roots []string, debounce time.Duration, f func([]string)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	add := func(dir string) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && Ignored(path, true) {
+				return filepath.SkipDir
+			}
+			if info.IsDir() {
+				Debugf("watching %s", path)
+				return w.Add(path)
+			}
+			return nil
+		})
+	}
+	for _, root := range roots {
+		if err := add(root); err != nil {
+			return err
+		}
+	}
+
+	changed := map[string]struct{}{}
+	var settled <-chan time.Time
+	for {
+		select {
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if Ignored(event.Name, false) {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := add(event.Name); err != nil {
+						Warningf("watch %s: %s", event.Name, err)
+					}
+				}
+			}
+			changed[event.Name] = struct{}{}
+			settled = time.After(debounce)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			Warningf("watch: %s", err)
+
+		case <-settled:
+			names := []string{}
+			for name := range changed {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			changed, settled = map[string]struct{}{}, nil
+			f(names)
+		}
+	}
+}
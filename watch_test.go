@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchRoots(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "grender-test-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+	Write(filepath.Join(a, "x.md"), []byte("x"))
+	Write(filepath.Join(b, "y.md"), []byte("y"))
+
+	calls := make(chan []string, 10)
+	go Watch([]string{a, b}, 200*time.Millisecond, func(names []string) { calls <- names })
+	time.Sleep(200 * time.Millisecond) // let the watcher start
+
+	Write(filepath.Join(a, "x.md"), []byte("x2"))
+	Write(filepath.Join(b, "y.md"), []byte("y2"))
+	select {
+	case names := <-calls:
+		if expected := []string{filepath.Join(a, "x.md"), filepath.Join(b, "y.md")}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected one call with %v, got %v", expected, names)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no changes seen")
+	}
+	select {
+	case names := <-calls:
+		t.Errorf("expected a single call, got another with %v", names)
+	case <-time.After(500 * time.Millisecond):
+	}
+}